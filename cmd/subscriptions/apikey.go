@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/google/uuid"
+)
+
+// runAPIKey runs the apikey subcommands: create prints a new key of a user,
+// which is not stored and cannot be shown again, list shows the keys of a
+// user and revoke disables a key by id.
+func runAPIKey(ctx context.Context, env *env, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("expected an apikey command: create, list or revoke")
+	}
+	action, args := args[0], args[1:]
+
+	flags := newFlagSet("apikey")
+	tenant := tenantFlag(flags)
+	userID := flags.String("user", "", "user ID")
+	name := flags.String("name", "default", "name of the key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx, err := withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	storage, err := openStorage(env.config)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	switch action {
+	case "create":
+		if uuid.Validate(*userID) != nil {
+			return fmt.Errorf("-user must be a user ID")
+		}
+		if err := ensureUser(ctx, newUserService(env.config, storage), *userID); err != nil {
+			return err
+		}
+		key, hash := domain.NewAPIKey()
+		apiKey := domain.APIKey{UserID: *userID, Name: *name, Hash: hash}
+		if err := storage.apiKeys.Create(ctx, &apiKey); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "created API key %s, it is shown only once:\n", apiKey.ID)
+		fmt.Println(key)
+	case "list":
+		if uuid.Validate(*userID) != nil {
+			return fmt.Errorf("-user must be a user ID")
+		}
+		keys, err := storage.apiKeys.ListByUser(ctx, *userID)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCREATED\tREVOKED")
+		for _, k := range keys {
+			revoked := ""
+			if k.RevokedAt != nil {
+				revoked = k.RevokedAt.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", k.ID, k.Name, k.CreatedAt.Format(time.DateTime), revoked)
+		}
+		return w.Flush()
+	case "revoke":
+		if flags.NArg() != 1 {
+			return fmt.Errorf("expected the id of the key to revoke")
+		}
+		if err := storage.apiKeys.Revoke(ctx, flags.Arg(0)); err != nil {
+			return err
+		}
+		fmt.Println("revoked API key", flags.Arg(0))
+	default:
+		return fmt.Errorf("unknown apikey command %q", action)
+	}
+	return nil
+}
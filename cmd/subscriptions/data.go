@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
+
+// Subscriptions are exchanged as JSON lines of the API representation, or
+// as CSV with these columns and dates in MM-YYYY format.
+var csvHeader = []string{"id", "user_id", "service_name", "price", "currency", "start_date", "end_date", "billing_period", "billing_interval"}
+
+const (
+	formatJSONL = "jsonl"
+	formatCSV   = "csv"
+
+	exportPageSize = 100
+)
+
+// runImport creates the subscriptions read from a file or stdin through the
+// service, keeping their ids.
+func runImport(ctx context.Context, env *env, args []string) error {
+	flags := newFlagSet("import")
+	tenant := tenantFlag(flags)
+	format := flags.String("format", formatJSONL, "input format, jsonl or csv")
+	skipExisting := flags.Bool("skip-existing", false, "skip subscriptions whose id already exists")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx, err := withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	in := io.Reader(os.Stdin)
+	if path := flags.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	read, err := newSubscriptionReader(in, *format)
+	if err != nil {
+		return err
+	}
+
+	storage, err := openStorage(env.config)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	service, err := newService(env.config, storage)
+	if err != nil {
+		return err
+	}
+	users := newUserService(env.config, storage)
+
+	created, skipped := 0, 0
+	for record := 1; ; record++ {
+		sub, err := read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", record, err)
+		}
+		if err := validateImported(sub); err != nil {
+			return fmt.Errorf("record %d: %w", record, err)
+		}
+		if err := ensureUser(ctx, users, sub.UserID); err != nil {
+			return fmt.Errorf("record %d: %w", record, err)
+		}
+
+		err = service.Create(ctx, &sub)
+		if *skipExisting && errors.Is(err, domain.ErrConflict) {
+			skipped++
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("record %d: %w", record, err)
+		}
+		created++
+	}
+	fmt.Printf("imported %d subscriptions, skipped %d\n", created, skipped)
+	return nil
+}
+
+// validateImported checks what the API validates on creation
+func validateImported(sub domain.Subscription) error {
+	switch {
+	case sub.UserID == "":
+		return fmt.Errorf("%w: missing user_id", domain.ErrValidation)
+	case sub.ServiceName == "":
+		return fmt.Errorf("%w: missing service_name", domain.ErrValidation)
+	case sub.StartDate.IsZero():
+		return fmt.Errorf("%w: missing start_date", domain.ErrValidation)
+	case sub.Price < 0:
+		return fmt.Errorf("%w: negative price", domain.ErrValidation)
+	case sub.BillingPeriod != "" && !sub.BillingPeriod.Valid():
+		return fmt.Errorf("%w: invalid billing_period %q", domain.ErrValidation, sub.BillingPeriod)
+	}
+	return sub.Validate()
+}
+
+// runExport writes the subscriptions, of a single user if given, to a file
+// or stdout.
+func runExport(ctx context.Context, env *env, args []string) error {
+	flags := newFlagSet("export")
+	tenant := tenantFlag(flags)
+	format := flags.String("format", formatJSONL, "output format, jsonl or csv")
+	userID := flags.String("user", "", "export only the subscriptions of the user")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx, err := withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if path := flags.Arg(0); path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	write, flush, err := newSubscriptionWriter(out, *format)
+	if err != nil {
+		return err
+	}
+
+	storage, err := openStorage(env.config)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	service, err := newService(env.config, storage)
+	if err != nil {
+		return err
+	}
+
+	filter := domain.ListFilter{UserID: *userID, Limit: exportPageSize}
+	for {
+		page, err := service.List(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for _, sub := range page.Items {
+			if err := write(sub); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor, err := domain.DecodeCursor(page.NextCursor)
+		if err != nil {
+			return err
+		}
+		filter.After = &cursor
+	}
+	return flush()
+}
+
+func newSubscriptionReader(r io.Reader, format string) (func() (domain.Subscription, error), error) {
+	switch format {
+	case formatJSONL:
+		dec := json.NewDecoder(r)
+		dec.DisallowUnknownFields()
+		return func() (domain.Subscription, error) {
+			var sub domain.Subscription
+			err := dec.Decode(&sub)
+			return sub, err
+		}, nil
+	case formatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = len(csvHeader)
+		if _, err := reader.Read(); err != nil {
+			return nil, fmt.Errorf("failed to read CSV header: %w", err)
+		}
+		return func() (domain.Subscription, error) {
+			row, err := reader.Read()
+			if err != nil {
+				return domain.Subscription{}, err
+			}
+			return parseCSVRow(row)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, expected jsonl or csv", format)
+}
+
+func newSubscriptionWriter(w io.Writer, format string) (write func(domain.Subscription) error, flush func() error, err error) {
+	switch format {
+	case formatJSONL:
+		enc := json.NewEncoder(w)
+		return func(sub domain.Subscription) error { return enc.Encode(sub) },
+			func() error { return nil }, nil
+	case formatCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(csvHeader); err != nil {
+			return nil, nil, err
+		}
+		write = func(sub domain.Subscription) error {
+			return writer.Write(formatCSVRow(sub))
+		}
+		flush = func() error {
+			writer.Flush()
+			return writer.Error()
+		}
+		return write, flush, nil
+	}
+	return nil, nil, fmt.Errorf("unknown format %q, expected jsonl or csv", format)
+}
+
+func parseCSVRow(row []string) (domain.Subscription, error) {
+	sub := domain.Subscription{
+		ID:            row[0],
+		UserID:        row[1],
+		ServiceName:   row[2],
+		Currency:      row[4],
+		BillingPeriod: domain.BillingPeriod(row[7]),
+	}
+	var err error
+	if sub.Price, err = strconv.Atoi(row[3]); err != nil {
+		return sub, fmt.Errorf("invalid price %q", row[3])
+	}
+	if err := sub.StartDate.Scan(row[5]); err != nil {
+		return sub, fmt.Errorf("invalid start_date %q, expected MM-YYYY", row[5])
+	}
+	if row[6] != "" {
+		sub.EndDate = &domain.ShortDate{}
+		if err := sub.EndDate.Scan(row[6]); err != nil {
+			return sub, fmt.Errorf("invalid end_date %q, expected MM-YYYY", row[6])
+		}
+	}
+	if row[8] != "" {
+		if sub.BillingInterval, err = strconv.Atoi(row[8]); err != nil {
+			return sub, fmt.Errorf("invalid billing_interval %q", row[8])
+		}
+	}
+	return sub, nil
+}
+
+func formatCSVRow(sub domain.Subscription) []string {
+	endDate := ""
+	if sub.EndDate != nil {
+		endDate = sub.EndDate.Format("01-2006")
+	}
+	return []string{
+		sub.ID,
+		sub.UserID,
+		sub.ServiceName,
+		strconv.Itoa(sub.Price),
+		sub.Currency,
+		sub.StartDate.Format("01-2006"),
+		endDate,
+		string(sub.BillingPeriod),
+		strconv.Itoa(sub.BillingInterval),
+	}
+}
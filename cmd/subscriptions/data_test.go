@@ -0,0 +1,258 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const csvHeaderLine = "id,user_id,service_name,price,currency,start_date,end_date,billing_period,billing_interval\n"
+
+func shortDate(t *testing.T, s string) domain.ShortDate {
+	t.Helper()
+	var date domain.ShortDate
+	require.NoError(t, date.Scan(s))
+	return date
+}
+
+// readAll reads the subscriptions until the first error, which is nil at the
+// end of the input
+func readAll(t *testing.T, input, format string) ([]domain.Subscription, error) {
+	t.Helper()
+	read, err := newSubscriptionReader(strings.NewReader(input), format)
+	if err != nil {
+		return nil, err
+	}
+	var subs []domain.Subscription
+	for {
+		sub, err := read()
+		if errors.Is(err, io.EOF) {
+			return subs, nil
+		}
+		if err != nil {
+			return subs, err
+		}
+		subs = append(subs, sub)
+	}
+}
+
+func TestSubscriptionReader(t *testing.T) {
+	endDate := shortDate(t, "12-2025")
+	netflix := domain.Subscription{
+		ID:              "3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a",
+		UserID:          "550e8400-e29b-41d4-a716-446655440000",
+		ServiceName:     "Netflix",
+		Price:           500,
+		Currency:        "RUB",
+		StartDate:       shortDate(t, "07-2025"),
+		EndDate:         &endDate,
+		BillingPeriod:   domain.BillingYearly,
+		BillingInterval: 2,
+	}
+	spotify := domain.Subscription{
+		UserID:      "550e8400-e29b-41d4-a716-446655440000",
+		ServiceName: "Spotify, family",
+		Price:       300,
+		StartDate:   shortDate(t, "01-2025"),
+	}
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []domain.Subscription
+		wantErr string
+	}{
+		{
+			name:   "csv columns",
+			format: formatCSV,
+			input: csvHeaderLine +
+				"3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a,550e8400-e29b-41d4-a716-446655440000,Netflix,500,RUB,07-2025,12-2025,yearly,2\n" +
+				`,550e8400-e29b-41d4-a716-446655440000,"Spotify, family",300,,01-2025,,,` + "\n",
+			want: []domain.Subscription{netflix, spotify},
+		},
+		{
+			name:   "csv header only",
+			format: formatCSV,
+			input:  csvHeaderLine,
+		},
+		{
+			name:    "csv without header",
+			format:  formatCSV,
+			input:   "",
+			wantErr: "failed to read CSV header: EOF",
+		},
+		{
+			name:    "csv missing column",
+			format:  formatCSV,
+			input:   csvHeaderLine + ",u1,Netflix,500,RUB,07-2025,,monthly\n",
+			wantErr: "wrong number of fields",
+		},
+		{
+			name:    "csv invalid price",
+			format:  formatCSV,
+			input:   csvHeaderLine + ",u1,Netflix,5.00,RUB,07-2025,,monthly,1\n",
+			wantErr: `invalid price "5.00"`,
+		},
+		{
+			name:    "csv invalid start date",
+			format:  formatCSV,
+			input:   csvHeaderLine + ",u1,Netflix,500,RUB,2025-07,,monthly,1\n",
+			wantErr: `invalid start_date "2025-07", expected MM-YYYY`,
+		},
+		{
+			name:    "csv invalid end date",
+			format:  formatCSV,
+			input:   csvHeaderLine + ",u1,Netflix,500,RUB,07-2025,13-2025,monthly,1\n",
+			wantErr: `invalid end_date "13-2025", expected MM-YYYY`,
+		},
+		{
+			name:    "csv invalid billing interval",
+			format:  formatCSV,
+			input:   csvHeaderLine + ",u1,Netflix,500,RUB,07-2025,,monthly,one\n",
+			wantErr: `invalid billing_interval "one"`,
+		},
+		{
+			name:   "jsonl",
+			format: formatJSONL,
+			input: `{"id":"3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a","user_id":"550e8400-e29b-41d4-a716-446655440000","service_name":"Netflix","price":500,"currency":"RUB","start_date":"07-2025","end_date":"12-2025","billing_period":"yearly","billing_interval":2}` + "\n" +
+				`{"user_id":"550e8400-e29b-41d4-a716-446655440000","service_name":"Spotify, family","price":300,"start_date":"01-2025"}` + "\n",
+			want: []domain.Subscription{netflix, spotify},
+		},
+		{
+			name:    "jsonl unknown field",
+			format:  formatJSONL,
+			input:   `{"user_id":"u1","service_name":"Netflix","cost":500}`,
+			wantErr: `unknown field "cost"`,
+		},
+		{
+			name:    "unknown format",
+			format:  "xml",
+			wantErr: `unknown format "xml", expected jsonl or csv`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subs, err := readAll(t, tt.input, tt.format)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, subs)
+		})
+	}
+}
+
+func TestSubscriptionWriter(t *testing.T) {
+	endDate := shortDate(t, "12-2025")
+	subs := []domain.Subscription{
+		{
+			ID:              "3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a",
+			UserID:          "550e8400-e29b-41d4-a716-446655440000",
+			ServiceName:     "Netflix",
+			Price:           500,
+			Currency:        "RUB",
+			StartDate:       shortDate(t, "07-2025"),
+			EndDate:         &endDate,
+			BillingPeriod:   domain.BillingYearly,
+			BillingInterval: 2,
+			Version:         3,
+		},
+		{
+			ID:              "7c9e6679-7425-40de-944b-e07fc1f90ae7",
+			UserID:          "550e8400-e29b-41d4-a716-446655440000",
+			ServiceName:     "Spotify, family",
+			Price:           300,
+			Currency:        "USD",
+			StartDate:       shortDate(t, "01-2025"),
+			BillingPeriod:   domain.BillingMonthly,
+			BillingInterval: 1,
+			Version:         1,
+		},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{
+			formatCSV,
+			csvHeaderLine +
+				"3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a,550e8400-e29b-41d4-a716-446655440000,Netflix,500,RUB,07-2025,12-2025,yearly,2\n" +
+				`7c9e6679-7425-40de-944b-e07fc1f90ae7,550e8400-e29b-41d4-a716-446655440000,"Spotify, family",300,USD,01-2025,,monthly,1` + "\n",
+		},
+		{
+			formatJSONL,
+			`{"id":"3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a","user_id":"550e8400-e29b-41d4-a716-446655440000","service_name":"Netflix","price":500,"currency":"RUB","start_date":"07-2025","end_date":"12-2025","billing_period":"yearly","billing_interval":2,"version":3}` + "\n" +
+				`{"id":"7c9e6679-7425-40de-944b-e07fc1f90ae7","user_id":"550e8400-e29b-41d4-a716-446655440000","service_name":"Spotify, family","price":300,"currency":"USD","start_date":"01-2025","billing_period":"monthly","billing_interval":1,"version":1}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			write, flush, err := newSubscriptionWriter(&out, tt.format)
+			require.NoError(t, err)
+			for _, sub := range subs {
+				require.NoError(t, write(sub))
+			}
+			require.NoError(t, flush())
+			assert.Equal(t, tt.want, out.String())
+
+			// Exported subscriptions import unchanged, except for versions,
+			// which CSV does not keep.
+			read, err := readAll(t, out.String(), tt.format)
+			require.NoError(t, err)
+			require.Len(t, read, len(subs))
+			for i := range read {
+				read[i].Version = subs[i].Version
+			}
+			assert.Equal(t, subs, read)
+		})
+	}
+
+	_, _, err := newSubscriptionWriter(&bytes.Buffer{}, "xml")
+	assert.EqualError(t, err, `unknown format "xml", expected jsonl or csv`)
+}
+
+func TestValidateImported(t *testing.T) {
+	valid := domain.Subscription{
+		UserID:      "550e8400-e29b-41d4-a716-446655440000",
+		ServiceName: "Netflix",
+		Price:       500,
+		StartDate:   domain.ShortDate{Time: time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	tests := []struct {
+		name    string
+		modify  func(sub *domain.Subscription)
+		wantErr string
+	}{
+		{"valid", func(sub *domain.Subscription) {}, ""},
+		{"missing user", func(sub *domain.Subscription) { sub.UserID = "" }, "missing user_id"},
+		{"missing service", func(sub *domain.Subscription) { sub.ServiceName = "" }, "missing service_name"},
+		{"missing start date", func(sub *domain.Subscription) { sub.StartDate = domain.ShortDate{} }, "missing start_date"},
+		{"negative price", func(sub *domain.Subscription) { sub.Price = -1 }, "negative price"},
+		{"invalid billing period", func(sub *domain.Subscription) { sub.BillingPeriod = "daily" }, `invalid billing_period "daily"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := valid
+			tt.modify(&sub)
+			err := validateImported(sub)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, domain.ErrValidation)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -2,26 +2,64 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
-	"time"
+	"strings"
+	"syscall"
 
 	"go.uber.org/zap"
 
-	_ "github.com/alexputin/subscriptions/docs"
-	"github.com/alexputin/subscriptions/internal/config"
-	"github.com/alexputin/subscriptions/internal/db"
-	"github.com/alexputin/subscriptions/internal/handlers"
-	"github.com/alexputin/subscriptions/internal/repositories"
-	"github.com/alexputin/subscriptions/internal/services"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	echoSwagger "github.com/swaggo/echo-swagger"
+	appconfig "github.com/alexputin/subscriptions/internal/config"
+	"github.com/alexputin/subscriptions/internal/domain"
 )
 
+// command is a subcommand of the subscriptions binary
+type command struct {
+	name    string
+	args    string // usage of the arguments
+	summary string
+	run     func(ctx context.Context, env *env, args []string) error
+}
+
+// env is what commands share: the configuration and the logger
+type env struct {
+	config *appconfig.Config
+	logger *zap.Logger
+}
+
+// commands are set in init, their run functions refer to them for usage
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "[-addr address]", "start the HTTP server (default command)", runServe},
+		{"migrate", "up | down [steps] | status", "apply, revert or list database migrations", runMigrate},
+		{"import", "[-tenant id] [-format jsonl|csv] [-skip-existing] [file]", "create subscriptions from a file or stdin", runImport},
+		{"export", "[-tenant id] [-format jsonl|csv] [-user id] [file]", "write subscriptions to a file or stdout", runExport},
+		{"report", "total [-tenant id] [-user id] [-service name] [-from MM-YYYY] [-to MM-YYYY] [-mode cash|amortized] [-currency code] [-json]", "report spend on subscriptions", runReport},
+		{"apikey", "create -user id [-name name] | list -user id | revoke id, each [-tenant id]", "manage API keys of users", runAPIKey},
+		{"seed", "[-tenant id] [-users n] [-subscriptions n] [-seed n]", "create random subscriptions for development", runSeed},
+	}
+}
+
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description JWT signed with HS256 or RS256, as "Bearer <token>"
+
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description API key created with the apikey command
 func main() {
+	os.Exit(run())
+}
+
+func run() int {
 	// Инициализация zap logger
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -29,70 +67,76 @@ func main() {
 	}
 	defer logger.Sync()
 
-	logger.Info("Starting application")
-
-	config.MustLoadConfig()
-	config := config.Get()
-
-	// Create database connection
-	db, err := db.CreatePostgresConnection(config.DatabaseURL)
-	if err != nil {
-		logger.Fatal("failed to connect to database", zap.Error(err))
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+	if name == "help" {
+		usage(os.Stdout)
+		return 0
+	}
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage(os.Stderr)
+		return 2
 	}
-	defer func() {
-		if err := db.Close(); err != nil {
-			logger.Error("failed to close database connection", zap.Error(err))
-		}
-	}()
-	logger.Info("Database connection established")
-
-	repo := repositories.NewPostgresUserSubscriptionRepository(db)
-	service := services.NewUserSubscriptionService(repo)
-	logger.Info("Repository and service initialized")
-
-	app := echo.New()
-	app.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			start := time.Now()
-			err := next(c)
-			latency := time.Since(start)
-			logger.Info("request completed",
-				zap.String("method", c.Request().Method),
-				zap.String("uri", c.Request().RequestURI),
-				zap.Int("status", c.Response().Status),
-				zap.Duration("latency", latency),
-				zap.String("remote_ip", c.RealIP()),
-			)
-			return err
-		}
-	})
 
-	app.Use(middleware.Recover())
+	appconfig.MustLoadConfig()
+	env := &env{config: appconfig.Get(), logger: logger}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Register routes
-	api := handlers.NewSubscriptionsApiHandler(service, logger)
-	api.RegisterRoutes(app)
-	app.GET("/swagger/*", echoSwagger.WrapHandler)
-	logger.Info("Routes registered")
+	if err := cmd.run(ctx, env, args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "subscriptions %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
 
-	// Server graceful shutdown
-	go func() {
-		logger.Info("Starting HTTP server", zap.String("address", config.ServerAddress))
-		if err := app.Start(config.ServerAddress); err != nil && err != http.ErrServerClosed {
-			logger.Fatal("shutting down the server", zap.Error(err))
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
 		}
-	}()
+	}
+	return command{}, false
+}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
-	<-quit
-	logger.Info("Shutting down server...")
+func usage(w *os.File) {
+	fmt.Fprintln(w, "usage: subscriptions <command> [arguments]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.summary)
+		fmt.Fprintf(w, "  %-8s   subscriptions %s %s\n", "", cmd.name, cmd.args)
+	}
+}
 
-	shutdownCtx, stop := context.WithCancel(context.Background())
-	defer stop()
+// newFlagSet returns the flags of the command printing its usage on errors
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		cmd, _ := findCommand(strings.Fields(name)[0])
+		fmt.Fprintf(fs.Output(), "usage: subscriptions %s %s\n", cmd.name, cmd.args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// tenantFlag defines the -tenant flag of commands working on the data of a
+// tenant
+func tenantFlag(fs *flag.FlagSet) *string {
+	return fs.String("tenant", domain.DefaultTenant, "tenant whose data the command works on")
+}
 
-	if err := app.Shutdown(shutdownCtx); err != nil {
-		logger.Fatal("Server forced to shutdown", zap.Error(err))
+// withTenant returns a context acting within the tenant
+func withTenant(ctx context.Context, tenantID string) (context.Context, error) {
+	if !domain.ValidTenantID(tenantID) {
+		return ctx, fmt.Errorf("invalid tenant %q", tenantID)
 	}
-	logger.Info("Server shutdown complete")
+	return domain.WithTenant(ctx, tenantID), nil
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	appconfig "github.com/alexputin/subscriptions/internal/config"
+	database "github.com/alexputin/subscriptions/internal/db"
+	"github.com/alexputin/subscriptions/migrations"
+	"github.com/jmoiron/sqlx"
+)
+
+// newMigrator returns the migrator of the embedded migrations of the driver.
+func newMigrator(db *sqlx.DB, driver string) (*database.Migrator, error) {
+	if driver == appconfig.DriverSQLite {
+		return database.NewMigrator(db, migrations.SQLite)
+	}
+	return database.NewMigrator(db, migrations.Postgres)
+}
+
+// runMigrate runs the migrate subcommand: up applies all pending migrations,
+// down reverts the latest one or the given number of steps, status lists
+// the migrations.
+func runMigrate(ctx context.Context, env *env, args []string) error {
+	flags := newFlagSet("migrate")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return flag.ErrHelp
+	}
+
+	storage, err := openStorage(env.config)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+
+	migrator, err := newMigrator(storage.db, env.config.DatabaseDriver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("steps must be a positive integer: %s", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("reverted %d migrations\n", reverted)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS")
+		for _, s := range statuses {
+			status := "pending"
+			if s.Applied {
+				status = "applied"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, s.Name, status)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	return nil
+}
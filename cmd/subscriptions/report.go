@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
+
+// runReport runs the report subcommands: total prints the spend matching the
+// filters, like GET /api/v1/subscriptions/total.
+func runReport(ctx context.Context, env *env, args []string) error {
+	if len(args) == 0 || args[0] != "total" {
+		cmd, _ := findCommand("report")
+		fmt.Fprintf(os.Stderr, "usage: subscriptions report %s\n", cmd.args)
+		return fmt.Errorf("expected a report: total")
+	}
+
+	flags := newFlagSet("report")
+	tenant := tenantFlag(flags)
+	userID := flags.String("user", "", "user ID, all users if empty")
+	var serviceNames stringList
+	flags.Var(&serviceNames, "service", "service name, may be repeated or comma separated")
+	from := flags.String("from", "", "first month, MM-YYYY")
+	to := flags.String("to", "", "last month, MM-YYYY, defaults to the current month")
+	mode := flags.String("mode", "", "cost attribution of long billing cycles, cash or amortized")
+	currency := flags.String("currency", "", "ISO-4217 currency of the report, defaults to the reporting currency")
+	asJSON := flags.Bool("json", false, "print the total as JSON")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	ctx, err := withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+
+	filter := domain.CostFilter{
+		UserID:       *userID,
+		ServiceNames: serviceNames,
+		Mode:         domain.CostMode(*mode),
+		Currency:     strings.ToUpper(*currency),
+	}
+	if filter.Mode != "" && !filter.Mode.Valid() {
+		return fmt.Errorf("invalid mode %q, expected cash or amortized", *mode)
+	}
+	if *from != "" {
+		if filter.From, err = time.Parse("01-2006", *from); err != nil {
+			return fmt.Errorf("invalid from date %q, expected MM-YYYY", *from)
+		}
+	}
+	if *to != "" {
+		if filter.To, err = time.Parse("01-2006", *to); err != nil {
+			return fmt.Errorf("invalid to date %q, expected MM-YYYY", *to)
+		}
+	}
+	if from, to := filter.Period(); from.After(to) {
+		return fmt.Errorf("from date is after to date")
+	}
+
+	storage, err := openStorage(env.config)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	service, err := newService(env.config, storage)
+	if err != nil {
+		return err
+	}
+
+	total, err := service.TotalPrice(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return json.NewEncoder(os.Stdout).Encode(map[string]any{"total": total.Amount, "currency": total.Currency})
+	}
+	fmt.Println(formatMoney(total))
+	return nil
+}
+
+// formatMoney formats an amount in minor units in major units, e.g. 1497.00 RUB
+func formatMoney(m domain.Money) string {
+	exp := domain.CurrencyExponent(m.Currency)
+	if exp == 0 {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	sign, amount := "", m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	scale := 1
+	for range exp {
+		scale *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/scale, exp, amount%scale, m.Currency)
+}
+
+// stringList is a flag collecting repeated and comma separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
+
+// seedServices are the services of seeded subscriptions with their monthly
+// prices in minor units
+var seedServices = []struct {
+	name  string
+	price int
+}{
+	{"Netflix", 79900},
+	{"Spotify", 29900},
+	{"Yandex Plus", 39900},
+	{"YouTube Premium", 29900},
+	{"Apple One", 59900},
+	{"Kinopoisk", 29900},
+	{"iCloud", 14900},
+	{"Google One", 13900},
+}
+
+// runSeed creates random subscriptions of new users for development. The
+// same seed creates the same subscriptions for different user IDs.
+func runSeed(ctx context.Context, env *env, args []string) error {
+	flags := newFlagSet("seed")
+	tenant := tenantFlag(flags)
+	users := flags.Int("users", 3, "number of users")
+	perUser := flags.Int("subscriptions", 4, "number of subscriptions per user")
+	seed := flags.Uint64("seed", 1, "seed of the random generator")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	ctx, err := withTenant(ctx, *tenant)
+	if err != nil {
+		return err
+	}
+	if *users <= 0 || *perUser <= 0 || *perUser > len(seedServices) {
+		return fmt.Errorf("users must be positive and subscriptions between 1 and %d", len(seedServices))
+	}
+
+	storage, err := openStorage(env.config)
+	if err != nil {
+		return err
+	}
+	defer storage.Close()
+	service, err := newService(env.config, storage)
+	if err != nil {
+		return err
+	}
+	userService := newUserService(env.config, storage)
+
+	rnd := rand.New(rand.NewPCG(*seed, *seed))
+	month := domain.CurrentMonth()
+	periods := []domain.BillingPeriod{domain.BillingMonthly, domain.BillingMonthly, domain.BillingQuarterly, domain.BillingYearly}
+
+	for n := range *users {
+		user := domain.User{DisplayName: fmt.Sprintf("Seed user %d", n+1)}
+		if err := userService.Create(ctx, &user); err != nil {
+			return err
+		}
+		userID := user.ID
+		for _, i := range rnd.Perm(len(seedServices))[:*perUser] {
+			period := periods[rnd.IntN(len(periods))]
+			sub := domain.Subscription{
+				UserID:          userID,
+				ServiceName:     seedServices[i].name,
+				Price:           seedServices[i].price * months(period),
+				StartDate:       domain.ShortDate{Time: month.AddDate(0, -rnd.IntN(24), 0)},
+				BillingPeriod:   period,
+				BillingInterval: 1,
+			}
+			// Some subscriptions have been cancelled
+			if rnd.IntN(4) == 0 {
+				end := domain.ShortDate{Time: sub.StartDate.AddDate(0, rnd.IntN(12), 0)}
+				if end.After(month) {
+					end.Time = month
+				}
+				sub.EndDate = &end
+			}
+			if err := service.Create(ctx, &sub); err != nil {
+				return err
+			}
+		}
+		fmt.Println(userID)
+	}
+	return nil
+}
+
+// months returns the number of months in a billing period
+func months(period domain.BillingPeriod) int {
+	switch period {
+	case domain.BillingQuarterly:
+		return 3
+	case domain.BillingYearly:
+		return 12
+	}
+	return 1
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	_ "github.com/alexputin/subscriptions/docs"
+	"github.com/alexputin/subscriptions/internal/handlers"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	echoSwagger "github.com/swaggo/echo-swagger"
+)
+
+// runServe starts the HTTP server and blocks until ctx is done
+func runServe(ctx context.Context, env *env, args []string) error {
+	config, logger := env.config, env.logger
+
+	flags := newFlagSet("serve")
+	addr := flags.String("addr", config.ServerAddress, "address to listen on")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	logger.Info("Starting application")
+
+	// Create database connection
+	storage, err := openStorage(config)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := storage.Close(); err != nil {
+			logger.Error("failed to close database connection", zap.Error(err))
+		}
+	}()
+	logger.Info("Database connection established", zap.String("driver", config.DatabaseDriver))
+
+	if config.MigrateOnStartup {
+		migrator, err := newMigrator(storage.db, config.DatabaseDriver)
+		if err != nil {
+			return err
+		}
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		logger.Info("Migrations applied", zap.Int("count", applied))
+	}
+
+	service, err := newService(config, storage)
+	if err != nil {
+		return err
+	}
+	if config.ExchangeRatesFile != "" {
+		logger.Info("Exchange rates loaded", zap.String("file", config.ExchangeRatesFile))
+	}
+	logger.Info("Repository and service initialized")
+
+	app := echo.New()
+	app.HTTPErrorHandler = handlers.NewHTTPErrorHandler(logger)
+	app.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			latency := time.Since(start)
+			logger.Info("request completed",
+				zap.String("method", c.Request().Method),
+				zap.String("uri", c.Request().RequestURI),
+				zap.Int("status", c.Response().Status),
+				zap.Duration("latency", latency),
+				zap.String("remote_ip", c.RealIP()),
+			)
+			return err
+		}
+	})
+
+	app.Use(middleware.Recover())
+	app.Use(middleware.ContextTimeoutWithConfig(middleware.ContextTimeoutConfig{
+		Timeout: config.QueryTimeout,
+		// Timeouts are rendered by the HTTP error handler
+		ErrorHandler: func(err error, c echo.Context) error { return err },
+	}))
+
+	authenticator, err := newAuthenticator(config, storage)
+	if err != nil {
+		return err
+	}
+
+	// Register routes
+	api := handlers.NewSubscriptionsApiHandler(service, logger).
+		WithIdempotency(storage.idempotency, config.IdempotencyTTL).
+		WithUsers(newUserService(config, storage))
+	if authenticator != nil {
+		api.WithAuth(authenticator)
+	} else {
+		logger.Warn("Authentication is disabled, the API is anonymous")
+	}
+	api.RegisterRoutes(app)
+	app.GET("/swagger/*", echoSwagger.WrapHandler)
+	logger.Info("Routes registered")
+
+	// Remove expired idempotency keys
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := storage.idempotency.DeleteExpired(ctx, time.Now()); err != nil {
+				logger.Warn("failed to delete expired idempotency keys", zap.Error(err))
+			}
+		}
+	}()
+
+	// Server graceful shutdown
+	serverErr := make(chan error, 1)
+	go func() {
+		logger.Info("Starting HTTP server", zap.String("address", *addr))
+		if err := app.Start(*addr); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+	case err := <-serverErr:
+		return fmt.Errorf("shutting down the server: %w", err)
+	}
+	logger.Info("Shutting down server...", zap.Duration("timeout", config.ShutdownTimeout))
+
+	// In-flight requests get until the deadline to complete
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+
+	if err := app.Shutdown(shutdownCtx); err != nil {
+		logger.Error("Server forced to shutdown", zap.Error(err))
+		return nil
+	}
+	logger.Info("Server shutdown complete")
+	return nil
+}
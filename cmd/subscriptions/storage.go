@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/alexputin/subscriptions/internal/auth"
+	appconfig "github.com/alexputin/subscriptions/internal/config"
+	database "github.com/alexputin/subscriptions/internal/db"
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/rates"
+	"github.com/alexputin/subscriptions/internal/repositories"
+	"github.com/alexputin/subscriptions/internal/services"
+	"github.com/jmoiron/sqlx"
+)
+
+// storage is the database of the configured driver and the repositories on it
+type storage struct {
+	db          *sqlx.DB
+	repo        domain.UserSubscriptionRepository
+	users       domain.UserRepository
+	uow         domain.UnitOfWork
+	idempotency domain.IdempotencyStore
+	apiKeys     domain.APIKeyStore
+}
+
+func openStorage(config *appconfig.Config) (*storage, error) {
+	var (
+		db  *sqlx.DB
+		err error
+	)
+	switch config.DatabaseDriver {
+	case appconfig.DriverSQLite:
+		db, err = database.CreateSQLiteConnection(config.DatabasePath)
+	default:
+		db, err = database.CreatePostgresConnection(config.DatabaseURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &storage{
+		db:      db,
+		users:   repositories.NewSQLUserRepository(db),
+		apiKeys: repositories.NewSQLAPIKeyStore(db),
+	}
+	switch config.DatabaseDriver {
+	case appconfig.DriverSQLite:
+		s.repo = repositories.NewSQLiteUserSubscriptionRepository(db)
+		s.uow = repositories.NewSQLiteUnitOfWork(db)
+		s.idempotency = repositories.NewSQLiteIdempotencyStore(db)
+	default:
+		s.repo = repositories.NewPostgresUserSubscriptionRepository(db)
+		s.uow = repositories.NewPostgresUnitOfWork(db)
+		s.idempotency = repositories.NewPostgresIdempotencyStore(db)
+	}
+	return s, nil
+}
+
+func (s *storage) Close() error {
+	return s.db.Close()
+}
+
+// newService returns the subscription service on the storage
+func newService(config *appconfig.Config, s *storage) (domain.UserSubscriptionService, error) {
+	var rateProvider domain.RateProvider
+	if config.ExchangeRatesFile != "" {
+		provider, err := rates.LoadCSV(config.ExchangeRatesFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+		}
+		rateProvider = provider
+	}
+	return services.NewUserSubscriptionService(s.repo, s.uow, rateProvider, config.ReportingCurrency), nil
+}
+
+// newUserService returns the user service on the storage
+func newUserService(config *appconfig.Config, s *storage) domain.UserService {
+	return services.NewUserService(s.users, config.ReportingCurrency)
+}
+
+// ensureUser creates the user with the id unless it exists
+func ensureUser(ctx context.Context, users domain.UserService, id string) error {
+	err := users.Create(ctx, &domain.User{ID: id})
+	if errors.Is(err, domain.ErrConflict) {
+		return nil
+	}
+	return err
+}
+
+// newAuthenticator returns the authenticator of API requests, nil if
+// authentication is disabled
+func newAuthenticator(config *appconfig.Config, s *storage) (domain.Authenticator, error) {
+	if !config.AuthEnabled {
+		return nil, nil
+	}
+	authConfig, err := auth.LoadConfig(config.JWTSecret, config.JWTSecretFile, config.JWTPublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	authConfig.Issuer = config.JWTIssuer
+	authConfig.Audience = config.JWTAudience
+	var authenticator domain.Authenticator = auth.NewAuthenticator(authConfig, s.apiKeys)
+	if config.AuthTrustHeaders {
+		authenticator = auth.NewHeaderAuthenticator(authenticator)
+	}
+	return authenticator, nil
+}
@@ -0,0 +1,186 @@
+// Package auth authenticates API callers by JWT bearer tokens and API keys.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// leeway is the clock skew tolerated when checking token times
+const leeway = 30 * time.Second
+
+// Config holds the keys tokens are verified with. Tokens are accepted
+// signed with HS256 if Secret is set and with RS256 if PublicKey is set.
+type Config struct {
+	Secret    []byte
+	PublicKey *rsa.PublicKey
+	// Issuer and Audience are checked if set
+	Issuer   string
+	Audience string
+}
+
+// LoadConfig reads the HS256 secret, inline or from secretFile, and the PEM
+// encoded RS256 public key from publicKeyFile. Empty values are skipped, a
+// trailing newline of the secret file is ignored.
+func LoadConfig(secret, secretFile, publicKeyFile string) (Config, error) {
+	var cfg Config
+	if secret != "" {
+		cfg.Secret = []byte(secret)
+	}
+	if secretFile != "" {
+		data, err := os.ReadFile(secretFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read JWT secret: %w", err)
+		}
+		cfg.Secret = bytes.TrimRight(data, "\r\n")
+	}
+	if publicKeyFile != "" {
+		data, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to read JWT public key: %w", err)
+		}
+		cfg.PublicKey, err = jwt.ParseRSAPublicKeyFromPEM(data)
+		if err != nil {
+			return cfg, fmt.Errorf("failed to parse JWT public key: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// Authenticator verifies JWTs whose subject is the user ID, and API keys
+// looked up by hash in the store.
+type Authenticator struct {
+	config  Config
+	apiKeys domain.APIKeyStore
+	parser  *jwt.Parser
+}
+
+func NewAuthenticator(config Config, apiKeys domain.APIKeyStore) *Authenticator {
+	var methods []string
+	if len(config.Secret) > 0 {
+		methods = append(methods, jwt.SigningMethodHS256.Alg())
+	}
+	if config.PublicKey != nil {
+		methods = append(methods, jwt.SigningMethodRS256.Alg())
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
+	return &Authenticator{
+		config:  config,
+		apiKeys: apiKeys,
+		parser:  jwt.NewParser(options...),
+	}
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, creds domain.Credentials) (domain.Principal, error) {
+	switch {
+	case creds.APIKey != "":
+		return a.authenticateAPIKey(ctx, creds.APIKey)
+	case creds.Token != "":
+		return a.authenticateToken(creds.Token)
+	}
+	return domain.Principal{}, fmt.Errorf("%w: missing credentials", domain.ErrUnauthorized)
+}
+
+func (a *Authenticator) authenticateToken(token string) (domain.Principal, error) {
+	if len(a.config.Secret) == 0 && a.config.PublicKey == nil {
+		return domain.Principal{}, fmt.Errorf("%w: bearer tokens are not accepted", domain.ErrUnauthorized)
+	}
+
+	claims := &tokenClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, a.key)
+	if err != nil {
+		return domain.Principal{}, fmt.Errorf("%w: invalid token: %w", domain.ErrUnauthorized, err)
+	}
+	if uuid.Validate(claims.Subject) != nil {
+		return domain.Principal{}, fmt.Errorf("%w: token subject is not a user ID", domain.ErrUnauthorized)
+	}
+	role, err := parseRole(claims.Role)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	tenantID, err := parseTenant(claims.Tenant)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	return domain.Principal{UserID: claims.Subject, Role: role, TenantID: tenantID, Method: domain.AuthMethodJWT}, nil
+}
+
+// tokenClaims are the claims of tokens, the role defaults to owner and the
+// tenant to the default tenant
+type tokenClaims struct {
+	jwt.RegisteredClaims
+	Role   string `json:"role,omitempty"`
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// key returns the key verifying the token, the parser has checked its
+// signing method is accepted
+func (a *Authenticator) key(token *jwt.Token) (any, error) {
+	switch token.Method {
+	case jwt.SigningMethodHS256:
+		return a.config.Secret, nil
+	case jwt.SigningMethodRS256:
+		return a.config.PublicKey, nil
+	}
+	return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+}
+
+func (a *Authenticator) authenticateAPIKey(ctx context.Context, key string) (domain.Principal, error) {
+	if a.apiKeys == nil {
+		return domain.Principal{}, fmt.Errorf("%w: API keys are not accepted", domain.ErrUnauthorized)
+	}
+
+	apiKey, err := a.apiKeys.GetByHash(ctx, domain.HashAPIKey(key))
+	if errors.Is(err, domain.ErrNotFound) {
+		return domain.Principal{}, fmt.Errorf("%w: invalid API key", domain.ErrUnauthorized)
+	}
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	return domain.Principal{UserID: apiKey.UserID, Role: domain.RoleOwner, TenantID: apiKey.TenantID, Method: domain.AuthMethodAPIKey}, nil
+}
+
+// parseTenant returns the tenant named by a token or header, the default
+// tenant if none is
+func parseTenant(id string) (string, error) {
+	if id == "" {
+		return domain.DefaultTenant, nil
+	}
+	if !domain.ValidTenantID(id) {
+		return "", fmt.Errorf("%w: invalid tenant %q", domain.ErrUnauthorized, id)
+	}
+	return id, nil
+}
+
+// parseRole returns the role named by a token or header, owner if none is
+func parseRole(name string) (domain.Role, error) {
+	if name == "" {
+		return domain.RoleOwner, nil
+	}
+	role := domain.Role(name)
+	if !role.Valid() {
+		return "", fmt.Errorf("%w: unknown role %q", domain.ErrUnauthorized, name)
+	}
+	return role, nil
+}
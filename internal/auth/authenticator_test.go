@@ -0,0 +1,191 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/auth"
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const userID = "550e8400-e29b-41d4-a716-446655440000"
+
+// apiKeyStore finds the keys of a map by hash
+type apiKeyStore struct {
+	domain.APIKeyStore
+	keys map[string]domain.APIKey
+}
+
+func (s apiKeyStore) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	key, ok := s.keys[hash]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &key, nil
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func TestAuthenticator(t *testing.T) {
+	secret := []byte("test-secret")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	apiKey, hash := domain.NewAPIKey()
+	store := apiKeyStore{keys: map[string]domain.APIKey{hash: {ID: "key-1", TenantID: "acme", UserID: userID, Hash: hash}}}
+
+	a := auth.NewAuthenticator(auth.Config{Secret: secret, PublicKey: &rsaKey.PublicKey, Issuer: "issuer"}, store)
+
+	valid := jwt.RegisteredClaims{
+		Subject:   userID,
+		Issuer:    "issuer",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}
+	with := func(change func(*jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		claims := valid
+		change(&claims)
+		return claims
+	}
+
+	withRole := func(role, tenant string) string {
+		claims := struct {
+			jwt.RegisteredClaims
+			Role   string `json:"role,omitempty"`
+			Tenant string `json:"tenant,omitempty"`
+		}{valid, role, tenant}
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+		require.NoError(t, err)
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		creds  domain.Credentials
+		method string
+		role   domain.Role
+		tenant string
+		err    error
+	}{
+		{"HS256", domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, secret, valid)}, domain.AuthMethodJWT, domain.RoleOwner, domain.DefaultTenant, nil},
+		{"RS256", domain.Credentials{Token: sign(t, jwt.SigningMethodRS256, rsaKey, valid)}, domain.AuthMethodJWT, domain.RoleOwner, domain.DefaultTenant, nil},
+		{"role claim", domain.Credentials{Token: withRole("admin", "")}, domain.AuthMethodJWT, domain.RoleAdmin, domain.DefaultTenant, nil},
+		{"tenant claim", domain.Credentials{Token: withRole("", "acme")}, domain.AuthMethodJWT, domain.RoleOwner, "acme", nil},
+		{"API key", domain.Credentials{APIKey: apiKey}, domain.AuthMethodAPIKey, domain.RoleOwner, "acme", nil},
+		{"identity headers are not trusted", domain.Credentials{UserID: userID, Role: "admin"}, "", "", "", domain.ErrUnauthorized},
+		{"invalid tenant", domain.Credentials{Token: withRole("", "Acme Corp")}, "", "", "", domain.ErrUnauthorized},
+		{"unknown role", domain.Credentials{Token: withRole("root", "")}, "", "", "", domain.ErrUnauthorized},
+		{"no credentials", domain.Credentials{}, "", "", "", domain.ErrUnauthorized},
+		{"malformed token", domain.Credentials{Token: "not-a-token"}, "", "", "", domain.ErrUnauthorized},
+		{"wrong secret", domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, []byte("other"), valid)}, "", "", "", domain.ErrUnauthorized},
+		{"wrong RSA key", domain.Credentials{Token: sign(t, jwt.SigningMethodRS256, otherKey, valid)}, "", "", "", domain.ErrUnauthorized},
+		{"method not accepted", domain.Credentials{Token: sign(t, jwt.SigningMethodHS512, secret, valid)}, "", "", "", domain.ErrUnauthorized},
+		{"expired", domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+		}))}, "", "", "", domain.ErrUnauthorized},
+		{"no expiry", domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		}))}, "", "", "", domain.ErrUnauthorized},
+		{"wrong issuer", domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.Issuer = "other"
+		}))}, "", "", "", domain.ErrUnauthorized},
+		{"subject is not a user ID", domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.Subject = "admin"
+		}))}, "", "", "", domain.ErrUnauthorized},
+		{"unknown API key", domain.Credentials{APIKey: "sk_unknown"}, "", "", "", domain.ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := a.Authenticate(context.Background(), tt.creds)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, domain.Principal{UserID: userID, Role: tt.role, TenantID: tt.tenant, Method: tt.method}, principal)
+		})
+	}
+}
+
+func TestAuthenticator_OnlyConfiguredMethods(t *testing.T) {
+	secret := []byte("test-secret")
+	a := auth.NewAuthenticator(auth.Config{}, nil)
+
+	_, err := a.Authenticate(context.Background(), domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, secret, jwt.RegisteredClaims{
+		Subject:   userID,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})})
+	assert.ErrorIs(t, err, domain.ErrUnauthorized)
+
+	_, err = a.Authenticate(context.Background(), domain.Credentials{APIKey: "sk_key"})
+	assert.ErrorIs(t, err, domain.ErrUnauthorized)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	publicKeyFile := filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(publicKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+	secretFile := filepath.Join(dir, "secret")
+	require.NoError(t, os.WriteFile(secretFile, []byte("from-file\n"), 0o600))
+
+	cfg, err := auth.LoadConfig("inline", secretFile, publicKeyFile)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("from-file"), cfg.Secret)
+	assert.True(t, key.PublicKey.Equal(cfg.PublicKey))
+
+	_, err = auth.LoadConfig("", "", secretFile)
+	assert.Error(t, err)
+	_, err = auth.LoadConfig("", filepath.Join(dir, "missing"), "")
+	assert.Error(t, err)
+}
+
+func TestHeaderAuthenticator(t *testing.T) {
+	next := auth.NewAuthenticator(auth.Config{Secret: []byte("test-secret")}, nil)
+	a := auth.NewHeaderAuthenticator(next)
+
+	principal, err := a.Authenticate(context.Background(), domain.Credentials{UserID: userID, Role: "viewer", TenantID: "acme"})
+	require.NoError(t, err)
+	assert.Equal(t, domain.Principal{UserID: userID, Role: domain.RoleViewer, TenantID: "acme", Method: domain.AuthMethodHeader}, principal)
+
+	principal, err = a.Authenticate(context.Background(), domain.Credentials{UserID: userID})
+	require.NoError(t, err)
+	assert.Equal(t, domain.RoleOwner, principal.Role)
+	assert.Equal(t, domain.DefaultTenant, principal.TenantID)
+
+	_, err = a.Authenticate(context.Background(), domain.Credentials{UserID: "admin", Role: "admin"})
+	assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	_, err = a.Authenticate(context.Background(), domain.Credentials{UserID: userID, Role: "root"})
+	assert.ErrorIs(t, err, domain.ErrUnauthorized)
+	_, err = a.Authenticate(context.Background(), domain.Credentials{UserID: userID, TenantID: "../other"})
+	assert.ErrorIs(t, err, domain.ErrUnauthorized)
+
+	principal, err = a.Authenticate(context.Background(), domain.Credentials{Token: sign(t, jwt.SigningMethodHS256, []byte("test-secret"), jwt.RegisteredClaims{
+		Subject:   userID,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})})
+	require.NoError(t, err)
+	assert.Equal(t, domain.AuthMethodJWT, principal.Method)
+
+	_, err = auth.NewHeaderAuthenticator(nil).Authenticate(context.Background(), domain.Credentials{})
+	assert.ErrorIs(t, err, domain.ErrUnauthorized)
+}
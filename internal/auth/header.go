@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/google/uuid"
+)
+
+// HeaderAuthenticator trusts the identity headers of a proxy in front of the
+// service that has authenticated the caller. Requests without them are
+// resolved by the next authenticator, if any.
+type HeaderAuthenticator struct {
+	next domain.Authenticator
+}
+
+func NewHeaderAuthenticator(next domain.Authenticator) *HeaderAuthenticator {
+	return &HeaderAuthenticator{next: next}
+}
+
+func (a *HeaderAuthenticator) Authenticate(ctx context.Context, creds domain.Credentials) (domain.Principal, error) {
+	if creds.UserID == "" {
+		if a.next == nil {
+			return domain.Principal{}, fmt.Errorf("%w: missing identity headers", domain.ErrUnauthorized)
+		}
+		return a.next.Authenticate(ctx, creds)
+	}
+
+	if uuid.Validate(creds.UserID) != nil {
+		return domain.Principal{}, fmt.Errorf("%w: identity header is not a user ID", domain.ErrUnauthorized)
+	}
+	role, err := parseRole(creds.Role)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	tenantID, err := parseTenant(creds.TenantID)
+	if err != nil {
+		return domain.Principal{}, err
+	}
+	return domain.Principal{UserID: creds.UserID, Role: role, TenantID: tenantID, Method: domain.AuthMethodHeader}, nil
+}
@@ -5,19 +5,46 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
 type Config struct {
+	DatabaseDriver   string // DriverPostgres or DriverSQLite
+	DatabasePath     string // SQLite database file
 	DatabaseUser     string
 	DatabasePassword string
 	DatabaseName     string
 	DatabaseHost     string
 	DatabasePort     int
 	DatabaseURL      string
+	MigrateOnStartup bool   // apply pending migrations before serving
 	Environment      string // e.g., "dev", "prod"
 	ServerAddress    string
+
+	ReportingCurrency string // ISO-4217 code of new subscriptions and cost reports
+	ExchangeRatesFile string // ECB-style CSV with exchange rates, optional
+
+	IdempotencyTTL time.Duration // how long responses to Idempotency-Key requests are replayed
+
+	QueryTimeout    time.Duration // deadline of the queries of a request
+	ShutdownTimeout time.Duration // how long shutdown waits for in-flight requests
+
+	AuthEnabled      bool   // require API requests to be authenticated
+	JWTSecret        string // HS256 secret, inline or in JWTSecretFile
+	JWTSecretFile    string
+	JWTPublicKeyFile string // PEM encoded RS256 public key
+	JWTIssuer        string // expected iss claim, optional
+	JWTAudience      string // expected aud claim, optional
+	// AuthTrustHeaders accepts the X-User-ID and X-User-Role headers of a
+	// proxy authenticating callers in front of the service
+	AuthTrustHeaders bool
 }
 
 var config *Config
@@ -28,27 +55,57 @@ func MustLoadConfig() {
 		log.Default().Println("Error loading .env file")
 	}
 
+	config = &Config{
+		DatabaseDriver:   GetEnv("DB_DRIVER", DriverPostgres),
+		MigrateOnStartup: MustGetBoolEnv("MIGRATE_ON_STARTUP", "false"),
+		Environment:      MustGetEnv("ENVIRONMENT"),
+		ServerAddress:    MustGetEnv("SERVER_ADDRESS"),
+
+		ReportingCurrency: GetEnv("REPORTING_CURRENCY", "RUB"),
+		ExchangeRatesFile: GetEnv("EXCHANGE_RATES_FILE", ""),
+
+		IdempotencyTTL: MustGetDurationEnv("IDEMPOTENCY_TTL", "24h"),
+
+		QueryTimeout:    MustGetDurationEnv("QUERY_TIMEOUT", "5s"),
+		ShutdownTimeout: MustGetDurationEnv("SHUTDOWN_TIMEOUT", "10s"),
+
+		AuthEnabled:      MustGetBoolEnv("AUTH_ENABLED", "true"),
+		JWTSecret:        GetEnv("JWT_SECRET", ""),
+		JWTSecretFile:    GetEnv("JWT_SECRET_FILE", ""),
+		JWTPublicKeyFile: GetEnv("JWT_PUBLIC_KEY_FILE", ""),
+		JWTIssuer:        GetEnv("JWT_ISSUER", ""),
+		JWTAudience:      GetEnv("JWT_AUDIENCE", ""),
+		AuthTrustHeaders: MustGetBoolEnv("AUTH_TRUST_HEADERS", "false"),
+	}
+
+	switch config.DatabaseDriver {
+	case DriverPostgres:
+		loadPostgresConfig(config)
+	case DriverSQLite:
+		config.DatabasePath = GetEnv("DB_PATH", "subscriptions.db")
+	default:
+		panic(fmt.Sprintf("DB_DRIVER value is not supported: %s", config.DatabaseDriver))
+	}
+}
+
+func loadPostgresConfig(config *Config) {
 	dbPort, err := strconv.Atoi(MustGetEnv("DB_PORT"))
 	if err != nil {
 		panic(fmt.Sprintf("DB_PORT value is not integer: %s", MustGetEnv("DB_PORT")))
 	}
 
-	config = &Config{
-		DatabaseUser:     MustGetEnv("DB_USER"),
-		DatabasePassword: MustGetEnv("DB_PASSWORD"),
-		DatabaseName:     MustGetEnv("DB_NAME"),
-		DatabaseHost:     MustGetEnv("DB_HOSTNAME"),
-		DatabasePort:     dbPort,
-		DatabaseURL: fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable",
-			MustGetEnv("DB_USER"),
-			MustGetEnv("DB_PASSWORD"),
-			MustGetEnv("DB_HOSTNAME"),
-			MustGetEnv("DB_PORT"),
-			MustGetEnv("DB_NAME"),
-		),
-		Environment:   MustGetEnv("ENVIRONMENT"),
-		ServerAddress: MustGetEnv("SERVER_ADDRESS"),
-	}
+	config.DatabaseUser = MustGetEnv("DB_USER")
+	config.DatabasePassword = MustGetEnv("DB_PASSWORD")
+	config.DatabaseName = MustGetEnv("DB_NAME")
+	config.DatabaseHost = MustGetEnv("DB_HOSTNAME")
+	config.DatabasePort = dbPort
+	config.DatabaseURL = fmt.Sprintf("postgresql://%s:%s@%s:%s/%s?sslmode=disable",
+		MustGetEnv("DB_USER"),
+		MustGetEnv("DB_PASSWORD"),
+		MustGetEnv("DB_HOSTNAME"),
+		MustGetEnv("DB_PORT"),
+		MustGetEnv("DB_NAME"),
+	)
 }
 
 func Get() *Config {
@@ -65,3 +122,30 @@ func MustGetEnv(key string) string {
 	}
 	panic(fmt.Sprintf("Environment variable %s is not set or empty", key))
 }
+
+func GetEnv(key, defaultValue string) string {
+	if value, exists := os.LookupEnv(key); exists && value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// MustGetDurationEnv parses a duration like "5s" from the environment
+func MustGetDurationEnv(key, defaultValue string) time.Duration {
+	value := GetEnv(key, defaultValue)
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		panic(fmt.Sprintf("%s value is not a positive duration: %s", key, value))
+	}
+	return d
+}
+
+// MustGetBoolEnv parses a boolean like "true" or "1" from the environment
+func MustGetBoolEnv(key, defaultValue string) bool {
+	value := GetEnv(key, defaultValue)
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		panic(fmt.Sprintf("%s value is not a boolean: %s", key, value))
+	}
+	return b
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// migrationLockID is the key of the PostgreSQL advisory lock held while
+// migrating, so replicas starting together apply migrations once.
+const migrationLockID = 7_201_449_613
+
+// ErrDirtyDatabase is returned when a migration failed half-way without a
+// transaction, e.g. when it was applied by the migrate CLI. The schema has
+// to be fixed by hand and the version forced with the CLI.
+var ErrDirtyDatabase = errors.New("database is dirty")
+
+var migrationFile = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change with the SQL applying and reverting
+// it.
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus is a migration and whether it is applied to the database.
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Migrator applies migrations in the golang-migrate file format. It keeps
+// the schema_migrations table of the migrate CLI, so either can be used on
+// a database.
+type Migrator struct {
+	db         *sqlx.DB
+	migrations []Migration
+}
+
+// NewMigrator reads the migrations in the root of fsys.
+func NewMigrator(db *sqlx.DB, fsys fs.FS) (*Migrator, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// Up applies the pending migrations and returns how many were applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	current, err := m.version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, migration := range m.migrations {
+		if migration.Version <= current {
+			continue
+		}
+		if err := m.apply(ctx, conn, migration.Up, migration.Version); err != nil {
+			return applied, fmt.Errorf("failed to apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// Down reverts the latest steps applied migrations and returns how many
+// were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	conn, unlock, err := m.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	current, err := m.version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	reverted := 0
+	for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current {
+			continue
+		}
+		var previous uint64
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		if err := m.apply(ctx, conn, migration.Down, previous); err != nil {
+			return reverted, fmt.Errorf("failed to revert migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		reverted++
+	}
+	return reverted, nil
+}
+
+// Status returns the migrations and whether they are applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := createVersionTable(ctx, m.db); err != nil {
+		return nil, err
+	}
+	current, err := m.version(ctx, m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Migration: migration, Applied: migration.Version <= current}
+	}
+	return statuses, nil
+}
+
+// lock returns a connection holding the migration lock and a function
+// releasing both. SQLite needs no lock, its single connection already
+// serializes migrations.
+func (m *Migrator) lock(ctx context.Context) (*sqlx.Conn, func(), error) {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get migration connection: %w", err)
+	}
+	unlock := func() { conn.Close() }
+
+	if m.db.DriverName() == "postgres" {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+			conn.Close()
+			return nil, nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		unlock = func() {
+			// The lock is released with the session if this fails
+			conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+			conn.Close()
+		}
+	}
+
+	if err := createVersionTable(ctx, conn); err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return conn, unlock, nil
+}
+
+// apply runs the SQL of a migration and sets the schema version in one
+// transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sqlx.Conn, query string, version uint64) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return err
+	}
+	if version > 0 {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)`, version, false); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// version returns the version of the applied schema, 0 if none is applied.
+func (m *Migrator) version(ctx context.Context, q sqlx.QueryerContext) (uint64, error) {
+	var row struct {
+		Version uint64 `db:"version"`
+		Dirty   bool   `db:"dirty"`
+	}
+	err := sqlx.GetContext(ctx, q, &row, `SELECT version, dirty FROM schema_migrations LIMIT 1`)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+	if row.Dirty {
+		return 0, fmt.Errorf("%w at version %d", ErrDirtyDatabase, row.Version)
+	}
+	return row.Version, nil
+}
+
+// createVersionTable creates the version table of the migrate CLI.
+func createVersionTable(ctx context.Context, e sqlx.ExecerContext) error {
+	_, err := e.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
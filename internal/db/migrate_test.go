@@ -0,0 +1,96 @@
+package db_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/alexputin/subscriptions/internal/db"
+	"github.com/alexputin/subscriptions/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrator(t *testing.T) {
+	ctx := context.Background()
+	conn, err := db.CreateSQLiteConnection(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	migrator, err := db.NewMigrator(conn, fstest.MapFS{
+		"000001_create_a.up.sql":   {Data: []byte(`CREATE TABLE a (id INTEGER);`)},
+		"000001_create_a.down.sql": {Data: []byte(`DROP TABLE a;`)},
+		"000002_create_b.up.sql":   {Data: []byte(`CREATE TABLE b (id INTEGER);`)},
+		"000002_create_b.down.sql": {Data: []byte(`DROP TABLE b;`)},
+		"README.md":                {Data: []byte(`not a migration`)},
+	})
+	require.NoError(t, err)
+
+	applied, err := migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, applied)
+
+	applied, err = migrator.Up(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, applied)
+
+	reverted, err := migrator.Down(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reverted)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.Equal(t, "create_a", statuses[0].Name)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+
+	_, err = conn.Exec(`INSERT INTO b VALUES (1)`)
+	assert.Error(t, err, "table b is dropped")
+
+	reverted, err = migrator.Down(ctx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, reverted)
+
+	var versions int
+	require.NoError(t, conn.Get(&versions, `SELECT count(*) FROM schema_migrations`))
+	assert.Zero(t, versions)
+}
+
+func TestMigrator_FailedMigrationIsRolledBack(t *testing.T) {
+	ctx := context.Background()
+	conn, err := db.CreateSQLiteConnection(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	migrator, err := db.NewMigrator(conn, fstest.MapFS{
+		"000001_create_a.up.sql": {Data: []byte(`CREATE TABLE a (id INTEGER);`)},
+		"000002_broken.up.sql":   {Data: []byte(`CREATE TABLE b (id INTEGER); INSERT INTO missing VALUES (1);`)},
+	})
+	require.NoError(t, err)
+
+	applied, err := migrator.Up(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 1, applied)
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	assert.True(t, statuses[0].Applied)
+	assert.False(t, statuses[1].Applied)
+
+	_, err = conn.Exec(`INSERT INTO b VALUES (1)`)
+	assert.Error(t, err, "table b is rolled back")
+}
+
+func TestMigrator_EmbeddedSQLite(t *testing.T) {
+	conn, err := db.CreateSQLiteConnection(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer conn.Close()
+
+	migrator, err := db.NewMigrator(conn, migrations.SQLite)
+	require.NoError(t, err)
+	applied, err := migrator.Up(context.Background())
+	require.NoError(t, err)
+	assert.Positive(t, applied)
+}
@@ -0,0 +1,30 @@
+package db
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite" // SQLite driver
+)
+
+// CreateSQLiteConnection opens the SQLite database file at path, creating it
+// if it does not exist.
+func CreateSQLiteConnection(path string) (*sqlx.DB, error) {
+	params := url.Values{}
+	params.Add("_pragma", "foreign_keys(1)")
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Add("_pragma", "journal_mode(WAL)")
+	// Dates are compared as text, so they are stored in a single format
+	params.Set("_time_format", "sqlite")
+
+	db, err := sqlx.Connect("sqlite", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	// SQLite allows a single writer, sharing one connection serializes
+	// transactions instead of failing them as busy.
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
@@ -0,0 +1,123 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+)
+
+// Authentication methods of a Principal.
+const (
+	AuthMethodJWT    = "jwt"
+	AuthMethodAPIKey = "api_key"
+	// AuthMethodHeader is an identity asserted by a trusted proxy.
+	AuthMethodHeader = "header"
+)
+
+// Role is what a caller may do with the subscriptions of the user it acts for.
+type Role string
+
+const (
+	// RoleOwner manages the subscriptions of its own user.
+	RoleOwner Role = "owner"
+	// RoleViewer reads the subscriptions of an account shared with it.
+	RoleViewer Role = "viewer"
+	// RoleAdmin manages and reports on the subscriptions of all users.
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleOwner, RoleViewer, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// Principal is the authenticated caller of the API.
+type Principal struct {
+	// UserID is the user the caller acts for, the shared account of viewers.
+	UserID string
+	Role   Role
+	// TenantID is the tenant the caller belongs to.
+	TenantID string
+	// Method is how the caller authenticated, AuthMethodJWT,
+	// AuthMethodAPIKey or AuthMethodHeader.
+	Method string
+}
+
+// Credentials are the credentials sent with a request.
+type Credentials struct {
+	// Token is a bearer JWT.
+	Token  string
+	APIKey string
+	// UserID, Role and TenantID are the identity headers set by a proxy in
+	// front of the service, they are only trusted if it is configured so.
+	UserID   string
+	Role     string
+	TenantID string
+}
+
+// Authenticator resolves the identity of a caller from its credentials.
+// Missing or invalid credentials are ErrUnauthorized.
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds Credentials) (Principal, error)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the authenticated caller, if the request was
+// authenticated.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to find.
+const APIKeyPrefix = "sk_"
+
+// APIKey is a long-lived credential of a user. Only the hash of the key is
+// stored, the key itself is shown once when it is created.
+type APIKey struct {
+	ID        string     `db:"id"`
+	TenantID  string     `db:"tenant_id"`
+	UserID    string     `db:"user_id"`
+	Name      string     `db:"name"`
+	Hash      string     `db:"key_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
+
+// APIKeyStore stores API keys by hash.
+type APIKeyStore interface {
+	Create(ctx context.Context, key *APIKey) error
+	// GetByHash returns the key with the hash unless it is revoked, whatever
+	// its tenant. The other methods only see keys of the tenant of the
+	// context.
+	GetByHash(ctx context.Context, hash string) (*APIKey, error)
+	ListByUser(ctx context.Context, userID string) ([]APIKey, error)
+	Revoke(ctx context.Context, id string) error
+}
+
+// NewAPIKey generates a random API key and returns it with its hash.
+func NewAPIKey() (key, hash string) {
+	b := make([]byte, 32)
+	rand.Read(b)
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, HashAPIKey(key)
+}
+
+// HashAPIKey returns the hash keys are stored and looked up by. Keys are
+// random, so a fast hash does not make them easier to guess.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
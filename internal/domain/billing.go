@@ -0,0 +1,112 @@
+package domain
+
+import "time"
+
+// BillingPeriod is the unit of a subscription billing cycle.
+type BillingPeriod string
+
+const (
+	BillingWeekly    BillingPeriod = "weekly"
+	BillingMonthly   BillingPeriod = "monthly"
+	BillingQuarterly BillingPeriod = "quarterly"
+	BillingYearly    BillingPeriod = "yearly"
+)
+
+// Valid reports whether p is one of the supported billing periods.
+func (p BillingPeriod) Valid() bool {
+	switch p {
+	case BillingWeekly, BillingMonthly, BillingQuarterly, BillingYearly:
+		return true
+	}
+	return false
+}
+
+// months returns the length of the period in months, or 0 for weekly billing.
+func (p BillingPeriod) months() int {
+	switch p {
+	case BillingQuarterly:
+		return 3
+	case BillingYearly:
+		return 12
+	case BillingWeekly:
+		return 0
+	}
+	return 1
+}
+
+// CostMode defines how the price of a billing cycle is attributed to months.
+type CostMode string
+
+const (
+	// CostModeCash charges the full price in the month a billing cycle starts.
+	CostModeCash CostMode = "cash"
+	// CostModeAmortized spreads the price evenly over the billing cycle.
+	CostModeAmortized CostMode = "amortized"
+)
+
+// Valid reports whether m is one of the supported cost modes.
+func (m CostMode) Valid() bool {
+	return m == CostModeCash || m == CostModeAmortized
+}
+
+// CostInMonth returns the amount attributed to the month containing m. The
+// price of a billing cycle is the one effective in the month the cycle starts.
+func (s Subscription) CostInMonth(m time.Time, mode CostMode) Money {
+	cost, _ := s.cycleCost(m, mode)
+	return cost
+}
+
+// cycleCost returns the amount attributed to the month containing m and the
+// price of the billing cycle it comes from.
+func (s Subscription) cycleCost(m time.Time, mode CostMode) (Money, Money) {
+	if s.BilledMonths(m, m) == 0 {
+		return Money{Currency: s.Currency}, Money{Currency: s.Currency}
+	}
+
+	period, interval := s.billing()
+	if months := period.months(); months > 0 {
+		cycle := months * interval
+		k := (monthIndex(m) - monthIndex(s.StartDate.Time)) % cycle
+		price := s.PriceAt(firstOfMonth(m).AddDate(0, -k, 0))
+		cost := price
+		if mode == CostModeAmortized {
+			// Spread the price so that every full cycle adds up to it exactly.
+			cost.Amount = price.Amount*(k+1)/cycle - price.Amount*k/cycle
+		} else if k != 0 {
+			cost.Amount = 0
+		}
+		return cost, price
+	}
+
+	cycleDays := 7 * interval
+	start := firstOfMonth(s.StartDate.Time)
+	monthStart := firstOfMonth(m)
+	before := daysBetween(start, monthStart)
+	after := daysBetween(start, monthStart.AddDate(0, 1, 0))
+	price := s.PriceAt(m)
+	cost := price
+	if mode == CostModeAmortized {
+		cost.Amount = price.Amount*after/cycleDays - price.Amount*before/cycleDays
+		return cost, price
+	}
+	// Charges happen every cycleDays starting with day 0, count those in [before, after).
+	charges := (after+cycleDays-1)/cycleDays - (before+cycleDays-1)/cycleDays
+	cost.Amount *= charges
+	return cost, price
+}
+
+// billing returns the billing period and interval with defaults applied.
+func (s Subscription) billing() (BillingPeriod, int) {
+	period, interval := s.BillingPeriod, s.BillingInterval
+	if !period.Valid() {
+		period = BillingMonthly
+	}
+	if interval < 1 {
+		interval = 1
+	}
+	return period, interval
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
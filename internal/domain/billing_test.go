@@ -0,0 +1,57 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscription_CostInMonth(t *testing.T) {
+	yearly := domain.Subscription{Price: 6000, StartDate: domain.ShortDate{Time: month("03-2025")}, BillingPeriod: domain.BillingYearly, BillingInterval: 1}
+	quarterly := domain.Subscription{Price: 1000, StartDate: domain.ShortDate{Time: month("01-2025")}, BillingPeriod: domain.BillingQuarterly, BillingInterval: 1}
+	weekly := domain.Subscription{Price: 100, StartDate: domain.ShortDate{Time: month("01-2025")}, BillingPeriod: domain.BillingWeekly, BillingInterval: 1}
+	legacy := domain.Subscription{Price: 500, StartDate: domain.ShortDate{Time: month("01-2025")}}
+
+	tests := []struct {
+		name  string
+		sub   domain.Subscription
+		month string
+		mode  domain.CostMode
+		want  int
+	}{
+		{"yearly cash billing month", yearly, "03-2025", domain.CostModeCash, 6000},
+		{"yearly cash other month", yearly, "04-2025", domain.CostModeCash, 0},
+		{"yearly cash next cycle", yearly, "03-2026", domain.CostModeCash, 6000},
+		{"yearly amortized", yearly, "08-2025", domain.CostModeAmortized, 500},
+		{"yearly before start", yearly, "02-2025", domain.CostModeAmortized, 0},
+		{"quarterly cash", quarterly, "04-2025", domain.CostModeCash, 1000},
+		{"quarterly cash off cycle", quarterly, "05-2025", domain.CostModeCash, 0},
+		{"quarterly amortized first", quarterly, "01-2025", domain.CostModeAmortized, 333},
+		{"quarterly amortized last", quarterly, "03-2025", domain.CostModeAmortized, 334},
+		{"weekly cash", weekly, "01-2025", domain.CostModeCash, 500},
+		{"weekly cash next month", weekly, "02-2025", domain.CostModeCash, 400},
+		{"weekly amortized", weekly, "01-2025", domain.CostModeAmortized, 442},
+		{"weekly amortized next month", weekly, "02-2025", domain.CostModeAmortized, 400},
+		{"no billing period is monthly", legacy, "06-2025", domain.CostModeCash, 500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.sub.CostInMonth(month(tt.month), tt.mode).Amount)
+		})
+	}
+}
+
+func TestSubscription_CostInMonth_AmortizedMatchesCash(t *testing.T) {
+	sub := domain.Subscription{Price: 6000, StartDate: domain.ShortDate{Time: month("03-2025")}, BillingPeriod: domain.BillingMonthly, BillingInterval: 7}
+
+	// Over a whole number of cycles both modes must add up to the same amount.
+	cash, amortized := 0, 0
+	for m := month("03-2025"); !m.After(month("04-2026")); m = m.AddDate(0, 1, 0) {
+		cash += sub.CostInMonth(m, domain.CostModeCash).Amount
+		amortized += sub.CostInMonth(m, domain.CostModeAmortized).Amount
+	}
+	assert.Equal(t, 12000, cash)
+	assert.Equal(t, cash, amortized)
+}
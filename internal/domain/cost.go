@@ -0,0 +1,68 @@
+package domain
+
+import (
+	"sort"
+	"time"
+)
+
+// ServiceCost is the amount spent on a single service.
+type ServiceCost struct {
+	ServiceName string
+	Total       int
+}
+
+// MonthlyCost is the amount spent in a single month, split by service.
+type MonthlyCost struct {
+	Month    ShortDate
+	Currency string
+	Total    int
+	Services []ServiceCost
+}
+
+// MonthlyBreakdown splits the cost of subs over every month of the [from, to]
+// window, converted to the reporting currency of conv. Only the shares of the
+// user are counted unless userID is empty. Months without any spend are
+// included with a zero total, services are ordered by name.
+func MonthlyBreakdown(subs []Subscription, userID string, from, to time.Time, mode CostMode, conv Converter) ([]MonthlyCost, error) {
+	var res []MonthlyCost
+	for m := firstOfMonth(from); !m.After(to); m = m.AddDate(0, 1, 0) {
+		byService := make(map[string]int)
+		for _, sub := range subs {
+			price := sub.ShareInMonth(m, mode, userID)
+			cost, err := conv.Convert(price.Amount, price.Currency, m)
+			if err != nil {
+				return nil, err
+			}
+			if cost != 0 {
+				byService[sub.ServiceName] += cost
+			}
+		}
+
+		month := MonthlyCost{Month: ShortDate{Time: m}, Currency: conv.Currency, Services: make([]ServiceCost, 0, len(byService))}
+		for name, total := range byService {
+			month.Total += total
+			month.Services = append(month.Services, ServiceCost{ServiceName: name, Total: total})
+		}
+		sort.Slice(month.Services, func(i, j int) bool {
+			return month.Services[i].ServiceName < month.Services[j].ServiceName
+		})
+		res = append(res, month)
+	}
+	return res, nil
+}
+
+// EarliestStart returns the first month any of subs started in, or zero time
+// if subs is empty.
+func EarliestStart(subs []Subscription) time.Time {
+	var earliest time.Time
+	for _, sub := range subs {
+		if earliest.IsZero() || sub.StartDate.Before(earliest) {
+			earliest = sub.StartDate.Time
+		}
+	}
+	return earliest
+}
+
+func firstOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,39 @@
+package domain
+
+import "time"
+
+// CostFilter narrows down the subscriptions taken into account by cost
+// calculations. Zero values mean "no restriction": an empty UserID aggregates
+// across all users and empty ServiceNames across all services.
+type CostFilter struct {
+	UserID       string
+	ServiceNames []string
+	// From is the first month of the period. Zero means the period starts with
+	// the earliest subscription.
+	From time.Time
+	// To is the last month of the period, inclusive. Zero means the current month.
+	To time.Time
+	// Mode defines how billing cycles longer than a month are attributed to
+	// months. Zero means CostModeCash.
+	Mode CostMode
+	// Currency is the ISO-4217 reporting currency amounts are converted to.
+	// Zero means the service default.
+	Currency string
+}
+
+// Period returns the [from, to] window of the filter with defaults applied.
+func (f CostFilter) Period() (time.Time, time.Time) {
+	to := f.To
+	if to.IsZero() {
+		to = CurrentMonth()
+	}
+	return f.From, to
+}
+
+// CostMode returns the cost mode of the filter with defaults applied.
+func (f CostFilter) CostMode() CostMode {
+	if f.Mode == "" {
+		return CostModeCash
+	}
+	return f.Mode
+}
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrRateNotFound is returned when there is no exchange rate between two
+// currencies. It is a validation error since the currency is chosen by the caller.
+var ErrRateNotFound = fmt.Errorf("%w: exchange rate not found", ErrValidation)
+
+// RateProvider is a source of exchange rates.
+type RateProvider interface {
+	// Rate returns how many units of currency `to` one unit of currency
+	// `from` is worth at the given time.
+	Rate(from, to string, at time.Time) (float64, error)
+}
+
+// Money is an amount in minor units of an ISO-4217 currency.
+type Money struct {
+	Amount   int
+	Currency string
+}
+
+// Converter converts amounts to a single reporting currency.
+type Converter struct {
+	Rates    RateProvider
+	Currency string
+}
+
+// Convert converts an amount in minor units of currency `from` to minor units
+// of the reporting currency using the rate effective at the given time. An
+// empty `from` currency is assumed to be the reporting currency.
+func (c Converter) Convert(amount int, from string, at time.Time) (int, error) {
+	if amount == 0 || from == "" || from == c.Currency {
+		return amount, nil
+	}
+	if c.Rates == nil {
+		return 0, fmt.Errorf("%w: %s to %s", ErrRateNotFound, from, c.Currency)
+	}
+
+	rate, err := c.Rates.Rate(from, c.Currency, at)
+	if err != nil {
+		return 0, err
+	}
+	scale := math.Pow10(CurrencyExponent(c.Currency) - CurrencyExponent(from))
+	return int(math.Round(float64(amount) * rate * scale)), nil
+}
+
+// CurrencyExponent returns the number of minor unit digits of an ISO-4217
+// currency, e.g. 2 for cents of USD.
+func CurrencyExponent(code string) int {
+	switch code {
+	case "BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "PYG",
+		"RWF", "UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF":
+		return 0
+	case "BHD", "IQD", "JOD", "KWD", "LYD", "OMR", "TND":
+		return 3
+	}
+	return 2
+}
@@ -0,0 +1,22 @@
+package domain
+
+import "errors"
+
+// Sentinel errors shared by all layers. Implementations wrap them with
+// details, callers check them with errors.Is.
+var (
+	// ErrNotFound means the requested entity does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict means the operation conflicts with the current state, e.g.
+	// the entity already exists.
+	ErrConflict = errors.New("conflict")
+	// ErrValidation means the input is invalid.
+	ErrValidation = errors.New("validation failed")
+	// ErrVersionMismatch means the entity was changed since the version the
+	// caller expects.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrUnauthorized means the caller is not authenticated.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden means the caller may not perform the operation.
+	ErrForbidden = errors.New("forbidden")
+)
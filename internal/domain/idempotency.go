@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrIdempotencyKeyReused means an idempotency key was sent again with a
+// different request.
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with a different request")
+
+// ErrIdempotentRequestInProgress means a request was retried while the first
+// request with its idempotency key was still being served.
+var ErrIdempotentRequestInProgress = fmt.Errorf("%w: request with the idempotency key is in progress", ErrConflict)
+
+// IdempotencyRecord is the stored response of a request sent with an
+// idempotency key, replayed when the request is retried. A record without a
+// status code reserves the key while the first request is served.
+type IdempotencyRecord struct {
+	Key string
+	// RequestHash identifies the request the key was first used with.
+	RequestHash string
+	StatusCode  int
+	Header      map[string]string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Pending reports whether the record only reserves the key.
+func (r IdempotencyRecord) Pending() bool {
+	return r.StatusCode == 0
+}
+
+type IdempotencyStore interface {
+	// Get returns the unexpired record of the key, or ErrNotFound.
+	Get(ctx context.Context, key string) (*IdempotencyRecord, error)
+	// Save stores the record, or fails with ErrConflict if an unexpired
+	// record of the key already exists. Saving a pending record reserves the
+	// key.
+	Save(ctx context.Context, record IdempotencyRecord) error
+	// Complete replaces the pending record of the key with the response, or
+	// fails with ErrNotFound if the key is not reserved.
+	Complete(ctx context.Context, record IdempotencyRecord) error
+	// Release deletes the pending record of the key, so the request can be
+	// retried.
+	Release(ctx context.Context, key string) error
+	// DeleteExpired removes records expired before the time.
+	DeleteExpired(ctx context.Context, before time.Time) error
+}
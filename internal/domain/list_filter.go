@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SortField is a field subscriptions can be listed by. Subscriptions with
+// equal values are ordered by ID.
+type SortField string
+
+const (
+	SortByServiceName SortField = "service_name"
+	SortByPrice       SortField = "price"
+	SortByStartDate   SortField = "start_date"
+)
+
+func (f SortField) Valid() bool {
+	switch f {
+	case SortByServiceName, SortByPrice, SortByStartDate:
+		return true
+	}
+	return false
+}
+
+// SubscriptionStatus is the state of a subscription in the current month.
+type SubscriptionStatus string
+
+const (
+	// StatusActive subscriptions have started and not ended.
+	StatusActive SubscriptionStatus = "active"
+	// StatusEnded subscriptions ended before the current month.
+	StatusEnded SubscriptionStatus = "ended"
+	// StatusUpcoming subscriptions start after the current month.
+	StatusUpcoming SubscriptionStatus = "upcoming"
+)
+
+func (s SubscriptionStatus) Valid() bool {
+	switch s {
+	case StatusActive, StatusEnded, StatusUpcoming:
+		return true
+	}
+	return false
+}
+
+// ListSort orders listed subscriptions.
+type ListSort struct {
+	Field SortField
+	Desc  bool
+}
+
+// ParseListSort parses a sort field, descending if prefixed with "-". Empty
+// means ascending by service name.
+func ParseListSort(s string) (ListSort, error) {
+	sort := ListSort{Field: SortByServiceName}
+	if s == "" {
+		return sort, nil
+	}
+	sort.Field = SortField(strings.TrimPrefix(s, "-"))
+	sort.Desc = strings.HasPrefix(s, "-")
+	if !sort.Field.Valid() {
+		return sort, fmt.Errorf("%w: invalid sort %q, expected service_name, price or start_date", ErrValidation, s)
+	}
+	return sort, nil
+}
+
+// ListFilter narrows down and pages listed subscriptions. Zero values mean
+// "no restriction".
+type ListFilter struct {
+	UserID string
+	// ActiveAt keeps subscriptions active in the month.
+	ActiveAt          time.Time
+	MinPrice          *int
+	MaxPrice          *int
+	ServiceNamePrefix string
+	Status            SubscriptionStatus
+
+	Sort ListSort
+	// Limit is the maximum number of subscriptions on a page.
+	Limit int
+	// After continues the listing after the cursor, Offset skips
+	// subscriptions instead. Cursors are preferred as they are stable and do
+	// not slow down on deep pages.
+	After  *Cursor
+	Offset int
+}
+
+// SubscriptionPage is a page of listed subscriptions.
+type SubscriptionPage struct {
+	Items []Subscription
+	// NextCursor continues the listing, empty on the last page.
+	NextCursor string
+}
+
+// Cursor is a keyset position in a listing: the sort value and ID of the last
+// subscription on a page.
+type Cursor struct {
+	Sort  SortField `json:"s"`
+	Desc  bool      `json:"d,omitempty"`
+	Value string    `json:"v"`
+	ID    string    `json:"id"`
+}
+
+// NewCursor returns the cursor following the subscription in a listing.
+func NewCursor(sort ListSort, sub Subscription) Cursor {
+	c := Cursor{Sort: sort.Field, Desc: sort.Desc, ID: sub.ID}
+	switch sort.Field {
+	case SortByPrice:
+		c.Value = strconv.Itoa(sub.Price)
+	case SortByStartDate:
+		c.Value = sub.StartDate.Format(time.DateOnly)
+	default:
+		c.Value = sub.ServiceName
+	}
+	return c
+}
+
+// Encode returns the opaque string form of the cursor.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor returned by Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err == nil {
+		_, err = c.SortValue()
+	}
+	if err != nil || !c.Sort.Valid() || c.ID == "" {
+		return Cursor{}, fmt.Errorf("%w: invalid cursor", ErrValidation)
+	}
+	return c, nil
+}
+
+// SortValue returns the sort value of the cursor typed like the sort field.
+func (c Cursor) SortValue() (any, error) {
+	switch c.Sort {
+	case SortByPrice:
+		return strconv.Atoi(c.Value)
+	case SortByStartDate:
+		return time.Parse(time.DateOnly, c.Value)
+	}
+	return c.Value, nil
+}
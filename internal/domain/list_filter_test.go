@@ -0,0 +1,42 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListSort(t *testing.T) {
+	sort, err := domain.ParseListSort("")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ListSort{Field: domain.SortByServiceName}, sort)
+
+	sort, err = domain.ParseListSort("-start_date")
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ListSort{Field: domain.SortByStartDate, Desc: true}, sort)
+
+	_, err = domain.ParseListSort("user_id")
+	assert.ErrorIs(t, err, domain.ErrValidation)
+}
+
+func TestCursor_RoundTrip(t *testing.T) {
+	sub := domain.Subscription{ID: "id-1", ServiceName: "Netflix", Price: 499, StartDate: *shortDate("03-2025")}
+
+	for _, sort := range []domain.ListSort{
+		{Field: domain.SortByServiceName},
+		{Field: domain.SortByPrice, Desc: true},
+		{Field: domain.SortByStartDate},
+	} {
+		cursor := domain.NewCursor(sort, sub)
+		decoded, err := domain.DecodeCursor(cursor.Encode())
+		assert.NoError(t, err)
+		assert.Equal(t, cursor, decoded)
+	}
+	assert.Equal(t, "2025-03-01", domain.NewCursor(domain.ListSort{Field: domain.SortByStartDate}, sub).Value)
+
+	_, err := domain.DecodeCursor("not-a-cursor")
+	assert.ErrorIs(t, err, domain.ErrValidation)
+	_, err = domain.DecodeCursor(domain.Cursor{Sort: domain.SortByPrice, Value: "cheap", ID: "id-1"}.Encode())
+	assert.ErrorIs(t, err, domain.ErrValidation)
+}
@@ -0,0 +1,30 @@
+package domain
+
+import "time"
+
+// PricePoint is the price of a subscription effective from a month on, until
+// the next price point.
+type PricePoint struct {
+	EffectiveFrom ShortDate `json:"effective_from" db:"effective_from"`
+	Price         int       `json:"price" db:"price"` // in minor units of Currency
+	Currency      string    `json:"currency" db:"currency"`
+}
+
+// PriceAt returns the price effective in the month containing m. Months
+// before the first known price use the earliest one, subscriptions without
+// price history always use their current price.
+func (s Subscription) PriceAt(m time.Time) Money {
+	price := Money{Amount: s.Price, Currency: s.Currency}
+	for i, p := range s.Prices {
+		if i > 0 && monthIndex(p.EffectiveFrom.Time) > monthIndex(m) {
+			break
+		}
+		price = Money{Amount: p.Price, Currency: p.Currency}
+	}
+	return price
+}
+
+// CurrentMonth returns the first day of the current month in UTC.
+func CurrentMonth() time.Time {
+	return firstOfMonth(time.Now().UTC())
+}
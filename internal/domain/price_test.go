@@ -0,0 +1,51 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscription_PriceAt(t *testing.T) {
+	sub := domain.Subscription{
+		Price:     69900,
+		Currency:  "RUB",
+		StartDate: domain.ShortDate{Time: month("01-2025")},
+		Prices: []domain.PricePoint{
+			{EffectiveFrom: domain.ShortDate{Time: month("01-2025")}, Price: 49900, Currency: "RUB"},
+			{EffectiveFrom: domain.ShortDate{Time: month("03-2025")}, Price: 69900, Currency: "RUB"},
+		},
+	}
+
+	assert.Equal(t, 49900, sub.PriceAt(month("12-2024")).Amount)
+	assert.Equal(t, 49900, sub.PriceAt(month("02-2025")).Amount)
+	assert.Equal(t, 69900, sub.PriceAt(month("03-2025")).Amount)
+	assert.Equal(t, 69900, sub.PriceAt(month("10-2025")).Amount)
+
+	assert.Equal(t, 49900, sub.CostInMonth(month("02-2025"), domain.CostModeCash).Amount)
+	assert.Equal(t, 69900, sub.CostInMonth(month("03-2025"), domain.CostModeCash).Amount)
+}
+
+func TestSubscription_PriceAt_YearlyCycleKeepsStartPrice(t *testing.T) {
+	sub := domain.Subscription{
+		Price:           7200,
+		Currency:        "USD",
+		StartDate:       domain.ShortDate{Time: month("01-2025")},
+		BillingPeriod:   domain.BillingYearly,
+		BillingInterval: 1,
+		Prices: []domain.PricePoint{
+			{EffectiveFrom: domain.ShortDate{Time: month("01-2025")}, Price: 6000, Currency: "USD"},
+			{EffectiveFrom: domain.ShortDate{Time: month("06-2025")}, Price: 7200, Currency: "USD"},
+		},
+	}
+
+	// The cycle paid in January is spread with the January price.
+	assert.Equal(t, 500, sub.CostInMonth(month("08-2025"), domain.CostModeAmortized).Amount)
+	assert.Equal(t, 7200, sub.CostInMonth(month("01-2026"), domain.CostModeCash).Amount)
+}
+
+func TestSubscription_PriceAt_NoHistory(t *testing.T) {
+	sub := domain.Subscription{Price: 500, Currency: "EUR", StartDate: domain.ShortDate{Time: month("01-2025")}}
+	assert.Equal(t, domain.Money{Amount: 500, Currency: "EUR"}, sub.PriceAt(month("05-2025")))
+}
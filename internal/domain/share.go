@@ -0,0 +1,202 @@
+package domain
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Member shares the cost of a subscription paid by its user. A member pays
+// either a fixed Amount of every charge or a part of what is left after the
+// fixed amounts, proportional to its Weight. The paying user bears whatever
+// the members do not, it can be a member itself to take a weighted part.
+type Member struct {
+	UserID string `json:"user_id" db:"user_id"`
+	Weight int    `json:"weight,omitempty" db:"weight"`
+	// Amount is in minor units of the price, charges smaller than the fixed
+	// amounts are split between them in the order of the members.
+	Amount *int `json:"amount,omitempty" db:"amount"`
+}
+
+// ValidateMembers checks every member has either a positive weight or a
+// fixed amount and is listed once.
+func ValidateMembers(members []Member) error {
+	seen := make(map[string]bool, len(members))
+	for _, m := range members {
+		switch {
+		case seen[m.UserID]:
+			return fmt.Errorf("%w: member %s is listed twice", ErrValidation, m.UserID)
+		case m.Amount != nil && (*m.Amount < 0 || m.Weight != 0):
+			return fmt.Errorf("%w: member %s must have a non-negative amount and no weight", ErrValidation, m.UserID)
+		case m.Amount == nil && m.Weight <= 0:
+			return fmt.Errorf("%w: member %s must have a positive weight or an amount", ErrValidation, m.UserID)
+		}
+		seen[m.UserID] = true
+	}
+	return nil
+}
+
+// Share is the part of a cost borne by a user.
+type Share struct {
+	UserID string
+	Amount int
+}
+
+// SharesInMonth splits the amount attributed to the month containing m
+// between the paying user, first, and the members. The shares add up to the
+// cost exactly.
+func (s Subscription) SharesInMonth(m time.Time, mode CostMode) (Money, []Share) {
+	cost, price := s.cycleCost(m, mode)
+	if price.Amount == 0 {
+		return cost, []Share{{UserID: s.UserID, Amount: cost.Amount}}
+	}
+
+	parts := s.splitPrice(price.Amount)
+	weights := make([]int, len(parts))
+	for i, part := range parts {
+		weights[i] = part.Amount
+	}
+	for i, amount := range allocate(cost.Amount, weights) {
+		parts[i].Amount = amount
+	}
+	return cost, parts
+}
+
+// ShareInMonth returns the part of the amount attributed to the month
+// containing m borne by the user, all of it if userID is empty.
+func (s Subscription) ShareInMonth(m time.Time, mode CostMode, userID string) Money {
+	if userID == "" || len(s.Members) == 0 && userID == s.UserID {
+		return s.CostInMonth(m, mode)
+	}
+	cost, shares := s.SharesInMonth(m, mode)
+	share := Money{Currency: cost.Currency}
+	for _, sh := range shares {
+		if sh.UserID == userID {
+			share.Amount += sh.Amount
+		}
+	}
+	return share
+}
+
+// splitPrice splits a charge of the subscription between the paying user,
+// first, and the members, each user once
+func (s Subscription) splitPrice(price int) []Share {
+	shares := []Share{{UserID: s.UserID}}
+	index := map[string]int{s.UserID: 0}
+	add := func(userID string, amount int) {
+		i, ok := index[userID]
+		if !ok {
+			i = len(shares)
+			index[userID] = i
+			shares = append(shares, Share{UserID: userID})
+		}
+		shares[i].Amount += amount
+	}
+
+	rest := price
+	var weighted []Member
+	for _, m := range s.Members {
+		if m.Amount == nil {
+			weighted = append(weighted, m)
+			continue
+		}
+		amount := min(*m.Amount, rest)
+		add(m.UserID, amount)
+		rest -= amount
+	}
+	if len(weighted) == 0 {
+		add(s.UserID, rest)
+		return shares
+	}
+	weights := make([]int, len(weighted))
+	for i, m := range weighted {
+		weights[i] = m.Weight
+	}
+	for i, amount := range allocate(rest, weights) {
+		add(weighted[i].UserID, amount)
+	}
+	return shares
+}
+
+// allocate splits total proportionally to the weights, the remainder of the
+// rounding goes to the largest fractions first, then to the first weights.
+func allocate(total int, weights []int) []int {
+	sum := 0
+	for _, w := range weights {
+		sum += w
+	}
+	res := make([]int, len(weights))
+	if sum == 0 {
+		return res
+	}
+
+	rest := total
+	order := make([]int, len(weights))
+	for i, w := range weights {
+		res[i] = total * w / sum
+		rest -= res[i]
+		order[i] = i
+	}
+	fraction := func(i int) int { return total * weights[i] % sum }
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(fraction(b), fraction(a))
+	})
+	for _, i := range order[:rest] {
+		res[i]++
+	}
+	return res
+}
+
+// Transfer is an amount a user owes another for the subscriptions the latter
+// paid.
+type Transfer struct {
+	From   string
+	To     string
+	Amount int
+}
+
+// Settlement is who owes whom for the subscriptions of a month.
+type Settlement struct {
+	Month     ShortDate
+	Currency  string
+	Transfers []Transfer
+}
+
+// Settle works out what the members of subs owe the paying users for the
+// month containing m, converted to the reporting currency of conv. Debts
+// between two users are netted, so there is at most one transfer between
+// them. Transfers are ordered by debtor and creditor.
+func Settle(subs []Subscription, m time.Time, mode CostMode, conv Converter) (Settlement, error) {
+	type pair struct{ from, to string }
+	owed := make(map[pair]int)
+	for _, sub := range subs {
+		if len(sub.Members) == 0 {
+			continue
+		}
+		cost, shares := sub.SharesInMonth(m, mode)
+		for _, share := range shares {
+			if share.UserID == sub.UserID || share.Amount == 0 {
+				continue
+			}
+			amount, err := conv.Convert(share.Amount, cost.Currency, m)
+			if err != nil {
+				return Settlement{}, err
+			}
+			owed[pair{share.UserID, sub.UserID}] += amount
+		}
+	}
+
+	settlement := Settlement{Month: ShortDate{Time: firstOfMonth(m)}, Currency: conv.Currency, Transfers: []Transfer{}}
+	for p, amount := range owed {
+		net := amount - owed[pair{p.to, p.from}]
+		if net > 0 {
+			settlement.Transfers = append(settlement.Transfers, Transfer{From: p.from, To: p.to, Amount: net})
+		}
+	}
+	slices.SortFunc(settlement.Transfers, func(a, b Transfer) int {
+		return cmp.Or(strings.Compare(a.From, b.From), strings.Compare(a.To, b.To))
+	})
+	return settlement, nil
+}
@@ -0,0 +1,136 @@
+package domain_test
+
+import (
+	"testing"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func shared(payer string, price int, period domain.BillingPeriod, members ...domain.Member) domain.Subscription {
+	return domain.Subscription{
+		UserID:          payer,
+		ServiceName:     "family",
+		Price:           price,
+		Currency:        "RUB",
+		StartDate:       domain.ShortDate{Time: month("01-2025")},
+		BillingPeriod:   period,
+		BillingInterval: 1,
+		Members:         members,
+	}
+}
+
+func amount(v int) *int {
+	return &v
+}
+
+func TestSubscription_SharesInMonth(t *testing.T) {
+	tests := []struct {
+		name string
+		sub  domain.Subscription
+		mode domain.CostMode
+		want []domain.Share
+	}{
+		{
+			"no members",
+			shared("alice", 1000, domain.BillingMonthly),
+			domain.CostModeCash,
+			[]domain.Share{{UserID: "alice", Amount: 1000}},
+		},
+		{
+			"equal weights",
+			shared("alice", 1000, domain.BillingMonthly,
+				domain.Member{UserID: "alice", Weight: 1}, domain.Member{UserID: "bob", Weight: 1}, domain.Member{UserID: "carol", Weight: 1}),
+			domain.CostModeCash,
+			[]domain.Share{{UserID: "alice", Amount: 334}, {UserID: "bob", Amount: 333}, {UserID: "carol", Amount: 333}},
+		},
+		{
+			"payer not a member",
+			shared("alice", 1000, domain.BillingMonthly, domain.Member{UserID: "bob", Weight: 3}, domain.Member{UserID: "carol", Weight: 1}),
+			domain.CostModeCash,
+			[]domain.Share{{UserID: "alice", Amount: 0}, {UserID: "bob", Amount: 750}, {UserID: "carol", Amount: 250}},
+		},
+		{
+			"fixed amount and weights",
+			shared("alice", 1000, domain.BillingMonthly, domain.Member{UserID: "bob", Amount: amount(300)}, domain.Member{UserID: "carol", Weight: 1}),
+			domain.CostModeCash,
+			[]domain.Share{{UserID: "alice", Amount: 0}, {UserID: "bob", Amount: 300}, {UserID: "carol", Amount: 700}},
+		},
+		{
+			"fixed amount, payer pays the rest",
+			shared("alice", 1000, domain.BillingMonthly, domain.Member{UserID: "bob", Amount: amount(300)}),
+			domain.CostModeCash,
+			[]domain.Share{{UserID: "alice", Amount: 700}, {UserID: "bob", Amount: 300}},
+		},
+		{
+			"fixed amounts above the price",
+			shared("alice", 1000, domain.BillingMonthly, domain.Member{UserID: "bob", Amount: amount(800)}, domain.Member{UserID: "carol", Amount: amount(800)}),
+			domain.CostModeCash,
+			[]domain.Share{{UserID: "alice", Amount: 0}, {UserID: "bob", Amount: 800}, {UserID: "carol", Amount: 200}},
+		},
+		{
+			"amortized yearly charge",
+			shared("alice", 12000, domain.BillingYearly, domain.Member{UserID: "bob", Amount: amount(6000)}),
+			domain.CostModeAmortized,
+			[]domain.Share{{UserID: "alice", Amount: 500}, {UserID: "bob", Amount: 500}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cost, shares := tt.sub.SharesInMonth(month("03-2025"), tt.mode)
+			assert.Equal(t, tt.want, shares)
+			total := 0
+			for _, s := range shares {
+				total += s.Amount
+			}
+			assert.Equal(t, cost.Amount, total)
+		})
+	}
+}
+
+func TestSubscription_ShareInMonth(t *testing.T) {
+	sub := shared("alice", 900, domain.BillingMonthly, domain.Member{UserID: "alice", Weight: 2}, domain.Member{UserID: "bob", Weight: 1})
+
+	assert.Equal(t, 900, sub.ShareInMonth(month("03-2025"), domain.CostModeCash, "").Amount)
+	assert.Equal(t, 600, sub.ShareInMonth(month("03-2025"), domain.CostModeCash, "alice").Amount)
+	assert.Equal(t, 300, sub.ShareInMonth(month("03-2025"), domain.CostModeCash, "bob").Amount)
+	assert.Equal(t, 0, sub.ShareInMonth(month("03-2025"), domain.CostModeCash, "carol").Amount)
+	assert.Equal(t, 0, sub.ShareInMonth(month("12-2024"), domain.CostModeCash, "bob").Amount)
+}
+
+func TestValidateMembers(t *testing.T) {
+	assert.NoError(t, domain.ValidateMembers(nil))
+	assert.NoError(t, domain.ValidateMembers([]domain.Member{{UserID: "bob", Weight: 1}, {UserID: "carol", Amount: amount(0)}}))
+	assert.ErrorIs(t, domain.ValidateMembers([]domain.Member{{UserID: "bob", Weight: 1}, {UserID: "bob", Weight: 2}}), domain.ErrValidation)
+	assert.ErrorIs(t, domain.ValidateMembers([]domain.Member{{UserID: "bob"}}), domain.ErrValidation)
+	assert.ErrorIs(t, domain.ValidateMembers([]domain.Member{{UserID: "bob", Weight: 1, Amount: amount(100)}}), domain.ErrValidation)
+	assert.ErrorIs(t, domain.ValidateMembers([]domain.Member{{UserID: "bob", Amount: amount(-1)}}), domain.ErrValidation)
+}
+
+func TestSettle(t *testing.T) {
+	subs := []domain.Subscription{
+		shared("alice", 900, domain.BillingMonthly,
+			domain.Member{UserID: "alice", Weight: 1}, domain.Member{UserID: "bob", Weight: 1}, domain.Member{UserID: "carol", Weight: 1}),
+		shared("bob", 600, domain.BillingMonthly, domain.Member{UserID: "alice", Amount: amount(400)}),
+		shared("carol", 500, domain.BillingMonthly),
+		shared("bob", 1200, domain.BillingYearly, domain.Member{UserID: "carol", Weight: 1}),
+	}
+
+	settlement, err := domain.Settle(subs, month("03-2025"), domain.CostModeCash, domain.Converter{Currency: "RUB"})
+	require.NoError(t, err)
+	assert.Equal(t, month("03-2025"), settlement.Month.Time)
+	assert.Equal(t, "RUB", settlement.Currency)
+	assert.Equal(t, []domain.Transfer{
+		{From: "alice", To: "bob", Amount: 100},
+		{From: "carol", To: "alice", Amount: 300},
+	}, settlement.Transfers)
+
+	settlement, err = domain.Settle(subs, month("01-2025"), domain.CostModeCash, domain.Converter{Currency: "RUB"})
+	require.NoError(t, err)
+	assert.Equal(t, []domain.Transfer{
+		{From: "alice", To: "bob", Amount: 100},
+		{From: "carol", To: "alice", Amount: 300},
+		{From: "carol", To: "bob", Amount: 1200},
+	}, settlement.Transfers)
+}
@@ -1,10 +1,59 @@
 package domain
 
+import (
+	"fmt"
+	"time"
+)
+
 // Subscription represents a user's subscription to a service.
 type Subscription struct {
+	ID          string     `json:"id" db:"id"`
+	TenantID    string     `json:"-" db:"tenant_id"`
 	UserID      string     `json:"user_id" db:"user_id"`
 	ServiceName string     `json:"service_name" db:"service_name"`
-	Price       int        `json:"price" db:"price"`
+	Price       int        `json:"price" db:"price"` // in minor units of Currency
+	Currency    string     `json:"currency" db:"currency"`
 	StartDate   ShortDate  `json:"start_date" db:"start_date"`
 	EndDate     *ShortDate `json:"end_date,omitempty" db:"end_date"`
+	// BillingPeriod and BillingInterval define the billing cycle, e.g. every
+	// 3 months. Price is charged once per cycle.
+	BillingPeriod   BillingPeriod `json:"billing_period" db:"billing_period"`
+	BillingInterval int           `json:"billing_interval" db:"billing_interval"`
+	// Version is incremented on every change of the subscription.
+	Version int `json:"version" db:"version"`
+	// Prices is the price history ordered by effective month. It is only
+	// loaded for cost calculations.
+	Prices []PricePoint `json:"-" db:"-"`
+	// Members share the cost with the user, who pays it. They are only
+	// loaded for cost calculations.
+	Members []Member `json:"-" db:"-"`
+}
+
+// Validate checks the subscription dates.
+func (s Subscription) Validate() error {
+	if s.EndDate != nil && s.EndDate.Before(s.StartDate.Time) {
+		return fmt.Errorf("%w: end_date is before start_date", ErrValidation)
+	}
+	return nil
+}
+
+// BilledMonths returns the number of months the subscription is billed for
+// within the [from, to] window, both ends inclusive. Open-ended subscriptions
+// are counted up to `to`.
+func (s Subscription) BilledMonths(from, to time.Time) int {
+	start := max(monthIndex(s.StartDate.Time), monthIndex(from))
+	end := monthIndex(to)
+	if s.EndDate != nil && !s.EndDate.IsZero() {
+		end = min(end, monthIndex(s.EndDate.Time))
+	}
+	if end < start {
+		return 0
+	}
+	return end - start + 1
+}
+
+// monthIndex returns the absolute month number of t, so the difference of
+// two indexes is the number of months between them.
+func monthIndex(t time.Time) int {
+	return t.Year()*12 + int(t.Month()) - 1
 }
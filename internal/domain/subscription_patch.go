@@ -0,0 +1,46 @@
+package domain
+
+// SubscriptionPatch is a partial update of a subscription. Nil fields are
+// left unchanged.
+type SubscriptionPatch struct {
+	Price     *int
+	Currency  *string
+	StartDate *ShortDate
+	EndDate   *ShortDate
+	// ClearEndDate removes the end date, making the subscription open-ended.
+	ClearEndDate    bool
+	BillingPeriod   *BillingPeriod
+	BillingInterval *int
+}
+
+// Empty reports whether the patch changes nothing.
+func (p SubscriptionPatch) Empty() bool {
+	return p.Price == nil && p.Currency == nil && p.StartDate == nil && p.EndDate == nil &&
+		!p.ClearEndDate && p.BillingPeriod == nil && p.BillingInterval == nil
+}
+
+// Apply applies the patch to the subscription.
+func (p SubscriptionPatch) Apply(sub *Subscription) {
+	if p.Price != nil {
+		sub.Price = *p.Price
+	}
+	if p.Currency != nil {
+		sub.Currency = *p.Currency
+	}
+	if p.StartDate != nil {
+		sub.StartDate = *p.StartDate
+	}
+	if p.EndDate != nil {
+		end := *p.EndDate
+		sub.EndDate = &end
+	}
+	if p.ClearEndDate {
+		sub.EndDate = nil
+	}
+	if p.BillingPeriod != nil {
+		sub.BillingPeriod = *p.BillingPeriod
+	}
+	if p.BillingInterval != nil {
+		sub.BillingInterval = *p.BillingInterval
+	}
+}
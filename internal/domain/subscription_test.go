@@ -0,0 +1,46 @@
+package domain_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func month(s string) time.Time {
+	t, err := time.Parse("01-2006", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func shortDate(s string) *domain.ShortDate {
+	return &domain.ShortDate{Time: month(s)}
+}
+
+func TestSubscription_BilledMonths(t *testing.T) {
+	tests := []struct {
+		name     string
+		start    string
+		end      *domain.ShortDate
+		from, to string
+		want     int
+	}{
+		{"inside window", "03-2025", shortDate("05-2025"), "01-2025", "12-2025", 3},
+		{"started before window", "10-2024", shortDate("02-2025"), "01-2025", "12-2025", 2},
+		{"open ended", "11-2025", nil, "01-2025", "12-2025", 2},
+		{"open ended started before window", "06-2024", nil, "01-2025", "03-2025", 3},
+		{"single month", "07-2025", shortDate("07-2025"), "07-2025", "07-2025", 1},
+		{"ended before window", "01-2024", shortDate("12-2024"), "01-2025", "12-2025", 0},
+		{"starts after window", "01-2026", nil, "01-2025", "12-2025", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := domain.Subscription{Price: 100, StartDate: domain.ShortDate{Time: month(tt.start)}, EndDate: tt.end}
+			assert.Equal(t, tt.want, sub.BilledMonths(month(tt.from), month(tt.to)))
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"context"
+	"regexp"
+)
+
+// DefaultTenant is the tenant of calls that do not name one, and of the
+// subscriptions created before tenants were introduced.
+const DefaultTenant = "default"
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidTenantID reports whether id can name a tenant: up to 63 lowercase
+// letters, digits, dashes and underscores.
+func ValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a context whose calls act within the tenant. Tenants
+// are isolated from each other, repositories only see the data of the
+// tenant of the context.
+func WithTenant(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext returns the tenant of the context, DefaultTenant if
+// none is set.
+func TenantFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(tenantKey{}).(string); ok && id != "" {
+		return id
+	}
+	return DefaultTenant
+}
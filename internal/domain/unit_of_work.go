@@ -0,0 +1,17 @@
+package domain
+
+import "context"
+
+// Repositories are the repositories bound to a unit of work.
+type Repositories struct {
+	Subscriptions UserSubscriptionRepository
+	Users         UserRepository
+	Idempotency   IdempotencyStore
+}
+
+type UnitOfWork interface {
+	// Do runs fn in one transaction, committed if fn returns nil and rolled
+	// back otherwise. fn may be run again when the transaction conflicts
+	// with concurrent ones, so it must not have side effects outside repos.
+	Do(ctx context.Context, fn func(ctx context.Context, repos Repositories) error) error
+}
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultTimezone is the timezone of users created without one.
+const DefaultTimezone = "UTC"
+
+// ErrUnknownUser is returned when subscriptions are created for or shared
+// with users that do not exist. It is a validation error since the user is
+// chosen by the caller.
+var ErrUnknownUser = fmt.Errorf("%w: user does not exist", ErrValidation)
+
+// User owns subscriptions. Subscriptions and API keys can only be created for
+// existing users and are deleted with them.
+type User struct {
+	ID          string `json:"id" db:"id"`
+	TenantID    string `json:"-" db:"tenant_id"`
+	DisplayName string `json:"display_name" db:"display_name"`
+	// Email is unique in the tenant regardless of case, empty if not set.
+	Email string `json:"email" db:"email"`
+	// Currency is the default currency of new subscriptions of the user.
+	Currency string `json:"currency" db:"currency"`
+	// Timezone is an IANA timezone name.
+	Timezone  string    `json:"timezone" db:"timezone"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Validate checks the timezone of the user is known.
+func (u User) Validate() error {
+	if _, err := time.LoadLocation(u.Timezone); err != nil || u.Timezone == "" || u.Timezone == "Local" {
+		return fmt.Errorf("%w: unknown timezone %q", ErrValidation, u.Timezone)
+	}
+	return nil
+}
+
+type UserRepository interface {
+	// Create fails with ErrConflict if the ID or the email is taken.
+	Create(ctx context.Context, user *User) error
+	Get(ctx context.Context, id string) (*User, error)
+	// Update updates the profile of the user with user.ID.
+	Update(ctx context.Context, user *User) error
+	// Delete deletes the user with its subscriptions and API keys.
+	Delete(ctx context.Context, id string) error
+	// List a page of users ordered by creation.
+	List(ctx context.Context, limit, offset int) ([]User, error)
+}
+
+type UserService interface {
+	Create(ctx context.Context, user *User) error
+	Get(ctx context.Context, id string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id string) error
+	List(ctx context.Context, limit, offset int) ([]User, error)
+}
@@ -1,12 +1,41 @@
 package domain
 
-import "time"
+import "context"
 
 type UserSubscriptionRepository interface {
-	Create(sub *Subscription) error
-	Get(userID, serviceName string) (*Subscription, error)
-	Update(sub *Subscription) error
-	Delete(userID, serviceName string) error
-	List(userID string, limit, offset int) ([]Subscription, error)
-	TotalPrice(userID, serviceName string, from, to time.Time) (int, error)
+	// Create fails with ErrUnknownUser if the user does not exist.
+	Create(ctx context.Context, sub *Subscription) error
+	// Get, Update and Delete by user and service address the latest
+	// subscription of the user to the service. Update uses sub.ID when set.
+	//
+	// Update, Patch and Delete fail with ErrVersionMismatch unless the
+	// subscription has the expected version, sub.Version for Update. Version
+	// 0 skips the check.
+	Get(ctx context.Context, userID, serviceName string) (*Subscription, error)
+	GetByID(ctx context.Context, id string) (*Subscription, error)
+	Update(ctx context.Context, sub *Subscription) error
+	// Patch updates only the fields set in the patch and returns the result.
+	Patch(ctx context.Context, id string, version int, patch SubscriptionPatch) (*Subscription, error)
+	Delete(ctx context.Context, userID, serviceName string, version int) error
+	DeleteByID(ctx context.Context, id string, version int) error
+	// List returns up to filter.Limit subscriptions matching the filter in
+	// the order of filter.Sort, starting after filter.After.
+	List(ctx context.Context, filter ListFilter) ([]Subscription, error)
+	// Count returns the number of subscriptions matching the filter, ignoring
+	// its paging.
+	Count(ctx context.Context, filter ListFilter) (int, error)
+	// ListForPeriod returns subscriptions matching the filter that are active
+	// at least one month of its period, with their prices and members. A user
+	// filter matches the subscriptions the user pays or is a member of.
+	ListForPeriod(ctx context.Context, filter CostFilter) ([]Subscription, error)
+	// PriceHistory returns price points of a subscription ordered by effective month.
+	PriceHistory(ctx context.Context, subscriptionID string) ([]PricePoint, error)
+	// AddPrice records a price change and updates the current price of the
+	// subscription if the change is already effective.
+	AddPrice(ctx context.Context, subscriptionID string, price PricePoint) error
+	// Members returns the members of a subscription in their order.
+	Members(ctx context.Context, subscriptionID string) ([]Member, error)
+	// SetMembers replaces the members of a subscription, ErrUnknownUser if
+	// one of them is not a user.
+	SetMembers(ctx context.Context, subscriptionID string, members []Member) error
 }
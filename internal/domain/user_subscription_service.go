@@ -1,13 +1,34 @@
 package domain
 
-import "time"
+import "context"
 
 type UserSubscriptionService interface {
-	Create(sub *Subscription) error
-	Get(userID, serviceName string) (*Subscription, error)
-	Update(sub *Subscription) error
-	Delete(userID, serviceName string) error
-	List(userID string, limit, offset int) ([]Subscription, error)
+	// Create fails with ErrUnknownUser if the user does not exist
+	Create(ctx context.Context, sub *Subscription) error
+	Get(ctx context.Context, userID, serviceName string) (*Subscription, error)
+	GetByID(ctx context.Context, id string) (*Subscription, error)
+	// Update, Patch and Delete fail with ErrVersionMismatch unless the
+	// subscription has the expected version, 0 skips the check
+	Update(ctx context.Context, sub *Subscription) error
+	// Partially update the latest subscription of a user to a service
+	Patch(ctx context.Context, userID, serviceName string, version int, patch SubscriptionPatch) (*Subscription, error)
+	Delete(ctx context.Context, userID, serviceName string, version int) error
+	DeleteByID(ctx context.Context, id string, version int) error
+	// List a page of subscriptions, with a cursor to the next page
+	List(ctx context.Context, filter ListFilter) (SubscriptionPage, error)
+	// Count subscriptions matching the filter of a listing
+	Count(ctx context.Context, filter ListFilter) (int, error)
 	// Calculate total price for a period, with optional filters
-	TotalPrice(userID, serviceName string, from, to time.Time) (int, error)
+	TotalPrice(ctx context.Context, filter CostFilter) (Money, error)
+	// Split the cost of a period by month and service
+	Breakdown(ctx context.Context, filter CostFilter) ([]MonthlyCost, error)
+	// Work out who owes whom for the shared subscriptions of filter.To
+	Settlement(ctx context.Context, filter CostFilter) (Settlement, error)
+	// Price history of a subscription and scheduling of price changes
+	PriceHistory(ctx context.Context, userID, serviceName string) ([]PricePoint, error)
+	// AddPrice fills in the currency of the subscription if price has none
+	AddPrice(ctx context.Context, userID, serviceName string, price *PricePoint) error
+	// Members sharing the cost of the latest subscription of a user to a service
+	Members(ctx context.Context, userID, serviceName string) ([]Member, error)
+	SetMembers(ctx context.Context, userID, serviceName string, members []Member) error
 }
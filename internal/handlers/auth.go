@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// Credential headers, bearer tokens are sent in Authorization. The identity
+// headers are set by a trusted proxy in front of the service.
+const (
+	headerAPIKey   = "X-API-Key"
+	headerUserID   = "X-User-ID"
+	headerUserRole = "X-User-Role"
+)
+
+// WithAuth requires requests to the API to be authenticated by the
+// authenticator. The service decides what the caller may do.
+func (h *subscriptionsApiHandler) WithAuth(auth domain.Authenticator) *subscriptionsApiHandler {
+	h.auth = auth
+	return h
+}
+
+// authenticate is a middleware verifying the credentials of the request and
+// storing the caller in the request context
+func (h *subscriptionsApiHandler) authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		creds := domain.Credentials{
+			UserID:   c.Request().Header.Get(headerUserID),
+			Role:     c.Request().Header.Get(headerUserRole),
+			TenantID: c.Request().Header.Get(headerTenantID),
+		}
+		if key := c.Request().Header.Get(headerAPIKey); key != "" {
+			creds.APIKey = key
+		} else if scheme, token, ok := strings.Cut(c.Request().Header.Get(echo.HeaderAuthorization), " "); ok && strings.EqualFold(scheme, "Bearer") {
+			creds.Token = strings.TrimSpace(token)
+		}
+
+		ctx := c.Request().Context()
+		principal, err := h.auth.Authenticate(ctx, creds)
+		if err != nil {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="subscriptions"`)
+			return err
+		}
+		c.SetRequest(c.Request().WithContext(domain.WithPrincipal(ctx, principal)))
+		return next(c)
+	}
+}
+
+// callerID returns the user ID of the authenticated caller, empty for
+// anonymous requests
+func callerID(c echo.Context) string {
+	principal, _ := domain.PrincipalFromContext(c.Request().Context())
+	return principal.UserID
+}
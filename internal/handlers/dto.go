@@ -1,33 +1,196 @@
 package handlers
 
-import "github.com/alexputin/subscriptions/internal/domain"
+import (
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
 
 // SubscriptionRes is the response for a subscription
 type SubscriptionRes struct {
+	ID          string            `json:"id" example:"3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a"`
 	UserID      string            `json:"user_id"`
 	ServiceName string            `json:"service_name"`
-	Price       int               `json:"price"`
+	Price       int               `json:"price" example:"49900"` // in minor units of Currency
+	Currency    string            `json:"currency" example:"RUB"`
 	StartDate   domain.ShortDate  `json:"start_date" swaggertype:"string" example:"07-2025"`
 	EndDate     *domain.ShortDate `json:"end_date,omitempty" swaggertype:"string" example:"07-2025"`
+	// Price is charged once every BillingInterval billing periods
+	BillingPeriod   domain.BillingPeriod `json:"billing_period" swaggertype:"string" example:"monthly"`
+	BillingInterval int                  `json:"billing_interval" example:"1"`
+	// Version is also returned as the ETag header, for use with If-Match
+	Version int `json:"version" example:"1"`
+}
+
+func newSubscriptionRes(sub domain.Subscription) SubscriptionRes {
+	return SubscriptionRes{
+		ID:          sub.ID,
+		UserID:      sub.UserID,
+		ServiceName: sub.ServiceName,
+		Price:       sub.Price,
+		Currency:    sub.Currency,
+		StartDate:   sub.StartDate,
+		EndDate:     sub.EndDate,
+
+		BillingPeriod:   sub.BillingPeriod,
+		BillingInterval: sub.BillingInterval,
+		Version:         sub.Version,
+	}
+}
+
+// SubscriptionPageRes is a page of subscriptions with paging details
+type SubscriptionPageRes struct {
+	Items []SubscriptionRes `json:"items"`
+	// Total is the number of subscriptions matching the filter on all pages
+	Total int `json:"total" example:"42"`
+	Limit int `json:"limit" example:"20"`
+	// Offset is set unless the page was requested by cursor, NextCursor is
+	// set unless it is the last page
+	Offset     *int   `json:"offset,omitempty" example:"0"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PricePointRes is a price of a subscription effective from a month on
+type PricePointRes struct {
+	EffectiveFrom domain.ShortDate `json:"effective_from" swaggertype:"string" example:"03-2025"`
+	Price         int              `json:"price" example:"69900"` // in minor units of Currency
+	Currency      string           `json:"currency" example:"RUB"`
 }
 
 // TotalPriceRes is the response for total price
 type TotalPriceRes struct {
-	Total int `json:"total"`
+	Total    int    `json:"total" example:"149700"` // in minor units of Currency
+	Currency string `json:"currency" example:"RUB"`
+}
+
+// ServiceCostRes is the spend on a single service
+type ServiceCostRes struct {
+	ServiceName string `json:"service_name"`
+	Total       int    `json:"total"`
+}
+
+// MonthlyCostRes is the spend in a single month split by service
+type MonthlyCostRes struct {
+	Month    domain.ShortDate `json:"month" swaggertype:"string" example:"07-2025"`
+	Currency string           `json:"currency" example:"RUB"`
+	Total    int              `json:"total"`
+	Services []ServiceCostRes `json:"services"`
 }
 
 // SubscriptionCreateReq is used for creating a subscription
 type SubscriptionCreateReq struct {
 	UserID      string            `json:"user_id" validate:"required,uuid4"`
 	ServiceName string            `json:"service_name" validate:"required,min=2,max=255"`
-	Price       int               `json:"price" validate:"required,min=0"`
+	Price       int               `json:"price" validate:"required,min=0" example:"49900"` // in minor units of Currency
+	Currency    string            `json:"currency,omitempty" validate:"omitempty,iso4217" example:"RUB"`
 	StartDate   domain.ShortDate  `json:"start_date" validate:"required" swaggertype:"string" example:"07-2025"`
 	EndDate     *domain.ShortDate `json:"end_date,omitempty" swaggertype:"string" example:"07-2025"`
+	// BillingPeriod defaults to monthly, BillingInterval defaults to 1
+	BillingPeriod   domain.BillingPeriod `json:"billing_period,omitempty" validate:"omitempty,oneof=weekly monthly quarterly yearly" swaggertype:"string" enums:"weekly,monthly,quarterly,yearly" example:"monthly"`
+	BillingInterval int                  `json:"billing_interval,omitempty" validate:"omitempty,min=1" example:"1"`
 }
 
 // SubscriptionUpdateReq is used for updating a subscription
 type SubscriptionUpdateReq struct {
-	Price     int               `json:"price" validate:"required,min=0"`
+	Price     int               `json:"price" validate:"required,min=0" example:"49900"`               // in minor units of Currency
+	Currency  string            `json:"currency,omitempty" validate:"omitempty,iso4217" example:"RUB"` // the current currency is kept if omitted
 	StartDate domain.ShortDate  `json:"start_date" validate:"required" swaggertype:"string" example:"07-2025"`
 	EndDate   *domain.ShortDate `json:"end_date,omitempty" swaggertype:"string" example:"07-2025"`
+	// BillingPeriod defaults to monthly, BillingInterval defaults to 1
+	BillingPeriod   domain.BillingPeriod `json:"billing_period,omitempty" validate:"omitempty,oneof=weekly monthly quarterly yearly" swaggertype:"string" enums:"weekly,monthly,quarterly,yearly" example:"monthly"`
+	BillingInterval int                  `json:"billing_interval,omitempty" validate:"omitempty,min=1" example:"1"`
+}
+
+// SubscriptionPatchReq is a JSON Merge Patch (RFC 7396) of a subscription.
+// Omitted fields are left unchanged, null end_date makes the subscription
+// open-ended and null billing fields reset the billing cycle to monthly.
+type SubscriptionPatchReq struct {
+	Price           *int                  `json:"price,omitempty" validate:"omitempty,min=0" example:"49900"` // in minor units of Currency
+	Currency        *string               `json:"currency,omitempty" validate:"omitempty,iso4217" example:"RUB"`
+	StartDate       *domain.ShortDate     `json:"start_date,omitempty" swaggertype:"string" example:"07-2025"`
+	EndDate         *domain.ShortDate     `json:"end_date,omitempty" swaggertype:"string" example:"12-2025"`
+	BillingPeriod   *domain.BillingPeriod `json:"billing_period,omitempty" validate:"omitempty,oneof=weekly monthly quarterly yearly" swaggertype:"string" enums:"weekly,monthly,quarterly,yearly" example:"monthly"`
+	BillingInterval *int                  `json:"billing_interval,omitempty" validate:"omitempty,min=1" example:"1"`
+}
+
+// PriceChangeReq is used for recording a subscription price change
+type PriceChangeReq struct {
+	Price         int              `json:"price" validate:"required,min=0" example:"69900"` // in minor units of Currency
+	Currency      string           `json:"currency,omitempty" validate:"omitempty,iso4217" example:"RUB"`
+	EffectiveFrom domain.ShortDate `json:"effective_from" validate:"required" swaggertype:"string" example:"03-2025"`
+}
+
+// UserRes is the response for a user
+type UserRes struct {
+	ID          string    `json:"id" example:"550e8400-e29b-41d4-a716-446655440000"`
+	DisplayName string    `json:"display_name" example:"Alex"`
+	Email       string    `json:"email,omitempty" example:"alex@example.com"`
+	Currency    string    `json:"currency" example:"RUB"` // default currency of new subscriptions
+	Timezone    string    `json:"timezone" example:"Europe/Moscow"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func newUserRes(user domain.User) UserRes {
+	return UserRes{
+		ID:          user.ID,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Currency:    user.Currency,
+		Timezone:    user.Timezone,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+	}
+}
+
+// UserCreateReq is used for creating a user, the ID defaults to the caller
+// or a new one for anonymous requests
+type UserCreateReq struct {
+	ID          string `json:"id,omitempty" validate:"omitempty,uuid4" example:"550e8400-e29b-41d4-a716-446655440000"`
+	DisplayName string `json:"display_name" validate:"max=255" example:"Alex"`
+	Email       string `json:"email,omitempty" validate:"omitempty,email,max=255" example:"alex@example.com"`
+	// Currency defaults to the reporting currency, Timezone to UTC
+	Currency string `json:"currency,omitempty" validate:"omitempty,iso4217" example:"RUB"`
+	Timezone string `json:"timezone,omitempty" validate:"omitempty,timezone" example:"Europe/Moscow"`
+}
+
+// UserUpdateReq is used for updating a user
+type UserUpdateReq struct {
+	DisplayName string `json:"display_name" validate:"max=255" example:"Alex"`
+	Email       string `json:"email,omitempty" validate:"omitempty,email,max=255" example:"alex@example.com"`
+	// Currency defaults to the reporting currency, Timezone to UTC
+	Currency string `json:"currency,omitempty" validate:"omitempty,iso4217" example:"RUB"`
+	Timezone string `json:"timezone,omitempty" validate:"omitempty,timezone" example:"Europe/Moscow"`
+}
+
+// MemberReq is a member sharing the cost of a subscription, with either a
+// weight or a fixed amount
+type MemberReq struct {
+	UserID string `json:"user_id" validate:"required,uuid4"`
+	// Weight is the part of the cost left after fixed amounts, relative to
+	// the other weights
+	Weight int `json:"weight,omitempty" validate:"omitempty,min=1" example:"1"`
+	// Amount is a fixed part of every charge, in minor units of the price
+	Amount *int `json:"amount,omitempty" validate:"omitempty,min=0" example:"20000"`
+}
+
+// MemberRes is a member sharing the cost of a subscription
+type MemberRes struct {
+	UserID string `json:"user_id"`
+	Weight int    `json:"weight,omitempty" example:"1"`
+	Amount *int   `json:"amount,omitempty" example:"20000"` // in minor units of the price
+}
+
+// TransferRes is an amount a user owes another
+type TransferRes struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Amount int    `json:"amount" example:"22500"` // in minor units of Currency
+}
+
+// SettlementRes is who owes whom for the shared subscriptions of a month
+type SettlementRes struct {
+	Month     domain.ShortDate `json:"month" swaggertype:"string" example:"07-2025"`
+	Currency  string           `json:"currency" example:"RUB"`
+	Transfers []TransferRes    `json:"transfers"`
 }
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Stable error codes of problem responses
+const (
+	CodeNotFound            = "not_found"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeConflict            = "conflict"
+	CodePreconditionFailed  = "precondition_failed"
+	CodeIdempotencyKeyReuse = "idempotency_key_reused"
+	CodeRequestInProgress   = "request_in_progress"
+	CodeValidationFailed    = "validation_failed"
+	CodeInvalidRequest      = "invalid_request"
+	CodeRateNotFound        = "exchange_rate_not_found"
+	CodeUnknownUser         = "unknown_user"
+	CodeInternalServerError = "internal_error"
+	CodeTimeout             = "timeout"
+)
+
+// NewHTTPErrorHandler returns an echo error handler rendering errors returned
+// by handlers as RFC 7807 problems, with domain errors mapped to HTTP status
+// codes.
+func NewHTTPErrorHandler(logger *zap.Logger) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		if c.Response().Committed {
+			return
+		}
+
+		problem := newProblem(err)
+		if logger != nil {
+			// Problems only carry fixed details, the cause is logged.
+			level := zap.InfoLevel
+			if problem.Status >= http.StatusInternalServerError {
+				level = zap.ErrorLevel
+			}
+			logger.Log(level, "request failed",
+				zap.String("method", c.Request().Method),
+				zap.String("uri", c.Request().RequestURI),
+				zap.Int("status", problem.Status),
+				zap.String("code", problem.Code),
+				zap.Error(err))
+		}
+
+		if c.Request().Method == http.MethodHead {
+			err = c.NoContent(problem.Status)
+		} else {
+			err = utils.ResponseProblem(c, problem)
+		}
+		if err != nil && logger != nil {
+			logger.Error("failed to send error response", zap.Error(err))
+		}
+	}
+}
+
+// newProblem maps an error to the problem of the response. Details are fixed
+// per code, the messages of errors are not exposed since they may come from
+// the database, except those of the handlers meant for clients.
+func newProblem(err error) utils.Problem {
+	var he *echo.HTTPError
+	var ve validator.ValidationErrors
+	var fe fieldsError
+	var re requestError
+	switch {
+	case errors.As(err, &he):
+		return utils.Problem{
+			Status: he.Code,
+			Detail: fmt.Sprint(he.Message),
+			Code:   statusCode(he.Code),
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return utils.Problem{Status: http.StatusServiceUnavailable, Detail: "request timed out", Code: CodeTimeout}
+	case errors.Is(err, domain.ErrUnauthorized):
+		return utils.Problem{Status: http.StatusUnauthorized, Detail: "missing or invalid credentials", Code: CodeUnauthorized}
+	case errors.Is(err, domain.ErrForbidden):
+		return utils.Problem{Status: http.StatusForbidden, Detail: "not allowed to access the resource", Code: CodeForbidden}
+	case errors.Is(err, domain.ErrNotFound):
+		return utils.Problem{Status: http.StatusNotFound, Detail: "resource not found", Code: CodeNotFound}
+	case errors.Is(err, domain.ErrVersionMismatch):
+		return utils.Problem{Status: http.StatusPreconditionFailed, Detail: "resource was changed by another request", Code: CodePreconditionFailed}
+	case errors.Is(err, domain.ErrIdempotencyKeyReused):
+		return utils.Problem{Status: http.StatusUnprocessableEntity, Detail: "idempotency key was used for a different request", Code: CodeIdempotencyKeyReuse}
+	case errors.Is(err, domain.ErrIdempotentRequestInProgress):
+		return utils.Problem{Status: http.StatusConflict, Detail: "request with the idempotency key is in progress, retry later", Code: CodeRequestInProgress}
+	case errors.Is(err, domain.ErrConflict):
+		return utils.Problem{Status: http.StatusConflict, Detail: "resource already exists", Code: CodeConflict}
+	case errors.As(err, &re):
+		return utils.Problem{Status: http.StatusBadRequest, Detail: string(re), Code: CodeInvalidRequest}
+	case errors.As(err, &fe):
+		return utils.Problem{
+			Status: http.StatusBadRequest,
+			Detail: "request validation failed",
+			Code:   CodeValidationFailed,
+			Errors: fe,
+		}
+	case errors.As(err, &ve):
+		return utils.Problem{
+			Status: http.StatusBadRequest,
+			Detail: "request validation failed",
+			Code:   CodeValidationFailed,
+			Errors: fieldErrors(ve),
+		}
+	case errors.Is(err, domain.ErrUnknownUser):
+		return utils.Problem{Status: http.StatusUnprocessableEntity, Detail: "user does not exist", Code: CodeUnknownUser}
+	case errors.Is(err, domain.ErrRateNotFound):
+		return utils.Problem{Status: http.StatusBadRequest, Detail: "no exchange rate between the currencies", Code: CodeRateNotFound}
+	case errors.Is(err, domain.ErrValidation):
+		return utils.Problem{Status: http.StatusBadRequest, Detail: "invalid request", Code: CodeInvalidRequest}
+	}
+	return utils.Problem{
+		Status: http.StatusInternalServerError,
+		Detail: http.StatusText(http.StatusInternalServerError),
+		Code:   CodeInternalServerError,
+	}
+}
+
+// statusCode derives an error code from an HTTP status, e.g. method_not_allowed
+func statusCode(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return CodeInternalServerError
+	}
+	text = strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(text)
+	return strings.ToLower(text)
+}
+
+// validationError creates an error for invalid input
+func validationError(msg string) error {
+	return requestError(msg)
+}
+
+// requestError is invalid input detected by the handlers, its message is
+// returned to the client
+type requestError string
+
+func (e requestError) Error() string {
+	return fmt.Sprintf("%s: %s", domain.ErrValidation, string(e))
+}
+
+func (e requestError) Unwrap() error {
+	return domain.ErrValidation
+}
+
+// fieldsError is a validation error of individual request fields that are
+// not checked by the validator
+type fieldsError []utils.FieldError
+
+func (e fieldsError) Error() string {
+	fields := make([]string, 0, len(e))
+	for _, fe := range e {
+		fields = append(fields, fe.Field+" "+fe.Message)
+	}
+	return "invalid fields: " + strings.Join(fields, ", ")
+}
+
+func (e fieldsError) Unwrap() error {
+	return domain.ErrValidation
+}
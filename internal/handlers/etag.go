@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	headerETag    = "ETag"
+	headerIfMatch = "If-Match"
+)
+
+// setETag sets the ETag header to the version of the subscription
+func setETag(c echo.Context, sub domain.Subscription) {
+	c.Response().Header().Set(headerETag, strconv.Quote(strconv.Itoa(sub.Version)))
+}
+
+// ifMatchVersion returns the subscription version required by the If-Match
+// header, 0 if any version matches. Weak or unknown entity tags never match
+// and fail with domain.ErrVersionMismatch.
+func ifMatchVersion(c echo.Context) (int, error) {
+	header := strings.TrimSpace(c.Request().Header.Get(headerIfMatch))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, validationError("If-Match with several entity tags is not supported")
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil || strings.HasPrefix(header, "W/") {
+		return 0, fmt.Errorf("entity tag %s: %w", header, domain.ErrVersionMismatch)
+	}
+	version, err := strconv.Atoi(tag)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("entity tag %s: %w", header, domain.ErrVersionMismatch)
+	}
+	return version, nil
+}
@@ -1,177 +1,306 @@
 package handlers
 
 import (
-	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/alexputin/subscriptions/internal/domain"
-	"github.com/alexputin/subscriptions/internal/utils"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"go.uber.org/zap"
 )
 
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+
+	headerNextCursor = "X-Next-Cursor"
+	headerLink       = "Link"
+)
+
+// MIMEApplicationMergePatchJSON is the media type of JSON Merge Patch documents
+const MIMEApplicationMergePatchJSON = "application/merge-patch+json"
+
 type subscriptionsApiHandler struct {
 	service  domain.UserSubscriptionService
 	validate *validator.Validate
 	logger   *zap.Logger
+
+	idempotency    domain.IdempotencyStore
+	idempotencyTTL time.Duration
+
+	// auth authenticates requests, they are anonymous if nil
+	auth domain.Authenticator
+
+	// users serves the user routes, they are not registered if nil
+	users domain.UserService
 }
 
 func NewSubscriptionsApiHandler(service domain.UserSubscriptionService, logger *zap.Logger) *subscriptionsApiHandler {
 	return &subscriptionsApiHandler{
 		service:  service,
-		validate: validator.New(),
+		validate: newValidator(),
 		logger:   logger,
 	}
 }
 
 func (h *subscriptionsApiHandler) RegisterRoutes(app *echo.Echo) {
 	group := app.Group("/api/v1")
-	group.POST("/subscriptions", h.CreateSubscription)
+	if h.auth != nil {
+		group.Use(h.authenticate)
+	}
+	group.Use(resolveTenant)
+	group.POST("/subscriptions", h.CreateSubscription, h.idempotent)
 	group.GET("/subscriptions", h.ListSubscriptions)
 	group.GET("/subscriptions/:user_id/:service_name", h.GetSubscription)
 	group.PUT("/subscriptions/:user_id/:service_name", h.UpdateSubscription)
+	group.PATCH("/subscriptions/:user_id/:service_name", h.PatchSubscription)
 	group.DELETE("/subscriptions/:user_id/:service_name", h.DeleteSubscription)
+	group.GET("/subscriptions/:id", h.GetSubscriptionByID)
+	group.PUT("/subscriptions/:id", h.UpdateSubscriptionByID)
+	group.DELETE("/subscriptions/:id", h.DeleteSubscriptionByID)
+	group.GET("/subscriptions/:user_id/:service_name/prices", h.PriceHistory)
+	group.POST("/subscriptions/:user_id/:service_name/prices", h.AddPrice)
+	group.GET("/subscriptions/:user_id/:service_name/members", h.Members)
+	group.PUT("/subscriptions/:user_id/:service_name/members", h.SetMembers)
 	group.GET("/subscriptions/total", h.TotalPrice)
+	group.GET("/subscriptions/breakdown", h.Breakdown)
+	group.GET("/subscriptions/settlement", h.Settlement)
+	if h.users != nil {
+		group.POST("/users", h.CreateUser)
+		group.GET("/users", h.ListUsers)
+		group.GET("/users/:id", h.GetUser)
+		group.PUT("/users/:id", h.UpdateUser)
+		group.DELETE("/users/:id", h.DeleteUser)
+	}
+
+	v2 := app.Group("/api/v2")
+	if h.auth != nil {
+		v2.Use(h.authenticate)
+	}
+	v2.Use(resolveTenant)
+	v2.GET("/subscriptions", h.ListSubscriptionsV2)
 }
 
 // CreateSubscription godoc
 // @Summary Create a new subscription
-// @Description Create a new subscription for a user
+// @Description Create a new subscription for a user, the user must exist
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param subscription body SubscriptionCreateReq true "Subscription to create"
+// @Param Idempotency-Key header string false "Key to safely retry the request, the response is replayed for identical retries"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
 // @Success 201 {object} SubscriptionRes
-// @Failure 400 {object} utils.ErrorResponse
-// @Failure 500 {object} utils.ErrorResponse
+// @Header 201 {string} ETag "Version of the subscription"
+// @Failure 400 {object} utils.Problem
+// @Failure 409 {object} utils.Problem "Subscription exists, or the request with the Idempotency-Key is still in progress"
+// @Failure 422 {object} utils.Problem "User does not exist, or Idempotency-Key reused with a different request"
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/v1/subscriptions [post]
 func (h *subscriptionsApiHandler) CreateSubscription(c echo.Context) error {
 	var req SubscriptionCreateReq
 	if err := c.Bind(&req); err != nil {
-		utils.ResponseError(c, http.StatusBadRequest, err)
-		return nil
+		return err
+	}
+	if req.UserID == "" {
+		req.UserID = callerID(c)
 	}
 
 	if err := h.validate.Struct(req); err != nil {
-		utils.ResponseError(c, http.StatusBadRequest, fmt.Errorf("validation failed: %w", err))
-		return nil
+		return fmt.Errorf("%w: %w", domain.ErrValidation, err)
 	}
 
 	sub := domain.Subscription{
 		UserID:      req.UserID,
 		ServiceName: req.ServiceName,
 		Price:       req.Price,
+		Currency:    req.Currency,
 		StartDate:   req.StartDate,
 		EndDate:     req.EndDate,
+
+		BillingPeriod:   req.BillingPeriod,
+		BillingInterval: req.BillingInterval,
 	}
 
-	err := h.service.Create(&sub)
+	err := h.service.Create(c.Request().Context(), &sub)
 	if err != nil {
-		if utils.IsErrorCode(err, utils.ErrUniqueViolation) {
-			utils.ResponseError(c, http.StatusBadRequest, fmt.Errorf("subscription already exist"))
-			return nil
-		}
-
 		if h.logger != nil {
 			h.logger.Warn("failed to create subscription",
 				zap.String("handler", "CreateSubscription"),
 				zap.Any("subscription", &sub),
 				zap.Error(err))
 		}
-		utils.ResponseError(c, http.StatusInternalServerError, err)
-		return nil
+		return err
 	}
-	res := SubscriptionRes(sub)
+	setETag(c, sub)
+	res := newSubscriptionRes(sub)
 	return c.JSON(http.StatusCreated, res)
 }
 
 // ListSubscriptions godoc
 // @Summary List subscriptions
-// @Description List subscriptions for a user
+// @Description List subscriptions for a user. Pages are continued with the cursor from the X-Next-Cursor or Link header, offset is kept for compatibility.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
-// @Param user_id query string true "User ID"
-// @Param limit query int false "Limit"
-// @Param offset query int false "Offset"
+// @Param user_id query string false "User ID, required for anonymous requests. By default owners and viewers list their own account and admins all users"
+// @Param limit query int false "Limit, at most 100" default(20)
+// @Param offset query int false "Offset, ignored with a cursor"
+// @Param cursor query string false "Cursor of the next page"
+// @Param sort query string false "Sort field, prefixed with - for descending order" Enums(service_name, -service_name, price, -price, start_date, -start_date)
+// @Param active_at query string false "Month subscriptions are active in (MM-YYYY)"
+// @Param min_price query int false "Minimum price in minor units"
+// @Param max_price query int false "Maximum price in minor units"
+// @Param service_prefix query string false "Service name prefix, case insensitive"
+// @Param status query string false "Status in the current month" Enums(active, ended, upcoming)
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
 // @Success 200 {array} SubscriptionRes
-// @Failure 400 {object} utils.ErrorResponse
-// @Failure 500 {object} utils.ErrorResponse
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, absent on the last page"
+// @Header 200 {string} Link "Link to the next page"
+// @Failure 400 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/v1/subscriptions [get]
 func (h *subscriptionsApiHandler) ListSubscriptions(c echo.Context) error {
-	userID := c.QueryParam("user_id")
-	if userID == "" {
-		utils.ResponseError(c, http.StatusBadRequest, errors.New("missing user_id"))
-		return nil
+	_, page, err := h.listSubscriptions(c)
+	if err != nil {
+		return err
 	}
 
-	limit := 20
-	offset := 0
-	if l := c.QueryParam("limit"); l != "" {
-		if v, err := strconv.Atoi(l); err == nil && v > 0 {
-			limit = v
-		}
+	res := make([]SubscriptionRes, len(page.Items))
+	for i, s := range page.Items {
+		res[i] = newSubscriptionRes(s)
 	}
 
-	if o := c.QueryParam("offset"); o != "" {
-		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
-			offset = v
+	return c.JSON(http.StatusOK, res)
+}
+
+// ListSubscriptionsV2 godoc
+// @Summary List subscriptions with paging details
+// @Description List subscriptions for a user in an envelope with the total count and paging details. Parameters are the same as in v1.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param user_id query string false "User ID, required for anonymous requests. By default owners and viewers list their own account and admins all users"
+// @Param limit query int false "Limit, at most 100" default(20)
+// @Param offset query int false "Offset, ignored with a cursor"
+// @Param cursor query string false "Cursor of the next page"
+// @Param sort query string false "Sort field, prefixed with - for descending order" Enums(service_name, -service_name, price, -price, start_date, -start_date)
+// @Param active_at query string false "Month subscriptions are active in (MM-YYYY)"
+// @Param min_price query int false "Minimum price in minor units"
+// @Param max_price query int false "Maximum price in minor units"
+// @Param service_prefix query string false "Service name prefix, case insensitive"
+// @Param status query string false "Status in the current month" Enums(active, ended, upcoming)
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {object} SubscriptionPageRes
+// @Header 200 {string} Link "Link to the next page"
+// @Failure 400 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v2/subscriptions [get]
+func (h *subscriptionsApiHandler) ListSubscriptionsV2(c echo.Context) error {
+	filter, page, err := h.listSubscriptions(c)
+	if err != nil {
+		return err
+	}
+
+	total, err := h.service.Count(c.Request().Context(), filter)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to count subscriptions",
+				zap.String("handler", "ListSubscriptionsV2"),
+				zap.String("user_id", filter.UserID),
+				zap.Error(err))
 		}
+		return err
+	}
+
+	res := SubscriptionPageRes{
+		Items:      make([]SubscriptionRes, len(page.Items)),
+		Total:      total,
+		Limit:      filter.Limit,
+		NextCursor: page.NextCursor,
+	}
+	for i, s := range page.Items {
+		res.Items[i] = newSubscriptionRes(s)
+	}
+	if filter.After == nil {
+		res.Offset = &filter.Offset
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// listSubscriptions lists the page of subscriptions requested by the query
+// parameters and sets the headers linking to the next page
+func (h *subscriptionsApiHandler) listSubscriptions(c echo.Context) (domain.ListFilter, domain.SubscriptionPage, error) {
+	filter, err := h.parseListFilter(c)
+	if err != nil {
+		return filter, domain.SubscriptionPage{}, err
 	}
 
-	subs, err := h.service.List(userID, limit, offset)
+	page, err := h.service.List(c.Request().Context(), filter)
 	if err != nil {
 		if h.logger != nil {
 			h.logger.Warn("failed to get list of subscriptions",
 				zap.String("handler", "ListSubscriptions"),
-				zap.String("user_id", userID),
-				zap.Int("limit", limit),
-				zap.Int("offset", offset),
+				zap.String("user_id", filter.UserID),
+				zap.Int("limit", filter.Limit),
+				zap.Int("offset", filter.Offset),
 				zap.Error(err))
 		}
-		utils.ResponseError(c, http.StatusInternalServerError, err)
-		return nil
-	}
-
-	res := make([]SubscriptionRes, len(subs))
-	for i, s := range subs {
-		res[i] = SubscriptionRes{
-			UserID:      s.UserID,
-			ServiceName: s.ServiceName,
-			Price:       s.Price,
-			StartDate:   s.StartDate,
-			EndDate:     s.EndDate,
-		}
+		return filter, page, err
 	}
 
-	return c.JSON(http.StatusOK, res)
+	if page.NextCursor != "" {
+		c.Response().Header().Set(headerNextCursor, page.NextCursor)
+		c.Response().Header().Set(headerLink, fmt.Sprintf(`<%s>; rel="next"`, nextPageURL(c, page.NextCursor)))
+	}
+	return filter, page, nil
 }
 
 // GetSubscription godoc
 // @Summary Get a subscription
-// @Description Get a subscription by user ID and service name
+// @Description Get the latest subscription of a user to a service
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID"
 // @Param service_name path string true "Service Name"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
 // @Success 200 {object} SubscriptionRes
-// @Failure 400 {object} utils.ErrorResponse
-// @Failure 404 {object} utils.ErrorResponse
-// @Failure 500 {object} utils.ErrorResponse
+// @Header 200 {string} ETag "Version of the subscription"
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/v1/subscriptions/{user_id}/{service_name} [get]
 func (h *subscriptionsApiHandler) GetSubscription(c echo.Context) error {
 	userID := c.Param("user_id")
 	serviceName := c.Param("service_name")
 	if userID == "" || serviceName == "" {
-		utils.ResponseError(c, http.StatusBadRequest, errors.New("missing user_id or service_name"))
-		return nil
+		return validationError("missing user_id or service_name")
 	}
-	sub, err := h.service.Get(userID, serviceName)
+	sub, err := h.service.Get(c.Request().Context(), userID, serviceName)
 	if err != nil {
 		if h.logger != nil {
 			h.logger.Warn("failed to get subscription",
@@ -180,57 +309,68 @@ func (h *subscriptionsApiHandler) GetSubscription(c echo.Context) error {
 				zap.String("service_name", serviceName),
 				zap.Error(err))
 		}
-		utils.ResponseError(c, http.StatusInternalServerError, err)
-		return nil
-	}
-	if sub == nil {
-		utils.ResponseError(c, http.StatusNotFound, errors.New("subscription not found"))
-		return nil
+		return err
 	}
-	res := SubscriptionRes(*sub)
+	setETag(c, *sub)
+	res := newSubscriptionRes(*sub)
 	return c.JSON(http.StatusOK, res)
 }
 
 // UpdateSubscription godoc
 // @Summary Update a subscription
-// @Description Update a subscription by user ID and service name
+// @Description Update the latest subscription of a user to a service
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID"
 // @Param service_name path string true "Service Name"
 // @Param subscription body SubscriptionUpdateReq true "Subscription update"
+// @Param If-Match header string false "ETag of the subscription version to change"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
 // @Success 200 {object} SubscriptionRes
-// @Failure 400 {object} utils.ErrorResponse
-// @Failure 500 {object} utils.ErrorResponse
+// @Header 200 {string} ETag "Version of the subscription"
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 412 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/v1/subscriptions/{user_id}/{service_name} [put]
 func (h *subscriptionsApiHandler) UpdateSubscription(c echo.Context) error {
 	userID := c.Param("user_id")
 	serviceName := c.Param("service_name")
 	if userID == "" || serviceName == "" {
-		utils.ResponseError(c, http.StatusBadRequest, errors.New("missing user_id or service_name"))
-		return nil
+		return validationError("missing user_id or service_name")
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
 	}
 	var req SubscriptionUpdateReq
 	if err := c.Bind(&req); err != nil {
-		utils.ResponseError(c, http.StatusBadRequest, err)
-		return nil
+		return err
 	}
 
 	if err := h.validate.Struct(req); err != nil {
-		utils.ResponseError(c, http.StatusBadRequest, fmt.Errorf("validation failed: %w", err))
-		return nil
+		return fmt.Errorf("%w: %w", domain.ErrValidation, err)
 	}
 
 	sub := domain.Subscription{
 		UserID:      userID,
 		ServiceName: serviceName,
 		Price:       req.Price,
+		Currency:    req.Currency,
 		StartDate:   req.StartDate,
-		EndDate:     &req.StartDate,
+		EndDate:     req.EndDate,
+
+		BillingPeriod:   req.BillingPeriod,
+		BillingInterval: req.BillingInterval,
+		Version:         version,
 	}
 
-	err := h.service.Update(&sub)
+	err = h.service.Update(c.Request().Context(), &sub)
 	if err != nil {
 		if h.logger != nil {
 			h.logger.Warn("failed to update subscription",
@@ -240,90 +380,584 @@ func (h *subscriptionsApiHandler) UpdateSubscription(c echo.Context) error {
 				zap.Any("subscription", &sub),
 				zap.Error(err))
 		}
-		utils.ResponseError(c, http.StatusInternalServerError, err)
-		return nil
+		return err
+	}
+	setETag(c, sub)
+	res := newSubscriptionRes(sub)
+	return c.JSON(http.StatusOK, res)
+}
+
+// PatchSubscription godoc
+// @Summary Partially update a subscription
+// @Description Update the given fields of the latest subscription of a user to a service using JSON Merge Patch (RFC 7396). Null end_date makes the subscription open-ended.
+// @Tags subscriptions
+// @Accept application/merge-patch+json,json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param service_name path string true "Service Name"
+// @Param subscription body SubscriptionPatchReq true "Subscription merge patch"
+// @Param If-Match header string false "ETag of the subscription version to change"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {object} SubscriptionRes
+// @Header 200 {string} ETag "Version of the subscription"
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 415 {object} utils.Problem
+// @Failure 412 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{user_id}/{service_name} [patch]
+func (h *subscriptionsApiHandler) PatchSubscription(c echo.Context) error {
+	userID := c.Param("user_id")
+	serviceName := c.Param("service_name")
+	if userID == "" || serviceName == "" {
+		return validationError("missing user_id or service_name")
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != MIMEApplicationMergePatchJSON && mediaType != echo.MIMEApplicationJSON {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, "expected "+MIMEApplicationMergePatchJSON)
+	}
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return err
+	}
+	patch, err := h.parseMergePatch(body)
+	if err != nil {
+		return err
+	}
+
+	sub, err := h.service.Patch(c.Request().Context(), userID, serviceName, version, patch)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to patch subscription",
+				zap.String("handler", "PatchSubscription"),
+				zap.String("user_id", userID),
+				zap.String("service_name", serviceName),
+				zap.Error(err))
+		}
+		return err
 	}
-	res := SubscriptionRes(sub)
+	setETag(c, *sub)
+	res := newSubscriptionRes(*sub)
 	return c.JSON(http.StatusOK, res)
 }
 
 // DeleteSubscription godoc
 // @Summary Delete a subscription
-// @Description Delete a subscription by user ID and service name
+// @Description Delete the latest subscription of a user to a service
 // @Tags subscriptions
 // @Accept json
 // @Produce json
 // @Param user_id path string true "User ID"
 // @Param service_name path string true "Service Name"
+// @Param If-Match header string false "ETag of the subscription version to change"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
 // @Success 204 {string} string "No Content"
-// @Failure 400 {object} utils.ErrorResponse
-// @Failure 500 {object} utils.ErrorResponse
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 412 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/v1/subscriptions/{user_id}/{service_name} [delete]
 func (h *subscriptionsApiHandler) DeleteSubscription(c echo.Context) error {
 	userID := c.Param("user_id")
 	serviceName := c.Param("service_name")
 	if userID == "" || serviceName == "" {
-		utils.ResponseError(c, http.StatusBadRequest, errors.New("missing user_id or service_name"))
-		return nil
+		return validationError("missing user_id or service_name")
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
 	}
-	err := h.service.Delete(userID, serviceName)
+	err = h.service.Delete(c.Request().Context(), userID, serviceName, version)
 	if err != nil {
 		if h.logger != nil {
 			h.logger.Warn("failed to delete subscription",
-				zap.String("handler", "UpdateSubscription"),
+				zap.String("handler", "DeleteSubscription"),
 				zap.String("user_id", userID),
 				zap.String("service_name", serviceName),
 				zap.Error(err))
 		}
-		utils.ResponseError(c, http.StatusInternalServerError, err)
-		return nil
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetSubscriptionByID godoc
+// @Summary Get a subscription by ID
+// @Description Get a subscription by its ID
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {object} SubscriptionRes
+// @Header 200 {string} ETag "Version of the subscription"
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{id} [get]
+func (h *subscriptionsApiHandler) GetSubscriptionByID(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.validate.Var(id, "required,uuid"); err != nil {
+		return validationError("invalid subscription id")
+	}
+	sub, err := h.service.GetByID(c.Request().Context(), id)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to get subscription",
+				zap.String("handler", "GetSubscriptionByID"),
+				zap.String("id", id),
+				zap.Error(err))
+		}
+		return err
+	}
+	setETag(c, *sub)
+	res := newSubscriptionRes(*sub)
+	return c.JSON(http.StatusOK, res)
+}
+
+// UpdateSubscriptionByID godoc
+// @Summary Update a subscription by ID
+// @Description Update a subscription by its ID
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param subscription body SubscriptionUpdateReq true "Subscription update"
+// @Param If-Match header string false "ETag of the subscription version to change"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {object} SubscriptionRes
+// @Header 200 {string} ETag "Version of the subscription"
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 412 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{id} [put]
+func (h *subscriptionsApiHandler) UpdateSubscriptionByID(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.validate.Var(id, "required,uuid"); err != nil {
+		return validationError("invalid subscription id")
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	var req SubscriptionUpdateReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrValidation, err)
+	}
+
+	sub := domain.Subscription{
+		ID:        id,
+		Price:     req.Price,
+		Currency:  req.Currency,
+		StartDate: req.StartDate,
+		EndDate:   req.EndDate,
+
+		BillingPeriod:   req.BillingPeriod,
+		BillingInterval: req.BillingInterval,
+		Version:         version,
+	}
+
+	err = h.service.Update(c.Request().Context(), &sub)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to update subscription",
+				zap.String("handler", "UpdateSubscriptionByID"),
+				zap.String("id", id),
+				zap.Any("subscription", &sub),
+				zap.Error(err))
+		}
+		return err
+	}
+	setETag(c, sub)
+	res := newSubscriptionRes(sub)
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteSubscriptionByID godoc
+// @Summary Delete a subscription by ID
+// @Description Delete a subscription by its ID
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Param If-Match header string false "ETag of the subscription version to change"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 204 {string} string "No Content"
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 412 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{id} [delete]
+func (h *subscriptionsApiHandler) DeleteSubscriptionByID(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.validate.Var(id, "required,uuid"); err != nil {
+		return validationError("invalid subscription id")
+	}
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		return err
+	}
+	err = h.service.DeleteByID(c.Request().Context(), id, version)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to delete subscription",
+				zap.String("handler", "DeleteSubscriptionByID"),
+				zap.String("id", id),
+				zap.Error(err))
+		}
+		return err
 	}
 	return c.NoContent(http.StatusNoContent)
 }
 
+// PriceHistory godoc
+// @Summary Get price history
+// @Description Get price changes of a subscription ordered by the month they take effect
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param service_name path string true "Service Name"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {array} PricePointRes
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{user_id}/{service_name}/prices [get]
+func (h *subscriptionsApiHandler) PriceHistory(c echo.Context) error {
+	userID := c.Param("user_id")
+	serviceName := c.Param("service_name")
+	if userID == "" || serviceName == "" {
+		return validationError("missing user_id or service_name")
+	}
+	prices, err := h.service.PriceHistory(c.Request().Context(), userID, serviceName)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to get price history",
+				zap.String("handler", "PriceHistory"),
+				zap.String("user_id", userID),
+				zap.String("service_name", serviceName),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	res := make([]PricePointRes, len(prices))
+	for i, p := range prices {
+		res[i] = PricePointRes(p)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// AddPrice godoc
+// @Summary Record a price change
+// @Description Record a new price of a subscription effective from the given month. The current price of the subscription follows its history.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param service_name path string true "Service Name"
+// @Param price body PriceChangeReq true "Price change"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 201 {object} PricePointRes
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{user_id}/{service_name}/prices [post]
+func (h *subscriptionsApiHandler) AddPrice(c echo.Context) error {
+	userID := c.Param("user_id")
+	serviceName := c.Param("service_name")
+	if userID == "" || serviceName == "" {
+		return validationError("missing user_id or service_name")
+	}
+	var req PriceChangeReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrValidation, err)
+	}
+
+	price := domain.PricePoint{
+		EffectiveFrom: req.EffectiveFrom,
+		Price:         req.Price,
+		Currency:      req.Currency,
+	}
+	err := h.service.AddPrice(c.Request().Context(), userID, serviceName, &price)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to add subscription price",
+				zap.String("handler", "AddPrice"),
+				zap.String("user_id", userID),
+				zap.String("service_name", serviceName),
+				zap.Any("price", &price),
+				zap.Error(err))
+		}
+		return err
+	}
+	return c.JSON(http.StatusCreated, PricePointRes(price))
+}
+
 // TotalPrice godoc
 // @Summary Get total price
-// @Description Get total price for a user's subscriptions in a date range
+// @Description Get total spend on subscriptions in a date range. All filters are optional: omit user_id to aggregate across all users and service_name to aggregate across all services.
 // @Tags subscriptions
 // @Accept json
 // @Produce json
-// @Param user_id query string true "User ID"
-// @Param service_name query string false "Service Name"
-// @Param from query string true "From date (MM-YYYY)"
-// @Param to query string true "To date (MM-YYYY)"
+// @Param user_id query string false "User ID"
+// @Param service_name query []string false "Service names" collectionFormat(multi)
+// @Param from query string false "From date (MM-YYYY)"
+// @Param to query string false "To date (MM-YYYY), defaults to the current month"
+// @Param mode query string false "Cost attribution for billing cycles longer than a month" Enums(cash, amortized) default(cash)
+// @Param currency query string false "ISO-4217 currency to report amounts in, defaults to the service reporting currency"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
 // @Success 200 {object} TotalPriceRes
-// @Failure 400 {object} utils.ErrorResponse
-// @Failure 500 {object} utils.ErrorResponse
+// @Failure 400 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
 // @Router /api/v1/subscriptions/total [get]
 func (h *subscriptionsApiHandler) TotalPrice(c echo.Context) error {
-	userID := c.QueryParam("user_id")
-	serviceName := c.QueryParam("service_name")
-	fromStr := c.QueryParam("from")
-	toStr := c.QueryParam("to")
-	if fromStr == "" || toStr == "" {
-		utils.ResponseError(c, http.StatusBadRequest, errors.New("missing from or to date"))
-		return nil
-	}
-	from, err := parseYearMonth(fromStr)
+	filter, err := h.parseCostFilter(c)
+	if err != nil {
+		return err
+	}
+
+	total, err := h.service.TotalPrice(c.Request().Context(), filter)
 	if err != nil {
-		utils.ResponseError(c, http.StatusBadRequest, errors.New("invalid from date format, expected MM-YYYY"))
-		return nil
+		if h.logger != nil {
+			h.logger.Warn("failed to calculate total price",
+				zap.String("handler", "TotalPrice"),
+				zap.Any("filter", filter),
+				zap.Error(err))
+		}
+		return err
 	}
-	to, err := parseYearMonth(toStr)
+	res := TotalPriceRes{Total: total.Amount, Currency: total.Currency}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Breakdown godoc
+// @Summary Get monthly cost breakdown
+// @Description Get spend on subscriptions for every month of a date range, split by service. Filters are the same as for the total price.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param user_id query string false "User ID"
+// @Param service_name query []string false "Service names" collectionFormat(multi)
+// @Param from query string false "From date (MM-YYYY), defaults to the earliest subscription"
+// @Param to query string false "To date (MM-YYYY), defaults to the current month"
+// @Param mode query string false "Cost attribution for billing cycles longer than a month" Enums(cash, amortized) default(cash)
+// @Param currency query string false "ISO-4217 currency to report amounts in, defaults to the service reporting currency"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {array} MonthlyCostRes
+// @Failure 400 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/breakdown [get]
+func (h *subscriptionsApiHandler) Breakdown(c echo.Context) error {
+	filter, err := h.parseCostFilter(c)
 	if err != nil {
-		utils.ResponseError(c, http.StatusBadRequest, errors.New("invalid to date format, expected MM-YYYY"))
-		return nil
+		return err
 	}
-	total, err := h.service.TotalPrice(userID, serviceName, from, to)
+
+	months, err := h.service.Breakdown(c.Request().Context(), filter)
 	if err != nil {
-		utils.ResponseError(c, http.StatusInternalServerError, err)
-		return nil
+		if h.logger != nil {
+			h.logger.Warn("failed to calculate cost breakdown",
+				zap.String("handler", "Breakdown"),
+				zap.Any("filter", filter),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	res := make([]MonthlyCostRes, len(months))
+	for i, m := range months {
+		res[i] = MonthlyCostRes{
+			Month:    m.Month,
+			Currency: m.Currency,
+			Total:    m.Total,
+			Services: make([]ServiceCostRes, len(m.Services)),
+		}
+		for j, sc := range m.Services {
+			res[i].Services[j] = ServiceCostRes(sc)
+		}
 	}
-	res := TotalPriceRes{Total: total}
 	return c.JSON(http.StatusOK, res)
 }
 
+// parseCostFilter reads the optional cost filter query parameters
+func (h *subscriptionsApiHandler) parseCostFilter(c echo.Context) (domain.CostFilter, error) {
+	filter := domain.CostFilter{
+		UserID:       c.QueryParam("user_id"),
+		ServiceNames: parseListParam(c.QueryParams()["service_name"]),
+		Mode:         domain.CostMode(c.QueryParam("mode")),
+		Currency:     strings.ToUpper(c.QueryParam("currency")),
+	}
+	if filter.Mode != "" && !filter.Mode.Valid() {
+		return filter, validationError("invalid mode, expected cash or amortized")
+	}
+	if filter.Currency != "" && h.validate.Var(filter.Currency, "iso4217") != nil {
+		return filter, validationError("invalid currency, expected ISO-4217 code")
+	}
+
+	var err error
+	if fromStr := c.QueryParam("from"); fromStr != "" {
+		filter.From, err = parseYearMonth(fromStr)
+		if err != nil {
+			return filter, validationError("invalid from date format, expected MM-YYYY")
+		}
+	}
+	if toStr := c.QueryParam("to"); toStr != "" {
+		filter.To, err = parseYearMonth(toStr)
+		if err != nil {
+			return filter, validationError("invalid to date format, expected MM-YYYY")
+		}
+	}
+	if from, to := filter.Period(); from.After(to) {
+		return filter, validationError("from date is after to date")
+	}
+	return filter, nil
+}
+
+// parseListParam flattens repeated and comma separated query values, dropping empty items
+func parseListParam(values []string) []string {
+	var res []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				res = append(res, item)
+			}
+		}
+	}
+	return res
+}
+
 // parseYearMonth parses a string in MM-YYYY format to time.Time (first day of month)
 func parseYearMonth(s string) (time.Time, error) {
 	return time.Parse("01-2006", s)
 }
+
+// parseListFilter parses query parameters of subscription listings
+func (h *subscriptionsApiHandler) parseListFilter(c echo.Context) (domain.ListFilter, error) {
+	filter := domain.ListFilter{
+		UserID:            c.QueryParam("user_id"),
+		ServiceNamePrefix: c.QueryParam("service_prefix"),
+		Status:            domain.SubscriptionStatus(c.QueryParam("status")),
+		Limit:             defaultListLimit,
+	}
+	// Authenticated callers get the users they may read when none is given.
+	if filter.UserID == "" && callerID(c) == "" {
+		return filter, validationError("missing user_id")
+	}
+
+	if l := c.QueryParam("limit"); l != "" {
+		if v, err := strconv.Atoi(l); err == nil && v > 0 {
+			filter.Limit = min(v, maxListLimit)
+		}
+	}
+	if o := c.QueryParam("offset"); o != "" {
+		if v, err := strconv.Atoi(o); err == nil && v >= 0 {
+			filter.Offset = v
+		}
+	}
+
+	var err error
+	if filter.Sort, err = domain.ParseListSort(c.QueryParam("sort")); err != nil {
+		return filter, err
+	}
+	if cursor := c.QueryParam("cursor"); cursor != "" {
+		after, err := domain.DecodeCursor(cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = &after
+	}
+	if filter.Status != "" && !filter.Status.Valid() {
+		return filter, validationError("invalid status, expected active, ended or upcoming")
+	}
+	if activeAt := c.QueryParam("active_at"); activeAt != "" {
+		filter.ActiveAt, err = parseYearMonth(activeAt)
+		if err != nil {
+			return filter, validationError("invalid active_at date format, expected MM-YYYY")
+		}
+	}
+	if filter.MinPrice, err = parsePriceParam(c, "min_price"); err != nil {
+		return filter, err
+	}
+	if filter.MaxPrice, err = parsePriceParam(c, "max_price"); err != nil {
+		return filter, err
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return filter, validationError("min_price is greater than max_price")
+	}
+	return filter, nil
+}
+
+// parsePriceParam parses an optional non-negative price query parameter
+func parsePriceParam(c echo.Context, name string) (*int, error) {
+	s := c.QueryParam(name)
+	if s == "" {
+		return nil, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		return nil, validationError(fmt.Sprintf("invalid %s, expected non-negative integer", name))
+	}
+	return &v, nil
+}
+
+// nextPageURL returns the URL of the request continued at the cursor
+func nextPageURL(c echo.Context, cursor string) string {
+	u := *c.Request().URL
+	query := u.Query()
+	query.Del("offset")
+	query.Set("cursor", cursor)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
@@ -2,51 +2,111 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/alexputin/subscriptions/internal/domain"
 	"github.com/alexputin/subscriptions/internal/handlers"
+	"github.com/alexputin/subscriptions/internal/repositories"
+	"github.com/alexputin/subscriptions/internal/services"
+	"github.com/alexputin/subscriptions/internal/utils"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockService struct {
-	CreateFunc     func(sub *domain.Subscription) error
-	GetFunc        func(userID, serviceName string) (*domain.Subscription, error)
-	UpdateFunc     func(sub *domain.Subscription) error
-	DeleteFunc     func(userID, serviceName string) error
-	ListFunc       func(userID string, limit, offset int) ([]domain.Subscription, error)
-	TotalPriceFunc func(userID, serviceName string, from, to time.Time) (int, error)
+	CreateFunc       func(ctx context.Context, sub *domain.Subscription) error
+	GetFunc          func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error)
+	GetByIDFunc      func(ctx context.Context, id string) (*domain.Subscription, error)
+	UpdateFunc       func(ctx context.Context, sub *domain.Subscription) error
+	PatchFunc        func(ctx context.Context, userID, serviceName string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error)
+	DeleteFunc       func(ctx context.Context, userID, serviceName string, version int) error
+	DeleteByIDFunc   func(ctx context.Context, id string, version int) error
+	ListFunc         func(ctx context.Context, filter domain.ListFilter) (domain.SubscriptionPage, error)
+	CountFunc        func(ctx context.Context, filter domain.ListFilter) (int, error)
+	TotalPriceFunc   func(ctx context.Context, filter domain.CostFilter) (domain.Money, error)
+	BreakdownFunc    func(ctx context.Context, filter domain.CostFilter) ([]domain.MonthlyCost, error)
+	PriceHistoryFunc func(ctx context.Context, userID, serviceName string) ([]domain.PricePoint, error)
+	AddPriceFunc     func(ctx context.Context, userID, serviceName string, price *domain.PricePoint) error
+	MembersFunc      func(ctx context.Context, userID, serviceName string) ([]domain.Member, error)
+	SetMembersFunc   func(ctx context.Context, userID, serviceName string, members []domain.Member) error
+	SettlementFunc   func(ctx context.Context, filter domain.CostFilter) (domain.Settlement, error)
 }
 
-func (m *mockService) Create(sub *domain.Subscription) error {
-	return m.CreateFunc(sub)
+func (m *mockService) Create(ctx context.Context, sub *domain.Subscription) error {
+	return m.CreateFunc(ctx, sub)
 }
-func (m *mockService) Get(userID, serviceName string) (*domain.Subscription, error) {
-	return m.GetFunc(userID, serviceName)
+func (m *mockService) Get(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+	return m.GetFunc(ctx, userID, serviceName)
 }
-func (m *mockService) Update(sub *domain.Subscription) error {
-	return m.UpdateFunc(sub)
+func (m *mockService) GetByID(ctx context.Context, id string) (*domain.Subscription, error) {
+	return m.GetByIDFunc(ctx, id)
 }
-func (m *mockService) Delete(userID, serviceName string) error {
-	return m.DeleteFunc(userID, serviceName)
+func (m *mockService) Update(ctx context.Context, sub *domain.Subscription) error {
+	return m.UpdateFunc(ctx, sub)
 }
-func (m *mockService) List(userID string, limit, offset int) ([]domain.Subscription, error) {
-	return m.ListFunc(userID, limit, offset)
+func (m *mockService) Patch(ctx context.Context, userID, serviceName string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+	return m.PatchFunc(ctx, userID, serviceName, version, patch)
 }
-func (m *mockService) TotalPrice(userID, serviceName string, from, to time.Time) (int, error) {
-	return m.TotalPriceFunc(userID, serviceName, from, to)
+func (m *mockService) Delete(ctx context.Context, userID, serviceName string, version int) error {
+	return m.DeleteFunc(ctx, userID, serviceName, version)
+}
+func (m *mockService) DeleteByID(ctx context.Context, id string, version int) error {
+	return m.DeleteByIDFunc(ctx, id, version)
+}
+func (m *mockService) List(ctx context.Context, filter domain.ListFilter) (domain.SubscriptionPage, error) {
+	return m.ListFunc(ctx, filter)
+}
+func (m *mockService) Count(ctx context.Context, filter domain.ListFilter) (int, error) {
+	return m.CountFunc(ctx, filter)
+}
+func (m *mockService) TotalPrice(ctx context.Context, filter domain.CostFilter) (domain.Money, error) {
+	return m.TotalPriceFunc(ctx, filter)
+}
+func (m *mockService) Breakdown(ctx context.Context, filter domain.CostFilter) ([]domain.MonthlyCost, error) {
+	return m.BreakdownFunc(ctx, filter)
+}
+func (m *mockService) PriceHistory(ctx context.Context, userID, serviceName string) ([]domain.PricePoint, error) {
+	return m.PriceHistoryFunc(ctx, userID, serviceName)
+}
+func (m *mockService) AddPrice(ctx context.Context, userID, serviceName string, price *domain.PricePoint) error {
+	return m.AddPriceFunc(ctx, userID, serviceName, price)
+}
+func (m *mockService) Members(ctx context.Context, userID, serviceName string) ([]domain.Member, error) {
+	return m.MembersFunc(ctx, userID, serviceName)
+}
+func (m *mockService) SetMembers(ctx context.Context, userID, serviceName string, members []domain.Member) error {
+	return m.SetMembersFunc(ctx, userID, serviceName, members)
+}
+func (m *mockService) Settlement(ctx context.Context, filter domain.CostFilter) (domain.Settlement, error) {
+	return m.SettlementFunc(ctx, filter)
 }
 
-func TestCreateSubscription(t *testing.T) {
+// newEcho creates an echo instance rendering errors like the server does
+func newEcho() *echo.Echo {
 	e := echo.New()
+	e.HTTPErrorHandler = handlers.NewHTTPErrorHandler(nil)
+	return e
+}
+
+// serve runs the handler and renders a returned error
+func serve(e *echo.Echo, c echo.Context, handler echo.HandlerFunc) {
+	if err := handler(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+}
+
+func TestCreateSubscription(t *testing.T) {
+	e := newEcho()
 	ms := &mockService{
-		CreateFunc: func(sub *domain.Subscription) error {
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
 			if sub.UserID == "fail" {
 				return errors.New("fail")
 			}
@@ -67,15 +127,15 @@ func TestCreateSubscription(t *testing.T) {
 	w := httptest.NewRecorder()
 	c := e.NewContext(req, w)
 
-	_ = h.CreateSubscription(c)
+	serve(e, c, h.CreateSubscription)
 	assert.Equal(t, http.StatusCreated, w.Code)
 }
 
 func TestGetSubscription_NotFound(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		GetFunc: func(userID, serviceName string) (*domain.Subscription, error) {
-			return nil, nil
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return nil, fmt.Errorf("failed to get subscription: %w", domain.ErrNotFound)
 		},
 	}
 	h := handlers.NewSubscriptionsApiHandler(ms, nil)
@@ -86,15 +146,15 @@ func TestGetSubscription_NotFound(t *testing.T) {
 	c.SetParamNames("user_id", "service_name")
 	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
 
-	_ = h.GetSubscription(c)
+	serve(e, c, h.GetSubscription)
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
 func TestListSubscriptions(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		ListFunc: func(userID string, limit, offset int) ([]domain.Subscription, error) {
-			return []domain.Subscription{{UserID: "550e8400-e29b-41d4-a716-446655440000", ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Now()}}}, nil
+		ListFunc: func(ctx context.Context, filter domain.ListFilter) (domain.SubscriptionPage, error) {
+			return domain.SubscriptionPage{Items: []domain.Subscription{{UserID: "550e8400-e29b-41d4-a716-446655440000", ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Now()}}}}, nil
 		},
 	}
 	h := handlers.NewSubscriptionsApiHandler(ms, nil)
@@ -102,15 +162,15 @@ func TestListSubscriptions(t *testing.T) {
 	w := httptest.NewRecorder()
 	c := e.NewContext(req, w)
 
-	_ = h.ListSubscriptions(c)
+	serve(e, c, h.ListSubscriptions)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
 func TestTotalPrice(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		TotalPriceFunc: func(userID, serviceName string, from, to time.Time) (int, error) {
-			return 1500, nil
+		TotalPriceFunc: func(ctx context.Context, filter domain.CostFilter) (domain.Money, error) {
+			return domain.Money{Amount: 1500, Currency: "RUB"}, nil
 		},
 	}
 	h := handlers.NewSubscriptionsApiHandler(ms, nil)
@@ -118,14 +178,62 @@ func TestTotalPrice(t *testing.T) {
 	w := httptest.NewRecorder()
 	c := e.NewContext(req, w)
 
-	_ = h.TotalPrice(c)
+	serve(e, c, h.TotalPrice)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
+func TestTotalPrice_OptionalFilters(t *testing.T) {
+	e := newEcho()
+	var got domain.CostFilter
+	ms := &mockService{
+		TotalPriceFunc: func(ctx context.Context, filter domain.CostFilter) (domain.Money, error) {
+			got = filter
+			return domain.Money{Amount: 3000, Currency: "USD"}, nil
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/total?service_name=Netflix,Spotify&service_name=YouTube&to=12-2025&currency=usd", nil)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+
+	serve(e, c, h.TotalPrice)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, got.UserID)
+	assert.Equal(t, []string{"Netflix", "Spotify", "YouTube"}, got.ServiceNames)
+	assert.True(t, got.From.IsZero())
+	assert.Equal(t, time.Date(2025, time.December, 1, 0, 0, 0, 0, time.UTC), got.To)
+	assert.Equal(t, "USD", got.Currency)
+	assert.JSONEq(t, `{"total":3000,"currency":"USD"}`, w.Body.String())
+}
+
+func TestBreakdown(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		BreakdownFunc: func(ctx context.Context, filter domain.CostFilter) ([]domain.MonthlyCost, error) {
+			return []domain.MonthlyCost{
+				{
+					Month:    domain.ShortDate{Time: filter.From},
+					Currency: "RUB",
+					Total:    800,
+					Services: []domain.ServiceCost{{ServiceName: "Netflix", Total: 500}, {ServiceName: "Spotify", Total: 300}},
+				},
+			}, nil
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/breakdown?user_id=550e8400-e29b-41d4-a716-446655440000&from=01-2025&to=01-2025", nil)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+
+	serve(e, c, h.Breakdown)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"month":"01-2025","currency":"RUB","total":800,"services":[{"service_name":"Netflix","total":500},{"service_name":"Spotify","total":300}]}]`, w.Body.String())
+}
+
 func TestUpdateSubscription(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		UpdateFunc: func(sub *domain.Subscription) error {
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
 			if sub.UserID == "fail" {
 				return errors.New("fail")
 			}
@@ -146,14 +254,14 @@ func TestUpdateSubscription(t *testing.T) {
 	c.SetParamNames("user_id", "service_name")
 	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
 
-	_ = h.UpdateSubscription(c)
+	serve(e, c, h.UpdateSubscription)
 	assert.Equal(t, http.StatusOK, w.Code)
 }
 
 func TestUpdateSubscription_Error(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		UpdateFunc: func(sub *domain.Subscription) error {
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
 			return errors.New("fail")
 		},
 	}
@@ -171,14 +279,14 @@ func TestUpdateSubscription_Error(t *testing.T) {
 	c.SetParamNames("user_id", "service_name")
 	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
 
-	_ = h.UpdateSubscription(c)
+	serve(e, c, h.UpdateSubscription)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
 func TestDeleteSubscription(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		DeleteFunc: func(userID, serviceName string) error {
+		DeleteFunc: func(ctx context.Context, userID, serviceName string, version int) error {
 			if userID == "fail" {
 				return errors.New("fail")
 			}
@@ -193,14 +301,14 @@ func TestDeleteSubscription(t *testing.T) {
 	c.SetParamNames("user_id", "service_name")
 	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
 
-	_ = h.DeleteSubscription(c)
+	serve(e, c, h.DeleteSubscription)
 	assert.Equal(t, http.StatusNoContent, w.Code)
 }
 
 func TestDeleteSubscription_Error(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		DeleteFunc: func(userID, serviceName string) error {
+		DeleteFunc: func(ctx context.Context, userID, serviceName string, version int) error {
 			return errors.New("fail")
 		},
 	}
@@ -212,14 +320,14 @@ func TestDeleteSubscription_Error(t *testing.T) {
 	c.SetParamNames("user_id", "service_name")
 	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
 
-	_ = h.DeleteSubscription(c)
+	serve(e, c, h.DeleteSubscription)
 	assert.Equal(t, http.StatusInternalServerError, w.Code)
 }
 
 func TestCreateSubscription_ValidationError(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		CreateFunc: func(sub *domain.Subscription) error {
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
 			return nil
 		},
 	}
@@ -236,14 +344,14 @@ func TestCreateSubscription_ValidationError(t *testing.T) {
 	w := httptest.NewRecorder()
 	c := e.NewContext(req, w)
 
-	_ = h.CreateSubscription(c)
+	serve(e, c, h.CreateSubscription)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 func TestUpdateSubscription_ValidationError(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		UpdateFunc: func(sub *domain.Subscription) error {
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
 			return nil
 		},
 	}
@@ -260,14 +368,14 @@ func TestUpdateSubscription_ValidationError(t *testing.T) {
 	c.SetParamNames("user_id", "service_name")
 	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
 
-	_ = h.UpdateSubscription(c)
+	serve(e, c, h.UpdateSubscription)
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 func TestTotalPrice_InvalidDateFormat(t *testing.T) {
-	e := echo.New()
+	e := newEcho()
 	ms := &mockService{
-		TotalPriceFunc: func(userID, serviceName string, from, to time.Time) (int, error) {
-			return 0, nil
+		TotalPriceFunc: func(ctx context.Context, filter domain.CostFilter) (domain.Money, error) {
+			return domain.Money{}, nil
 		},
 	}
 	h := handlers.NewSubscriptionsApiHandler(ms, nil)
@@ -275,6 +383,1089 @@ func TestTotalPrice_InvalidDateFormat(t *testing.T) {
 	w := httptest.NewRecorder()
 	c := e.NewContext(req, w)
 
-	_ = h.TotalPrice(c)
+	serve(e, c, h.TotalPrice)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"detail":"invalid from date format, expected MM-YYYY"`)
+}
+
+func TestTotalPrice_FromAfterTo(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/total?from=12-2025&to=01-2025", nil)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+
+	serve(e, c, h.TotalPrice)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateSubscription_InvalidBillingPeriod(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			return nil
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	body := map[string]interface{}{
+		"user_id":        "550e8400-e29b-41d4-a716-446655440000",
+		"service_name":   "Netflix",
+		"price":          500,
+		"start_date":     "07-2025",
+		"billing_period": "daily",
+	}
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", bytes.NewReader(b))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+
+	serve(e, c, h.CreateSubscription)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPriceHistory(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		PriceHistoryFunc: func(ctx context.Context, userID, serviceName string) ([]domain.PricePoint, error) {
+			return []domain.PricePoint{
+				{EffectiveFrom: domain.ShortDate{Time: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}, Price: 49900, Currency: "RUB"},
+				{EffectiveFrom: domain.ShortDate{Time: time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)}, Price: 69900, Currency: "RUB"},
+			}, nil
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix/prices", nil)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+	c.SetParamNames("user_id", "service_name")
+	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
+
+	serve(e, c, h.PriceHistory)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"effective_from":"01-2025","price":49900,"currency":"RUB"},{"effective_from":"03-2025","price":69900,"currency":"RUB"}]`, w.Body.String())
+}
+
+func TestPriceHistory_NotFound(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		PriceHistoryFunc: func(ctx context.Context, userID, serviceName string) ([]domain.PricePoint, error) {
+			return nil, fmt.Errorf("failed to get subscription: %w", domain.ErrNotFound)
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix/prices", nil)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+	c.SetParamNames("user_id", "service_name")
+	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
+
+	serve(e, c, h.PriceHistory)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAddPrice(t *testing.T) {
+	e := newEcho()
+	var got domain.PricePoint
+	ms := &mockService{
+		AddPriceFunc: func(ctx context.Context, userID, serviceName string, price *domain.PricePoint) error {
+			got = *price
+			return nil
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	body := map[string]interface{}{
+		"price":          69900,
+		"effective_from": "03-2025",
+	}
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix/prices", bytes.NewReader(b))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+	c.SetParamNames("user_id", "service_name")
+	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
+
+	serve(e, c, h.AddPrice)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 69900, got.Price)
+	assert.Equal(t, time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC), got.EffectiveFrom.Time)
+}
+
+func TestAddPrice_DefaultCurrency(t *testing.T) {
+	const userID = "550e8400-e29b-41d4-a716-446655440000"
+	subs := repositories.NewMemoryUserSubscriptionRepository()
+	users := repositories.NewMemoryUserRepository(subs)
+	assert.NoError(t, users.Create(context.Background(), &domain.User{ID: userID, Currency: "USD", Timezone: domain.DefaultTimezone}))
+	assert.NoError(t, subs.Create(context.Background(), &domain.Subscription{UserID: userID, ServiceName: "Netflix", Price: 999, Currency: "USD", StartDate: domain.ShortDate{Time: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}, BillingPeriod: domain.BillingMonthly, BillingInterval: 1}))
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(services.NewUserSubscriptionService(subs, nil, nil, "RUB"), nil).RegisterRoutes(e)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions/"+userID+"/Netflix/prices", strings.NewReader(`{"price":1299,"effective_from":"03-2025"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var res handlers.PricePointRes
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, "USD", res.Currency)
+	assert.Equal(t, 1299, res.Price)
+}
+
+func TestSubscriptionByID_Routes(t *testing.T) {
+	const id = "3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a"
+	e := newEcho()
+	var deleted, byKey string
+	ms := &mockService{
+		GetByIDFunc: func(ctx context.Context, gotID string) (*domain.Subscription, error) {
+			return &domain.Subscription{ID: gotID, UserID: "550e8400-e29b-41d4-a716-446655440000", ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Now()}}, nil
+		},
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			byKey = userID + "/" + serviceName
+			return &domain.Subscription{ID: id, UserID: userID, ServiceName: serviceName}, nil
+		},
+		DeleteByIDFunc: func(ctx context.Context, gotID string, version int) error {
+			deleted = gotID
+			return nil
+		},
+	}
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+id, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var res handlers.SubscriptionRes
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	assert.Equal(t, id, res.ID)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000/Netflix", byKey)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/subscriptions/"+id, nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, id, deleted)
+
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/not-a-uuid", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUpdateSubscriptionByID(t *testing.T) {
+	e := newEcho()
+	var got domain.Subscription
+	ms := &mockService{
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			got = *sub
+			return nil
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	body := map[string]interface{}{
+		"price":      600,
+		"start_date": "07-2025",
+		"end_date":   "12-2025",
+	}
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a", bytes.NewReader(b))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+	c.SetParamNames("id")
+	c.SetParamValues("3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a")
+
+	serve(e, c, h.UpdateSubscriptionByID)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a", got.ID)
+	if assert.NotNil(t, got.EndDate) {
+		assert.Equal(t, time.December, got.EndDate.Month())
+	}
+}
+
+func TestCreateSubscription_Conflict(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			return fmt.Errorf("failed to create subscription: %w", domain.ErrConflict)
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	body := map[string]interface{}{
+		"user_id":      "550e8400-e29b-41d4-a716-446655440000",
+		"service_name": "Netflix",
+		"price":        500,
+		"start_date":   "07-2025",
+	}
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", bytes.NewReader(b))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+
+	serve(e, c, h.CreateSubscription)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestDeleteSubscription_NotFound(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		DeleteByIDFunc: func(ctx context.Context, id string, version int) error {
+			return fmt.Errorf("failed to delete subscription: %w", domain.ErrNotFound)
+		},
+	}
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/v1/subscriptions/3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, "application/problem+json", w.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, `{
+		"type":"urn:problem-type:not_found",
+		"title":"Not Found",
+		"status":404,
+		"detail":"resource not found",
+		"code":"not_found"
+	}`, w.Body.String())
+}
+
+func TestProblemDetailsAreClientSafe(t *testing.T) {
+	driverErr := errors.New(`pq: insert or update on table "subscriptions" violates foreign key constraint "subscriptions_user_fkey"`)
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		detail string
+	}{
+		{"not found", fmt.Errorf("failed to update subscription: %w: %w", domain.ErrNotFound, driverErr), http.StatusNotFound, "resource not found"},
+		{"conflict", fmt.Errorf("failed to update subscription: %w: %w", domain.ErrConflict, driverErr), http.StatusConflict, "resource already exists"},
+		{"validation", fmt.Errorf("failed to update subscription: %w: %w", domain.ErrValidation, driverErr), http.StatusBadRequest, "invalid request"},
+		{"forbidden", fmt.Errorf("%w: owner may not write subscriptions of someone", domain.ErrForbidden), http.StatusForbidden, "not allowed to access the resource"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newEcho()
+			ms := &mockService{
+				UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+					return tt.err
+				},
+			}
+			handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a", strings.NewReader(`{"price":500,"start_date":"07-2025"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			w := httptest.NewRecorder()
+			e.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			var problem utils.Problem
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+			assert.Equal(t, tt.detail, problem.Detail)
+		})
+	}
+}
+
+func TestTotalPrice_UnknownCurrency(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		TotalPriceFunc: func(ctx context.Context, filter domain.CostFilter) (domain.Money, error) {
+			return domain.Money{}, fmt.Errorf("%w: XYZ", domain.ErrRateNotFound)
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/total?currency=USD", nil)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+
+	serve(e, c, h.TotalPrice)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateSubscription_FieldErrors(t *testing.T) {
+	e := newEcho()
+	h := handlers.NewSubscriptionsApiHandler(&mockService{}, nil)
+	body := map[string]interface{}{
+		"user_id":      "not-a-uuid",
+		"service_name": "N",
+		"price":        -1,
+		"currency":     "XXX1",
+		"start_date":   "07-2025",
+	}
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", bytes.NewReader(b))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+
+	serve(e, c, h.CreateSubscription)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{
+		"type":"urn:problem-type:validation_failed",
+		"title":"Bad Request",
+		"status":400,
+		"detail":"request validation failed",
+		"code":"validation_failed",
+		"errors":[
+			{"field":"user_id","code":"uuid4","message":"must be a valid UUID"},
+			{"field":"service_name","code":"min","message":"must be at least 2 characters long"},
+			{"field":"price","code":"min","message":"must be at least 0"},
+			{"field":"currency","code":"iso4217","message":"must be an ISO-4217 currency code"}
+		]
+	}`, w.Body.String())
+}
+
+func TestInternalErrorIsNotExposed(t *testing.T) {
+	e := newEcho()
+	ms := &mockService{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Subscription, error) {
+			return nil, errors.New("pq: connection refused")
+		},
+	}
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.NotContains(t, w.Body.String(), "connection refused")
+	assert.Contains(t, w.Body.String(), `"code":"internal_error"`)
+}
+
+func TestUpdateSubscription_KeepsEndDate(t *testing.T) {
+	e := newEcho()
+	var got *domain.Subscription
+	ms := &mockService{
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			got = sub
+			return nil
+		},
+	}
+	h := handlers.NewSubscriptionsApiHandler(ms, nil)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix",
+		bytes.NewReader([]byte(`{"price":600,"start_date":"07-2025"}`)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	w := httptest.NewRecorder()
+	c := e.NewContext(req, w)
+	c.SetParamNames("user_id", "service_name")
+	c.SetParamValues("550e8400-e29b-41d4-a716-446655440000", "Netflix")
+
+	serve(e, c, h.UpdateSubscription)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, got.EndDate)
+}
+
+func patchSubscription(t *testing.T, ms *mockService, contentType, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+	req := httptest.NewRequest(http.MethodPatch, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix", bytes.NewReader([]byte(body)))
+	req.Header.Set(echo.HeaderContentType, contentType)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	return w
+}
+
+func TestPatchSubscription(t *testing.T) {
+	var got domain.SubscriptionPatch
+	ms := &mockService{
+		PatchFunc: func(ctx context.Context, userID, serviceName string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+			assert.Equal(t, "550e8400-e29b-41d4-a716-446655440000", userID)
+			assert.Equal(t, "Netflix", serviceName)
+			got = patch
+			sub := &domain.Subscription{UserID: userID, ServiceName: serviceName, Price: 500, StartDate: domain.ShortDate{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}}
+			patch.Apply(sub)
+			return sub, nil
+		},
+	}
+
+	w := patchSubscription(t, ms, handlers.MIMEApplicationMergePatchJSON, `{"end_date":"12-2025"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, got.Price)
+	assert.Nil(t, got.StartDate)
+	assert.False(t, got.ClearEndDate)
+	if assert.NotNil(t, got.EndDate) {
+		assert.Equal(t, time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC), got.EndDate.Time)
+	}
+	assert.Contains(t, w.Body.String(), `"end_date":"12-2025"`)
+
+	w = patchSubscription(t, ms, echo.MIMEApplicationJSON, `{"price":700,"end_date":null,"billing_period":null}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, got.ClearEndDate)
+	assert.Nil(t, got.EndDate)
+	if assert.NotNil(t, got.Price) {
+		assert.Equal(t, 700, *got.Price)
+	}
+	if assert.NotNil(t, got.BillingPeriod) {
+		assert.Equal(t, domain.BillingMonthly, *got.BillingPeriod)
+	}
+}
+
+func TestPatchSubscription_InvalidFields(t *testing.T) {
+	w := patchSubscription(t, &mockService{}, handlers.MIMEApplicationMergePatchJSON,
+		`{"price":null,"start_date":"2025-07","user_id":"x","color":"red"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{
+		"type":"urn:problem-type:validation_failed",
+		"title":"Bad Request",
+		"status":400,
+		"detail":"request validation failed",
+		"code":"validation_failed",
+		"errors":[
+			{"field":"price","code":"required","message":"cannot be null"},
+			{"field":"start_date","code":"type","message":"has an invalid value"},
+			{"field":"color","code":"unknown","message":"is not a known field"},
+			{"field":"user_id","code":"read_only","message":"cannot be changed"}
+		]
+	}`, w.Body.String())
+
+	w = patchSubscription(t, &mockService{}, handlers.MIMEApplicationMergePatchJSON, `{"billing_interval":0}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"billing_interval"`)
+
+	w = patchSubscription(t, &mockService{}, handlers.MIMEApplicationMergePatchJSON, `[]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPatchSubscription_UnsupportedMediaType(t *testing.T) {
+	w := patchSubscription(t, &mockService{}, "text/plain", `{"price":700}`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestGetSubscription_ETag(t *testing.T) {
+	ms := &mockService{
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return &domain.Subscription{UserID: userID, ServiceName: serviceName, Version: 3}, nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+}
+
+func TestUpdateSubscription_IfMatch(t *testing.T) {
+	ms := &mockService{
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			if sub.Version != 3 {
+				return fmt.Errorf("failed to update subscription: %w", domain.ErrVersionMismatch)
+			}
+			sub.Version++
+			return nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	update := func(ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix",
+			bytes.NewReader([]byte(`{"price":600,"start_date":"07-2025"}`)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("If-Match", ifMatch)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update(`"3"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	w = update(`"2"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"precondition_failed"`)
+
+	w = update(`W/"3"`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+}
+
+func TestDeleteSubscription_IfMatch(t *testing.T) {
+	var got int
+	ms := &mockService{
+		DeleteFunc: func(ctx context.Context, userID, serviceName string, version int) error {
+			got = version
+			return nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix", nil)
+	req.Header.Set("If-Match", `"7"`)
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 7, got)
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/subscriptions/550e8400-e29b-41d4-a716-446655440000/Netflix", nil)
+	req.Header.Set("If-Match", "*")
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, 0, got)
+}
+
+func TestCreateSubscription_IdempotencyKey(t *testing.T) {
+	calls := 0
+	ms := &mockService{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			calls++
+			sub.ID = fmt.Sprintf("id-%d", calls)
+			sub.Version = 1
+			return nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).
+		WithIdempotency(repositories.NewMemoryIdempotencyStore(), time.Hour).
+		RegisterRoutes(e)
+
+	create := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", bytes.NewReader([]byte(body)))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+	body := `{"user_id":"550e8400-e29b-41d4-a716-446655440000","service_name":"Netflix","price":500,"start_date":"07-2025"}`
+
+	first := create("key-1", body)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retry := create("key-1", body)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, `"1"`, retry.Header().Get("ETag"))
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+
+	reused := create("key-1", strings.Replace(body, "500", "600", 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Contains(t, reused.Body.String(), `"code":"idempotency_key_reused"`)
+	assert.Equal(t, 1, calls)
+
+	other := create("key-2", body)
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.Equal(t, 2, calls)
+}
+
+func TestCreateSubscription_IdempotencyKeyInProgress(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	calls := 0
+	ms := &mockService{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			calls++
+			if calls == 1 {
+				close(entered)
+				<-release
+			}
+			sub.ID = "id-1"
+			sub.Version = 1
+			return nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).
+		WithIdempotency(repositories.NewMemoryIdempotencyStore(), time.Hour).
+		RegisterRoutes(e)
+
+	create := func() *httptest.ResponseRecorder {
+		body := `{"user_id":"550e8400-e29b-41d4-a716-446655440000","service_name":"Netflix","price":500,"start_date":"07-2025"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Idempotency-Key", "key-1")
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- create() }()
+	<-entered
+
+	duplicate := create()
+	assert.Equal(t, http.StatusConflict, duplicate.Code)
+	assert.Contains(t, duplicate.Body.String(), `"code":"request_in_progress"`)
+	assert.Equal(t, "1", duplicate.Header().Get("Retry-After"))
+
+	close(release)
+	first := <-done
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retry := create()
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 1, calls)
+}
+
+func TestCreateSubscription_IdempotencyKeyReleasedOnServerError(t *testing.T) {
+	calls := 0
+	ms := &mockService{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			calls++
+			if calls == 1 {
+				return errors.New("connection reset")
+			}
+			sub.ID = "id-1"
+			sub.Version = 1
+			return nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).
+		WithIdempotency(repositories.NewMemoryIdempotencyStore(), time.Hour).
+		RegisterRoutes(e)
+
+	create := func() *httptest.ResponseRecorder {
+		body := `{"user_id":"550e8400-e29b-41d4-a716-446655440000","service_name":"Netflix","price":500,"start_date":"07-2025"}`
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("Idempotency-Key", "key-1")
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	failed := create()
+	assert.Equal(t, http.StatusInternalServerError, failed.Code)
+
+	retry := create()
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Empty(t, retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, 2, calls)
+}
+
+func TestListSubscriptions_FiltersAndCursor(t *testing.T) {
+	cursor := domain.Cursor{Sort: domain.SortByPrice, Desc: true, Value: "500", ID: "3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a"}
+	var got domain.ListFilter
+	ms := &mockService{
+		ListFunc: func(ctx context.Context, filter domain.ListFilter) (domain.SubscriptionPage, error) {
+			got = filter
+			return domain.SubscriptionPage{
+				Items:      []domain.Subscription{{ID: cursor.ID, ServiceName: "Netflix", Price: 500}},
+				NextCursor: "next",
+			}, nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?user_id=u1&limit=1&offset=5&sort=-price&cursor="+cursor.Encode()+
+		"&active_at=03-2025&min_price=100&max_price=1000&service_prefix=net&status=active", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "u1", got.UserID)
+	assert.Equal(t, 1, got.Limit)
+	assert.Equal(t, domain.ListSort{Field: domain.SortByPrice, Desc: true}, got.Sort)
+	assert.Equal(t, &cursor, got.After)
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), got.ActiveAt)
+	assert.Equal(t, 100, *got.MinPrice)
+	assert.Equal(t, 1000, *got.MaxPrice)
+	assert.Equal(t, "net", got.ServiceNamePrefix)
+	assert.Equal(t, domain.StatusActive, got.Status)
+
+	assert.Equal(t, "next", w.Header().Get("X-Next-Cursor"))
+	link := w.Header().Get("Link")
+	assert.Contains(t, link, "cursor=next")
+	assert.NotContains(t, link, "offset=")
+	assert.Contains(t, link, `rel="next"`)
+}
+
+func TestListSubscriptions_InvalidParams(t *testing.T) {
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(&mockService{}, nil).RegisterRoutes(e)
+
+	for _, query := range []string{
+		"",
+		"user_id=u1&sort=name",
+		"user_id=u1&cursor=garbage",
+		"user_id=u1&status=paused",
+		"user_id=u1&active_at=2025-03",
+		"user_id=u1&min_price=-1",
+		"user_id=u1&min_price=500&max_price=100",
+	} {
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestListSubscriptionsV2(t *testing.T) {
+	ms := &mockService{
+		ListFunc: func(ctx context.Context, filter domain.ListFilter) (domain.SubscriptionPage, error) {
+			return domain.SubscriptionPage{
+				Items:      []domain.Subscription{{ID: "id-3", UserID: filter.UserID, ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}}},
+				NextCursor: "next",
+			}, nil
+		},
+		CountFunc: func(ctx context.Context, filter domain.ListFilter) (int, error) {
+			assert.Equal(t, "netf", filter.ServiceNamePrefix)
+			return 12, nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/subscriptions?user_id=u1&limit=1&offset=2&service_prefix=netf", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"items":[{"id":"id-3","user_id":"u1","service_name":"Netflix","price":500,"currency":"","start_date":"01-2025","billing_period":"","billing_interval":0,"version":0}],
+		"total":12,
+		"limit":1,
+		"offset":2,
+		"next_cursor":"next"
+	}`, w.Body.String())
+
+	cursor := domain.Cursor{Sort: domain.SortByServiceName, Value: "Netflix", ID: "id-3"}
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v2/subscriptions?user_id=u1&limit=1&service_prefix=netf&cursor="+cursor.Encode(), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"offset"`)
+}
+
+func TestGetSubscriptionByID_Timeout(t *testing.T) {
+	type ctxKey struct{}
+	ms := &mockService{
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Subscription, error) {
+			assert.Equal(t, "request", ctx.Value(ctxKey{}))
+			return nil, fmt.Errorf("failed to get subscription: %w", context.DeadlineExceeded)
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(e)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/3f1c0a52-7d3b-4b8e-9a51-2f0e6c1d9b7a", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxKey{}, "request"))
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"timeout"`)
+}
+
+// tokenAuthenticator accepts bearer tokens naming the user ID, and the
+// identity headers
+type tokenAuthenticator struct{}
+
+func (tokenAuthenticator) Authenticate(ctx context.Context, creds domain.Credentials) (domain.Principal, error) {
+	if creds.UserID != "" {
+		return domain.Principal{UserID: creds.UserID, Role: domain.Role(creds.Role), TenantID: creds.TenantID, Method: domain.AuthMethodHeader}, nil
+	}
+	if creds.Token == "" {
+		return domain.Principal{}, domain.ErrUnauthorized
+	}
+	return domain.Principal{UserID: creds.Token, Role: domain.RoleOwner, TenantID: domain.DefaultTenant, Method: domain.AuthMethodJWT}, nil
+}
+
+func TestAuth(t *testing.T) {
+	const (
+		owner = "550e8400-e29b-41d4-a716-446655440000"
+		other = "7a2f4c1e-9b3d-4e6f-8a1b-2c3d4e5f6a7b"
+	)
+	var created domain.Subscription
+	var caller domain.Principal
+	ms := &mockService{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			created = *sub
+			return nil
+		},
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			caller, _ = domain.PrincipalFromContext(ctx)
+			if userID != caller.UserID {
+				return nil, domain.ErrForbidden
+			}
+			return &domain.Subscription{UserID: userID, ServiceName: serviceName}, nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).WithAuth(tokenAuthenticator{}).RegisterRoutes(e)
+
+	do := func(method, target, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		if token != "" {
+			req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/v1/subscriptions/"+owner+"/Netflix", "", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer realm="subscriptions"`, w.Header().Get(echo.HeaderWWWAuthenticate))
+	assert.Contains(t, w.Body.String(), `"code":"unauthorized"`)
+
+	w = do(http.MethodGet, "/api/v1/subscriptions/"+owner+"/Netflix", owner, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, domain.Principal{UserID: owner, Role: domain.RoleOwner, TenantID: domain.DefaultTenant, Method: domain.AuthMethodJWT}, caller)
+
+	w = do(http.MethodGet, "/api/v1/subscriptions/"+owner+"/Netflix", other, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"forbidden"`)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+owner+"/Netflix", nil)
+	req.Header.Set("X-User-ID", owner)
+	req.Header.Set("X-User-Role", "viewer")
+	req.Header.Set("X-Tenant-ID", "acme")
+	w = httptest.NewRecorder()
+	e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, domain.Principal{UserID: owner, Role: domain.RoleViewer, TenantID: "acme", Method: domain.AuthMethodHeader}, caller)
+
+	w = do(http.MethodPost, "/api/v1/subscriptions", owner, `{"service_name":"Netflix","price":500,"start_date":"07-2025"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, owner, created.UserID)
+}
+
+func TestAuth_ListWithoutUserID(t *testing.T) {
+	const (
+		owner = "550e8400-e29b-41d4-a716-446655440000"
+		other = "7a2f4c1e-9b3d-4e6f-8a1b-2c3d4e5f6a7b"
+	)
+	subs := repositories.NewMemoryUserSubscriptionRepository()
+	users := services.NewUserService(repositories.NewMemoryUserRepository(subs), "RUB")
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(services.NewUserSubscriptionService(subs, nil, nil, "RUB"), nil).
+		WithUsers(users).WithAuth(tokenAuthenticator{}).RegisterRoutes(e)
+
+	send := func(method, target, caller, role, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-User-ID", caller)
+		req.Header.Set("X-User-Role", role)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+	for _, user := range []string{owner, other} {
+		w := send(http.MethodPost, "/api/v1/users", user, "owner", `{}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		w = send(http.MethodPost, "/api/v1/subscriptions", user, "owner", `{"service_name":"Netflix","price":500,"start_date":"07-2025"}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	tests := []struct {
+		name   string
+		caller string
+		role   string
+		want   []string
+	}{
+		{"owner", owner, "owner", []string{owner}},
+		{"viewer", other, "viewer", []string{other}},
+		{"admin", owner, "admin", []string{owner, other}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(http.MethodGet, "/api/v1/subscriptions", tt.caller, tt.role, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			var items []handlers.SubscriptionRes
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+			var got []string
+			for _, item := range items {
+				got = append(got, item.UserID)
+			}
+			assert.ElementsMatch(t, tt.want, got)
+
+			w = send(http.MethodGet, "/api/v2/subscriptions", tt.caller, tt.role, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			var page handlers.SubscriptionPageRes
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+			assert.Len(t, page.Items, len(tt.want))
+			assert.Equal(t, len(tt.want), page.Total)
+		})
+	}
+}
+
+func TestCreateSubscription_IdempotencyKeyPerUser(t *testing.T) {
+	calls := 0
+	ms := &mockService{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			calls++
+			sub.ID = fmt.Sprintf("id-%d", calls)
+			return nil
+		},
+	}
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).
+		WithIdempotency(repositories.NewMemoryIdempotencyStore(), time.Hour).
+		WithAuth(tokenAuthenticator{}).
+		RegisterRoutes(e)
+
+	for _, user := range []string{"550e8400-e29b-41d4-a716-446655440000", "7a2f4c1e-9b3d-4e6f-8a1b-2c3d4e5f6a7b"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/subscriptions", strings.NewReader(`{"service_name":"Netflix","price":500,"start_date":"07-2025"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+user)
+		req.Header.Set("Idempotency-Key", "key-1")
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	}
+	assert.Equal(t, 2, calls)
+}
+
+func TestTenant(t *testing.T) {
+	const owner = "550e8400-e29b-41d4-a716-446655440000"
+	var tenant string
+	ms := &mockService{
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			tenant = domain.TenantFromContext(ctx)
+			return &domain.Subscription{UserID: userID, ServiceName: serviceName}, nil
+		},
+	}
+	anonymous := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).RegisterRoutes(anonymous)
+	authenticated := newEcho()
+	handlers.NewSubscriptionsApiHandler(ms, nil).WithAuth(tokenAuthenticator{}).RegisterRoutes(authenticated)
+
+	tests := []struct {
+		name   string
+		e      *echo.Echo
+		header map[string]string
+		status int
+		tenant string
+	}{
+		{"default", anonymous, nil, http.StatusOK, domain.DefaultTenant},
+		{"header", anonymous, map[string]string{"X-Tenant-ID": "acme"}, http.StatusOK, "acme"},
+		{"invalid header", anonymous, map[string]string{"X-Tenant-ID": "Acme Corp"}, http.StatusBadRequest, ""},
+		{"caller tenant", authenticated, map[string]string{"Authorization": "Bearer " + owner}, http.StatusOK, domain.DefaultTenant},
+		{"caller names own tenant", authenticated, map[string]string{"Authorization": "Bearer " + owner, "X-Tenant-ID": "default"}, http.StatusOK, domain.DefaultTenant},
+		{"caller names other tenant", authenticated, map[string]string{"Authorization": "Bearer " + owner, "X-Tenant-ID": "acme"}, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tenant = ""
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/subscriptions/"+owner+"/Netflix", nil)
+			for name, value := range tt.header {
+				req.Header.Set(name, value)
+			}
+			w := httptest.NewRecorder()
+			tt.e.ServeHTTP(w, req)
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.tenant, tenant)
+		})
+	}
+}
+
+func TestUsers(t *testing.T) {
+	const (
+		owner = "550e8400-e29b-41d4-a716-446655440000"
+		other = "7a2f4c1e-9b3d-4e6f-8a1b-2c3d4e5f6a7b"
+	)
+	subs := repositories.NewMemoryUserSubscriptionRepository()
+	users := services.NewUserService(repositories.NewMemoryUserRepository(subs), "RUB")
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(services.NewUserSubscriptionService(subs, nil, nil, "RUB"), nil).
+		WithUsers(users).WithAuth(tokenAuthenticator{}).RegisterRoutes(e)
+
+	send := func(method, path, caller, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+caller)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodPost, "/api/v1/subscriptions", owner, `{"service_name":"Netflix","price":500,"start_date":"07-2025"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"unknown_user"`)
+
+	w = send(http.MethodPost, "/api/v1/users", owner, `{"display_name":"Alex","email":"alex@example.com","currency":"USD","timezone":"Europe/Moscow"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var user handlers.UserRes
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, owner, user.ID)
+	assert.Equal(t, "Europe/Moscow", user.Timezone)
+
+	w = send(http.MethodPost, "/api/v1/users", other, `{"email":"ALEX@example.com"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = send(http.MethodPost, "/api/v1/users", other, `{"timezone":"Mars/Olympus"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = send(http.MethodGet, "/api/v1/users/"+owner, other, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(http.MethodGet, "/api/v1/users", owner, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = send(http.MethodPost, "/api/v1/subscriptions", owner, `{"service_name":"Netflix","price":500,"start_date":"07-2025"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var sub handlers.SubscriptionRes
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &sub))
+
+	w = send(http.MethodPut, "/api/v1/users/"+owner, owner, `{"display_name":"Alexander","currency":"EUR"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &user))
+	assert.Equal(t, "Alexander", user.DisplayName)
+	assert.Equal(t, domain.DefaultTimezone, user.Timezone)
+
+	w = send(http.MethodDelete, "/api/v1/users/"+owner, owner, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = send(http.MethodGet, "/api/v1/subscriptions/"+sub.ID, owner, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = send(http.MethodGet, "/api/v1/users/"+owner, owner, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSharedSubscription(t *testing.T) {
+	const (
+		owner  = "550e8400-e29b-41d4-a716-446655440000"
+		member = "7a2f4c1e-9b3d-4e6f-8a1b-2c3d4e5f6a7b"
+	)
+	subs := repositories.NewMemoryUserSubscriptionRepository()
+	users := services.NewUserService(repositories.NewMemoryUserRepository(subs), "RUB")
+	e := newEcho()
+	handlers.NewSubscriptionsApiHandler(services.NewUserSubscriptionService(subs, nil, nil, "RUB"), nil).
+		WithUsers(users).WithAuth(tokenAuthenticator{}).RegisterRoutes(e)
+
+	send := func(method, path, caller, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+caller)
+		w := httptest.NewRecorder()
+		e.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, id := range []string{owner, member} {
+		w := send(http.MethodPost, "/api/v1/users", id, `{}`)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+	w := send(http.MethodPost, "/api/v1/subscriptions", owner, `{"service_name":"Spotify","price":900,"start_date":"01-2025"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	path := "/api/v1/subscriptions/" + owner + "/Spotify/members"
+	w = send(http.MethodPut, path, member, `[{"user_id":"`+member+`","weight":1}]`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = send(http.MethodPut, path, owner, `[{"user_id":"`+member+`"}]`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = send(http.MethodPut, path, owner, `[{"user_id":"`+owner+`","weight":1},{"user_id":"`+member+`","weight":2}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send(http.MethodGet, path, owner, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"user_id":"`+owner+`","weight":1},{"user_id":"`+member+`","weight":2}]`, w.Body.String())
+
+	var total handlers.TotalPriceRes
+	w = send(http.MethodGet, "/api/v1/subscriptions/total?from=01-2025&to=02-2025", member, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &total))
+	assert.Equal(t, 1200, total.Total)
+
+	var settlement handlers.SettlementRes
+	w = send(http.MethodGet, "/api/v1/subscriptions/settlement?month=02-2025", member, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &settlement))
+	assert.Equal(t, "02-2025", settlement.Month.Format("01-2006"))
+	assert.Equal(t, []handlers.TransferRes{{From: member, To: owner, Amount: 600}}, settlement.Transfers)
+
+	w = send(http.MethodGet, "/api/v1/subscriptions/settlement?month=2025-02", member, "")
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	// headerIdempotentReplayed marks responses replayed from the store
+	headerIdempotentReplayed = "Idempotent-Replayed"
+	headerRetryAfter         = "Retry-After"
+	maxIdempotencyKeyLength  = 255
+	// idempotencyLease is how long a key stays reserved for a request that
+	// never completes, e.g. when the instance serving it stops
+	idempotencyLease = time.Minute
+)
+
+// replayedHeaders are the response headers stored with an idempotency key
+var replayedHeaders = []string{echo.HeaderContentType, echo.HeaderLocation, headerETag}
+
+// WithIdempotency makes creating subscriptions honour the Idempotency-Key
+// header, storing responses in the store for the ttl.
+func (h *subscriptionsApiHandler) WithIdempotency(store domain.IdempotencyStore, ttl time.Duration) *subscriptionsApiHandler {
+	h.idempotency = store
+	h.idempotencyTTL = ttl
+	return h
+}
+
+// idempotent is a middleware replaying the stored response of a request with
+// the same Idempotency-Key, and rejecting reuse of the key with another
+// request. Requests without the header are served as usual.
+func (h *subscriptionsApiHandler) idempotent(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key := c.Request().Header.Get(headerIdempotencyKey)
+		if h.idempotency == nil || key == "" {
+			return next(c)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return validationError(fmt.Sprintf("%s is longer than %d characters", headerIdempotencyKey, maxIdempotencyKeyLength))
+		}
+
+		// Keys are chosen by clients, so they are scoped to the tenant and the
+		// caller. The scoped key is hashed to fit the length limit of keys.
+		tenantID := domain.TenantFromContext(c.Request().Context())
+		principal, ok := domain.PrincipalFromContext(c.Request().Context())
+		if ok || tenantID != domain.DefaultTenant {
+			sum := sha256.Sum256([]byte(tenantID + "/" + principal.UserID + "/" + key))
+			key = hex.EncodeToString(sum[:])
+		}
+
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		c.Request().Body = io.NopCloser(bytes.NewReader(body))
+		hash := requestHash(c.Request(), body)
+
+		// Reserve the key first, so concurrent retries are not served twice.
+		ctx := c.Request().Context()
+		record := &domain.IdempotencyRecord{
+			Key:         key,
+			RequestHash: hash,
+			Body:        []byte{},
+			ExpiresAt:   time.Now().Add(idempotencyLease),
+		}
+		err = h.idempotency.Save(ctx, *record)
+		if errors.Is(err, domain.ErrConflict) {
+			return h.replay(c, key, hash)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Render errors here, so error responses are stored as well.
+		recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+		c.Response().Writer = recorder
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		c.Response().Writer = recorder.ResponseWriter
+
+		// Server errors are transient, the request can be retried.
+		status := c.Response().Status
+		if status >= http.StatusInternalServerError {
+			if err := h.idempotency.Release(ctx, key); err != nil && h.logger != nil {
+				h.logger.Warn("failed to release idempotency key",
+					zap.String("key", key),
+					zap.Error(err))
+			}
+			return nil
+		}
+		record.StatusCode = status
+		record.Header = make(map[string]string)
+		record.Body = recorder.body.Bytes()
+		record.ExpiresAt = time.Now().Add(h.idempotencyTTL)
+		for _, name := range replayedHeaders {
+			if value := c.Response().Header().Get(name); value != "" {
+				record.Header[name] = value
+			}
+		}
+		if err := h.idempotency.Complete(ctx, *record); err != nil && h.logger != nil {
+			h.logger.Warn("failed to save idempotency key",
+				zap.String("key", key),
+				zap.Error(err))
+		}
+		return nil
+	}
+}
+
+// replay writes the stored response of the key, or rejects the request if the
+// key was used with another request or its first request is still served
+func (h *subscriptionsApiHandler) replay(c echo.Context, key, hash string) error {
+	record, err := h.idempotency.Get(c.Request().Context(), key)
+	if errors.Is(err, domain.ErrNotFound) {
+		// The record expired since it was reserved, a retry can reserve it.
+		c.Response().Header().Set(headerRetryAfter, "1")
+		return fmt.Errorf("%s %q: %w", headerIdempotencyKey, key, domain.ErrIdempotentRequestInProgress)
+	}
+	if err != nil {
+		return err
+	}
+	if record.RequestHash != hash {
+		return fmt.Errorf("%s %q: %w", headerIdempotencyKey, key, domain.ErrIdempotencyKeyReused)
+	}
+	if record.Pending() {
+		c.Response().Header().Set(headerRetryAfter, "1")
+		return fmt.Errorf("%s %q: %w", headerIdempotencyKey, key, domain.ErrIdempotentRequestInProgress)
+	}
+	for name, value := range record.Header {
+		c.Response().Header().Set(name, value)
+	}
+	c.Response().Header().Set(headerIdempotentReplayed, "true")
+	c.Response().WriteHeader(record.StatusCode)
+	_, err = c.Response().Write(record.Body)
+	return err
+}
+
+// requestHash identifies a request by its method, path and body
+func requestHash(req *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", req.Method, req.URL.Path)
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder copies the response body while writing it
+type responseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// Members godoc
+// @Summary Get subscription members
+// @Description Get the members sharing the cost of the latest subscription of a user to a service
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param service_name path string true "Service Name"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {array} MemberRes
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{user_id}/{service_name}/members [get]
+func (h *subscriptionsApiHandler) Members(c echo.Context) error {
+	userID := c.Param("user_id")
+	serviceName := c.Param("service_name")
+	if userID == "" || serviceName == "" {
+		return validationError("missing user_id or service_name")
+	}
+	members, err := h.service.Members(c.Request().Context(), userID, serviceName)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to get subscription members",
+				zap.String("handler", "Members"),
+				zap.String("user_id", userID),
+				zap.String("service_name", serviceName),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	res := make([]MemberRes, len(members))
+	for i, m := range members {
+		res[i] = MemberRes(m)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// SetMembers godoc
+// @Summary Set subscription members
+// @Description Replace the members sharing the cost of the latest subscription of a user to a service. Members pay a fixed amount of every charge or a part of the rest proportional to their weight, the user pays whatever they do not and can be a member to take a weighted part. An empty list makes the user pay everything.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User ID"
+// @Param service_name path string true "Service Name"
+// @Param members body []MemberReq true "Members"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {array} MemberRes
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem "Subscription not found"
+// @Failure 422 {object} utils.Problem "Member user does not exist"
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/{user_id}/{service_name}/members [put]
+func (h *subscriptionsApiHandler) SetMembers(c echo.Context) error {
+	userID := c.Param("user_id")
+	serviceName := c.Param("service_name")
+	if userID == "" || serviceName == "" {
+		return validationError("missing user_id or service_name")
+	}
+	var req []MemberReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	members := make([]domain.Member, len(req))
+	for i, m := range req {
+		if err := h.validate.Struct(m); err != nil {
+			return fmt.Errorf("%w: %w", domain.ErrValidation, err)
+		}
+		members[i] = domain.Member(m)
+	}
+	err := h.service.SetMembers(c.Request().Context(), userID, serviceName, members)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to set subscription members",
+				zap.String("handler", "SetMembers"),
+				zap.String("user_id", userID),
+				zap.String("service_name", serviceName),
+				zap.Any("members", members),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	res := make([]MemberRes, len(members))
+	for i, m := range members {
+		res[i] = MemberRes(m)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// Settlement godoc
+// @Summary Get who owes whom
+// @Description Work out what the members of shared subscriptions owe the users paying them for a month. Debts between two users are netted into one transfer. Callers other than admins only see the transfers they are part of.
+// @Tags subscriptions
+// @Accept json
+// @Produce json
+// @Param month query string false "Month (MM-YYYY), defaults to the current month"
+// @Param user_id query string false "User ID, the subscriptions the user pays or is a member of"
+// @Param service_name query []string false "Service names" collectionFormat(multi)
+// @Param mode query string false "Cost attribution for billing cycles longer than a month" Enums(cash, amortized) default(cash)
+// @Param currency query string false "ISO-4217 currency to report amounts in, defaults to the service reporting currency"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {object} SettlementRes
+// @Failure 400 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/subscriptions/settlement [get]
+func (h *subscriptionsApiHandler) Settlement(c echo.Context) error {
+	filter, err := h.parseCostFilter(c)
+	if err != nil {
+		return err
+	}
+	if month := c.QueryParam("month"); month != "" {
+		filter.To, err = parseYearMonth(month)
+		if err != nil {
+			return validationError("invalid month format, expected MM-YYYY")
+		}
+	}
+
+	settlement, err := h.service.Settlement(c.Request().Context(), filter)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to settle subscriptions",
+				zap.String("handler", "Settlement"),
+				zap.Any("filter", filter),
+				zap.Error(err))
+		}
+		return err
+	}
+
+	res := SettlementRes{
+		Month:     settlement.Month,
+		Currency:  settlement.Currency,
+		Transfers: make([]TransferRes, len(settlement.Transfers)),
+	}
+	for i, t := range settlement.Transfers {
+		res.Transfers[i] = TransferRes(t)
+	}
+	return c.JSON(http.StatusOK, res)
+}
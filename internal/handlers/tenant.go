@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"fmt"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/labstack/echo/v4"
+)
+
+// headerTenantID names the tenant of anonymous requests, and of requests
+// authenticated by a trusted proxy
+const headerTenantID = "X-Tenant-ID"
+
+// resolveTenant is a middleware storing the tenant of the request in its
+// context: the tenant of the authenticated caller, else the one named by the
+// header, else the default tenant. Authenticated callers cannot name another
+// tenant than their own.
+func resolveTenant(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		requested := c.Request().Header.Get(headerTenantID)
+		if requested != "" && !domain.ValidTenantID(requested) {
+			return validationError("invalid " + headerTenantID)
+		}
+
+		tenantID := requested
+		if principal, ok := domain.PrincipalFromContext(ctx); ok {
+			if requested != "" && requested != principal.TenantID {
+				return fmt.Errorf("%w: cannot act within tenant %s", domain.ErrForbidden, requested)
+			}
+			tenantID = principal.TenantID
+		}
+		if tenantID != "" {
+			c.SetRequest(c.Request().WithContext(domain.WithTenant(ctx, tenantID)))
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+)
+
+// WithUsers serves the profiles of users under /api/v1/users.
+func (h *subscriptionsApiHandler) WithUsers(users domain.UserService) *subscriptionsApiHandler {
+	h.users = users
+	return h
+}
+
+// CreateUser godoc
+// @Summary Create a user
+// @Description Create a user, subscriptions can only be created for existing users. The ID defaults to the caller.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body UserCreateReq true "User to create"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 201 {object} UserRes
+// @Failure 400 {object} utils.Problem
+// @Failure 409 {object} utils.Problem "ID or email taken"
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/users [post]
+func (h *subscriptionsApiHandler) CreateUser(c echo.Context) error {
+	var req UserCreateReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.ID == "" {
+		req.ID = callerID(c)
+	}
+	if err := h.validate.Struct(req); err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrValidation, err)
+	}
+
+	user := domain.User{
+		ID:          req.ID,
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		Currency:    req.Currency,
+		Timezone:    req.Timezone,
+	}
+	if err := h.users.Create(c.Request().Context(), &user); err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to create user",
+				zap.String("handler", "CreateUser"),
+				zap.String("id", user.ID),
+				zap.Error(err))
+		}
+		return err
+	}
+	return c.JSON(http.StatusCreated, newUserRes(user))
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description List the users of the tenant in order of creation, admins only
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param limit query int false "Limit, at most 100" default(20)
+// @Param offset query int false "Offset"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {array} UserRes
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/users [get]
+func (h *subscriptionsApiHandler) ListUsers(c echo.Context) error {
+	limit, offset := defaultListLimit, 0
+	if v, err := strconv.Atoi(c.QueryParam("limit")); err == nil && v > 0 {
+		limit = min(v, maxListLimit)
+	}
+	if v, err := strconv.Atoi(c.QueryParam("offset")); err == nil && v >= 0 {
+		offset = v
+	}
+
+	users, err := h.users.List(c.Request().Context(), limit, offset)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to list users",
+				zap.String("handler", "ListUsers"),
+				zap.Error(err))
+		}
+		return err
+	}
+	res := make([]UserRes, len(users))
+	for i, user := range users {
+		res[i] = newUserRes(user)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetUser godoc
+// @Summary Get a user
+// @Description Get the profile of a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {object} UserRes
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/users/{id} [get]
+func (h *subscriptionsApiHandler) GetUser(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.validate.Var(id, "required,uuid"); err != nil {
+		return validationError("invalid user id")
+	}
+	user, err := h.users.Get(c.Request().Context(), id)
+	if err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to get user",
+				zap.String("handler", "GetUser"),
+				zap.String("id", id),
+				zap.Error(err))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, newUserRes(*user))
+}
+
+// UpdateUser godoc
+// @Summary Update a user
+// @Description Replace the profile of a user
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param user body UserUpdateReq true "User update"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 200 {object} UserRes
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 409 {object} utils.Problem "Email taken"
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/users/{id} [put]
+func (h *subscriptionsApiHandler) UpdateUser(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.validate.Var(id, "required,uuid"); err != nil {
+		return validationError("invalid user id")
+	}
+	var req UserUpdateReq
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if err := h.validate.Struct(req); err != nil {
+		return fmt.Errorf("%w: %w", domain.ErrValidation, err)
+	}
+
+	user := domain.User{
+		ID:          id,
+		DisplayName: req.DisplayName,
+		Email:       req.Email,
+		Currency:    req.Currency,
+		Timezone:    req.Timezone,
+	}
+	if err := h.users.Update(c.Request().Context(), &user); err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to update user",
+				zap.String("handler", "UpdateUser"),
+				zap.String("id", id),
+				zap.Error(err))
+		}
+		return err
+	}
+	return c.JSON(http.StatusOK, newUserRes(user))
+}
+
+// DeleteUser godoc
+// @Summary Delete a user
+// @Description Delete a user with all its subscriptions and API keys
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path string true "User ID"
+// @Param X-Tenant-ID header string false "Tenant of anonymous requests, authenticated callers act within their own"
+// @Success 204
+// @Failure 400 {object} utils.Problem
+// @Failure 404 {object} utils.Problem
+// @Failure 401 {object} utils.Problem
+// @Failure 403 {object} utils.Problem
+// @Failure 500 {object} utils.Problem
+// @Security BearerAuth
+// @Security ApiKeyAuth
+// @Router /api/v1/users/{id} [delete]
+func (h *subscriptionsApiHandler) DeleteUser(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.validate.Var(id, "required,uuid"); err != nil {
+		return validationError("invalid user id")
+	}
+	if err := h.users.Delete(c.Request().Context(), id); err != nil {
+		if h.logger != nil {
+			h.logger.Warn("failed to delete user",
+				zap.String("handler", "DeleteUser"),
+				zap.String("id", id),
+				zap.Error(err))
+		}
+		return err
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/utils"
+	"github.com/go-playground/validator/v10"
+)
+
+// newValidator creates a validator reporting fields by their JSON names
+func newValidator() *validator.Validate {
+	validate := validator.New()
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	return validate
+}
+
+// fieldErrors converts validator errors to per-field problem errors
+func fieldErrors(errs validator.ValidationErrors) []utils.FieldError {
+	result := make([]utils.FieldError, 0, len(errs))
+	for _, fe := range errs {
+		result = append(result, utils.FieldError{
+			Field:   fieldPath(fe),
+			Code:    fe.Tag(),
+			Message: fieldMessage(fe),
+		})
+	}
+	return result
+}
+
+// fieldPath returns the path of the field without the request struct name
+func fieldPath(fe validator.FieldError) string {
+	_, path, found := strings.Cut(fe.Namespace(), ".")
+	if !found {
+		return fe.Field()
+	}
+	return path
+}
+
+// fieldMessage returns a user facing message for a failed validation
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "iso4217":
+		return "must be an ISO-4217 currency code"
+	case "email":
+		return "must be a valid email address"
+	case "timezone":
+		return "must be an IANA timezone name"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min":
+		if fe.Kind() == reflect.String {
+			return "must be at least " + fe.Param() + " characters long"
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return "must be at most " + fe.Param() + " characters long"
+		}
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be greater than " + fe.Param()
+	case "gte":
+		return "must be greater than or equal to " + fe.Param()
+	}
+	return fmt.Sprintf("failed on the %q validation", fe.Tag())
+}
+
+// mergePatchFields are the fields of a subscription that can be patched
+var mergePatchFields = []string{"price", "currency", "start_date", "end_date", "billing_period", "billing_interval"}
+
+// parseMergePatch parses a JSON Merge Patch (RFC 7396) of a subscription
+func (h *subscriptionsApiHandler) parseMergePatch(body []byte) (domain.SubscriptionPatch, error) {
+	var patch domain.SubscriptionPatch
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return patch, validationError("merge patch must be a JSON object")
+	}
+
+	var req SubscriptionPatchReq
+	targets := map[string]any{
+		"price":            &req.Price,
+		"currency":         &req.Currency,
+		"start_date":       &req.StartDate,
+		"end_date":         &req.EndDate,
+		"billing_period":   &req.BillingPeriod,
+		"billing_interval": &req.BillingInterval,
+	}
+
+	var errs fieldsError
+	for _, name := range mergePatchFields {
+		raw, ok := members[name]
+		if !ok {
+			continue
+		}
+		if string(raw) == "null" {
+			switch name {
+			case "end_date":
+				patch.ClearEndDate = true
+			case "billing_period":
+				period := domain.BillingMonthly
+				patch.BillingPeriod = &period
+			case "billing_interval":
+				interval := 1
+				patch.BillingInterval = &interval
+			default:
+				errs = append(errs, utils.FieldError{Field: name, Code: "required", Message: "cannot be null"})
+			}
+			continue
+		}
+		if err := json.Unmarshal(raw, targets[name]); err != nil {
+			errs = append(errs, utils.FieldError{Field: name, Code: "type", Message: "has an invalid value"})
+		}
+	}
+
+	unknown := make([]string, 0)
+	for name := range members {
+		if !slices.Contains(mergePatchFields, name) {
+			unknown = append(unknown, name)
+		}
+	}
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		switch name {
+		case "id", "user_id", "service_name":
+			errs = append(errs, utils.FieldError{Field: name, Code: "read_only", Message: "cannot be changed"})
+		default:
+			errs = append(errs, utils.FieldError{Field: name, Code: "unknown", Message: "is not a known field"})
+		}
+	}
+	if len(errs) > 0 {
+		return patch, errs
+	}
+
+	if err := h.validate.Struct(req); err != nil {
+		return patch, fmt.Errorf("%w: %w", domain.ErrValidation, err)
+	}
+
+	patch.Price = req.Price
+	patch.Currency = req.Currency
+	patch.StartDate = req.StartDate
+	patch.EndDate = req.EndDate
+	if req.BillingPeriod != nil {
+		patch.BillingPeriod = req.BillingPeriod
+	}
+	if req.BillingInterval != nil {
+		patch.BillingInterval = req.BillingInterval
+	}
+	return patch, nil
+}
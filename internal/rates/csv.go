@@ -0,0 +1,131 @@
+// Package rates provides exchange rate sources for currency conversion.
+package rates
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
+
+// ECBBaseCurrency is the base currency of the European Central Bank reference rates.
+const ECBBaseCurrency = "EUR"
+
+// CSVRateProvider serves exchange rates loaded from an ECB-style CSV file:
+// a "Date" column in YYYY-MM-DD format followed by one column per currency
+// holding the amount of that currency one unit of the base currency buys.
+type CSVRateProvider struct {
+	base string
+	// days are sorted by date in ascending order
+	days []dayRates
+}
+
+type dayRates struct {
+	date  time.Time
+	rates map[string]float64
+}
+
+// LoadCSV reads ECB reference rates (EUR based) from the file at path.
+func LoadCSV(path string) (*CSVRateProvider, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open exchange rates file: %w", err)
+	}
+	defer f.Close()
+
+	return ParseCSV(f, ECBBaseCurrency)
+}
+
+// ParseCSV reads exchange rates relative to the base currency from r.
+func ParseCSV(r io.Reader, base string) (*CSVRateProvider, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("exchange rates file is empty")
+	}
+
+	header := records[0]
+	p := &CSVRateProvider{base: base}
+	for line, record := range records[1:] {
+		if len(record) == 0 || strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid date on line %d: %w", line+2, err)
+		}
+
+		day := dayRates{date: date, rates: make(map[string]float64)}
+		for i := 1; i < len(record) && i < len(header); i++ {
+			code := strings.TrimSpace(header[i])
+			value := strings.TrimSpace(record[i])
+			if code == "" || value == "" || value == "N/A" {
+				continue
+			}
+			rate, err := strconv.ParseFloat(value, 64)
+			if err != nil || rate <= 0 {
+				return nil, fmt.Errorf("invalid %s rate on line %d: %q", code, line+2, value)
+			}
+			day.rates[code] = rate
+		}
+		p.days = append(p.days, day)
+	}
+
+	sort.Slice(p.days, func(i, j int) bool {
+		return p.days[i].date.Before(p.days[j].date)
+	})
+	return p, nil
+}
+
+// Rate returns the exchange rate published on the latest date not after at.
+// Dates before the first published rate use the earliest one.
+func (p *CSVRateProvider) Rate(from, to string, at time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	fromRate, ok := p.baseRate(from, at)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", domain.ErrRateNotFound, from)
+	}
+	toRate, ok := p.baseRate(to, at)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", domain.ErrRateNotFound, to)
+	}
+	return toRate / fromRate, nil
+}
+
+// baseRate returns the amount of code one unit of the base currency buys at the given time.
+func (p *CSVRateProvider) baseRate(code string, at time.Time) (float64, bool) {
+	if code == p.base {
+		return 1, true
+	}
+
+	// Index of the first day after at, everything before it is effective.
+	i := sort.Search(len(p.days), func(i int) bool {
+		return p.days[i].date.After(at)
+	})
+	for j := i - 1; j >= 0; j-- {
+		if rate, ok := p.days[j].rates[code]; ok {
+			return rate, true
+		}
+	}
+	for j := i; j < len(p.days); j++ {
+		if rate, ok := p.days[j].rates[code]; ok {
+			return rate, true
+		}
+	}
+	return 0, false
+}
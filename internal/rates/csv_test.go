@@ -0,0 +1,64 @@
+package rates_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/rates"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ecbCSV = `Date,USD,JPY,RUB,
+2025-03-03,1.0500,157.00,N/A,
+2025-02-03,1.0300,160.00,95.00,
+2025-01-02,1.0350,162.50,100.00,
+`
+
+func TestCSVRateProvider_Rate(t *testing.T) {
+	p, err := rates.ParseCSV(strings.NewReader(ecbCSV), rates.ECBBaseCurrency)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		from, to string
+		at       time.Time
+		want     float64
+	}{
+		{"base to currency", "EUR", "USD", time.Date(2025, 2, 10, 0, 0, 0, 0, time.UTC), 1.03},
+		{"currency to base", "USD", "EUR", time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), 1 / 1.05},
+		{"cross rate", "USD", "JPY", time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC), 162.5 / 1.035},
+		{"before first date uses earliest", "EUR", "USD", time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC), 1.035},
+		{"missing value uses previous date", "EUR", "RUB", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), 95},
+		{"same currency", "GBP", "GBP", time.Now(), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := p.Rate(tt.from, tt.to, tt.at)
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, rate, 1e-9)
+		})
+	}
+}
+
+func TestCSVRateProvider_UnknownCurrency(t *testing.T) {
+	p, err := rates.ParseCSV(strings.NewReader(ecbCSV), rates.ECBBaseCurrency)
+	require.NoError(t, err)
+
+	_, err = p.Rate("USD", "GBP", time.Now())
+	assert.ErrorIs(t, err, domain.ErrRateNotFound)
+}
+
+func TestConverter_MinorUnits(t *testing.T) {
+	p, err := rates.ParseCSV(strings.NewReader(ecbCSV), rates.ECBBaseCurrency)
+	require.NoError(t, err)
+	conv := domain.Converter{Rates: p, Currency: "JPY"}
+
+	// 10.00 EUR is 1625 JPY, which has no minor units.
+	amount, err := conv.Convert(1000, "EUR", time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 1625, amount)
+}
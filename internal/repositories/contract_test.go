@@ -0,0 +1,534 @@
+package repositories_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/db"
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/repositories"
+	"github.com/alexputin/subscriptions/migrations"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDatabaseURLEnv points the contract tests at a migrated Postgres
+// database, which is truncated before each test.
+const testDatabaseURLEnv = "TEST_DATABASE_URL"
+
+func TestMemoryUserSubscriptionRepository(t *testing.T) {
+	testRepositoryContract(t, func(t *testing.T) domain.Repositories {
+		subs := repositories.NewMemoryUserSubscriptionRepository()
+		return domain.Repositories{Subscriptions: subs, Users: repositories.NewMemoryUserRepository(subs)}
+	})
+}
+
+func TestPostgresUserSubscriptionRepository(t *testing.T) {
+	url := os.Getenv(testDatabaseURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+	conn, err := db.CreatePostgresConnection(url)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	testRepositoryContract(t, func(t *testing.T) domain.Repositories {
+		_, err := conn.Exec(`TRUNCATE users, subscriptions CASCADE`)
+		require.NoError(t, err)
+		return domain.Repositories{
+			Subscriptions: repositories.NewPostgresUserSubscriptionRepository(conn),
+			Users:         repositories.NewSQLUserRepository(conn),
+		}
+	})
+}
+
+func TestSQLiteUserSubscriptionRepository(t *testing.T) {
+	testRepositoryContract(t, func(t *testing.T) domain.Repositories {
+		conn, err := db.CreateSQLiteConnection(filepath.Join(t.TempDir(), "subscriptions.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		migrator, err := db.NewMigrator(conn, migrations.SQLite)
+		require.NoError(t, err)
+		_, err = migrator.Up(context.Background())
+		require.NoError(t, err)
+		return domain.Repositories{
+			Subscriptions: repositories.NewSQLiteUserSubscriptionRepository(conn),
+			Users:         repositories.NewSQLUserRepository(conn),
+		}
+	})
+}
+
+// testRepositoryContract checks the behaviour every UserSubscriptionRepository
+// and UserRepository must share, newRepos returns empty repositories.
+func testRepositoryContract(t *testing.T, newRepos func(t *testing.T) domain.Repositories) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+	otherUserID := uuid.NewString()
+
+	// newRepo returns empty subscriptions of the users, which exist in the
+	// default tenant and in acme
+	newRepo := func(t *testing.T) domain.UserSubscriptionRepository {
+		repos := newRepos(t)
+		for _, tenant := range []string{domain.DefaultTenant, "acme"} {
+			for _, id := range []string{userID, otherUserID} {
+				user := &domain.User{ID: id, Currency: "RUB", Timezone: domain.DefaultTimezone}
+				require.NoError(t, repos.Users.Create(domain.WithTenant(ctx, tenant), user))
+			}
+		}
+		return repos.Subscriptions
+	}
+
+	newSub := func(serviceName string, price int, start string) *domain.Subscription {
+		return &domain.Subscription{
+			UserID:          userID,
+			ServiceName:     serviceName,
+			Price:           price,
+			Currency:        "RUB",
+			StartDate:       shortDate(start),
+			BillingPeriod:   domain.BillingMonthly,
+			BillingInterval: 1,
+		}
+	}
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+		assert.NotEmpty(t, sub.ID)
+		assert.Equal(t, 1, sub.Version)
+
+		got, err := repo.GetByID(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, sub.ServiceName, got.ServiceName)
+		assert.Equal(t, sub.Price, got.Price)
+		assert.True(t, sub.StartDate.Equal(got.StartDate.Time))
+		assert.Nil(t, got.EndDate)
+		assert.Equal(t, 1, got.Version)
+
+		got, err = repo.Get(ctx, userID, "netflix")
+		require.NoError(t, err)
+		assert.Equal(t, sub.ID, got.ID)
+	})
+
+	t.Run("CreateDuplicateID", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+
+		dup := newSub("spotify", 200, "2025-01-01")
+		dup.ID = sub.ID
+		assert.ErrorIs(t, repo.Create(ctx, dup), domain.ErrConflict)
+	})
+
+	t.Run("CreateInvalidBilling", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		sub.BillingInterval = 0
+		assert.ErrorIs(t, repo.Create(ctx, sub), domain.ErrValidation)
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		repo := newRepo(t)
+		id := uuid.NewString()
+
+		_, err := repo.Get(ctx, userID, "netflix")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		_, err = repo.GetByID(ctx, id)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		_, err = repo.Patch(ctx, id, 0, domain.SubscriptionPatch{})
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.ErrorIs(t, repo.Update(ctx, newSub("netflix", 400, "2025-01-01")), domain.ErrNotFound)
+		assert.ErrorIs(t, repo.Delete(ctx, userID, "netflix", 0), domain.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteByID(ctx, id, 0), domain.ErrNotFound)
+		assert.ErrorIs(t, repo.AddPrice(ctx, id, domain.PricePoint{EffectiveFrom: shortDate("2025-01-01"), Price: 1, Currency: "RUB"}), domain.ErrNotFound)
+	})
+
+	t.Run("GetReturnsLatest", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.Create(ctx, newSub("netflix", 400, "2024-01-01")))
+		latest := newSub("netflix", 500, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, latest))
+
+		got, err := repo.Get(ctx, userID, "netflix")
+		require.NoError(t, err)
+		assert.Equal(t, latest.ID, got.ID)
+	})
+
+	t.Run("UpdateVersion", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+
+		stale := *sub
+		sub.Price = 500
+		require.NoError(t, repo.Update(ctx, sub))
+		assert.Equal(t, 2, sub.Version)
+		assert.Equal(t, 500, sub.Price)
+
+		stale.Price = 600
+		assert.ErrorIs(t, repo.Update(ctx, &stale), domain.ErrVersionMismatch)
+
+		got, err := repo.GetByID(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 500, got.Price)
+		assert.Equal(t, 2, got.Version)
+	})
+
+	t.Run("Patch", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+
+		price := 500
+		got, err := repo.Patch(ctx, sub.ID, 1, domain.SubscriptionPatch{Price: &price})
+		require.NoError(t, err)
+		assert.Equal(t, 500, got.Price)
+		assert.Equal(t, "RUB", got.Currency)
+		assert.Equal(t, 2, got.Version)
+
+		_, err = repo.Patch(ctx, sub.ID, 1, domain.SubscriptionPatch{Price: &price})
+		assert.ErrorIs(t, err, domain.ErrVersionMismatch)
+
+		history, err := repo.PriceHistory(ctx, sub.ID)
+		require.NoError(t, err)
+		require.NotEmpty(t, history)
+		assert.Equal(t, 500, history[len(history)-1].Price)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+
+		assert.ErrorIs(t, repo.Delete(ctx, userID, "netflix", 2), domain.ErrVersionMismatch)
+		require.NoError(t, repo.Delete(ctx, userID, "netflix", 1))
+		_, err := repo.GetByID(ctx, sub.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		other := newSub("spotify", 200, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, other))
+		assert.ErrorIs(t, repo.DeleteByID(ctx, other.ID, 2), domain.ErrVersionMismatch)
+		require.NoError(t, repo.DeleteByID(ctx, other.ID, 0))
+		assert.ErrorIs(t, repo.DeleteByID(ctx, other.ID, 0), domain.ErrNotFound)
+	})
+
+	t.Run("ListPagination", func(t *testing.T) {
+		repo := newRepo(t)
+		for i, name := range []string{"apple", "disney", "hulu", "netflix", "spotify"} {
+			require.NoError(t, repo.Create(ctx, newSub(name, 100*(i+1), "2025-01-01")))
+		}
+		require.NoError(t, repo.Create(ctx, &domain.Subscription{
+			UserID: otherUserID, ServiceName: "other", Price: 100, Currency: "RUB",
+			StartDate: shortDate("2025-01-01"), BillingPeriod: domain.BillingMonthly, BillingInterval: 1,
+		}))
+
+		filter := domain.ListFilter{UserID: userID, Sort: domain.ListSort{Field: domain.SortByPrice, Desc: true}, Limit: 2}
+		var names []string
+		for {
+			page, err := repo.List(ctx, filter)
+			require.NoError(t, err)
+			for _, sub := range page {
+				names = append(names, sub.ServiceName)
+			}
+			if len(page) < filter.Limit {
+				break
+			}
+			cursor := domain.NewCursor(filter.Sort, page[len(page)-1])
+			filter.After = &cursor
+		}
+		assert.Equal(t, []string{"spotify", "netflix", "hulu", "disney", "apple"}, names)
+
+		page, err := repo.List(ctx, domain.ListFilter{UserID: userID, Sort: domain.ListSort{Field: domain.SortByServiceName}, Limit: 2, Offset: 3})
+		require.NoError(t, err)
+		require.Len(t, page, 2)
+		assert.Equal(t, "netflix", page[0].ServiceName)
+		assert.Equal(t, "spotify", page[1].ServiceName)
+
+		count, err := repo.Count(ctx, domain.ListFilter{UserID: userID})
+		require.NoError(t, err)
+		assert.Equal(t, 5, count)
+	})
+
+	t.Run("ListFilters", func(t *testing.T) {
+		repo := newRepo(t)
+		require.NoError(t, repo.Create(ctx, newSub("Netflix", 400, "2025-01-01")))
+		require.NoError(t, repo.Create(ctx, newSub("netflix premium", 900, "2025-01-01")))
+		require.NoError(t, repo.Create(ctx, newSub("spotify", 200, "2025-01-01")))
+
+		minPrice := 300
+		filter := domain.ListFilter{UserID: userID, ServiceNamePrefix: "netf", MinPrice: &minPrice}
+		subs, err := repo.List(ctx, filter)
+		require.NoError(t, err)
+		assert.Len(t, subs, 2)
+
+		maxPrice := 500
+		filter.MaxPrice = &maxPrice
+		count, err := repo.Count(ctx, filter)
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("ListForPeriod", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+		ended := newSub("spotify", 200, "2024-01-01")
+		ended.EndDate = ptr(shortDate("2024-06-01"))
+		require.NoError(t, repo.Create(ctx, ended))
+		require.NoError(t, repo.AddPrice(ctx, sub.ID, domain.PricePoint{EffectiveFrom: shortDate("2025-03-01"), Price: 500, Currency: "RUB"}))
+
+		subs, err := repo.ListForPeriod(ctx, domain.CostFilter{UserID: userID, From: month("2025-01-01"), To: month("2025-06-01")})
+		require.NoError(t, err)
+		require.Len(t, subs, 1)
+		assert.Equal(t, sub.ID, subs[0].ID)
+		require.Len(t, subs[0].Prices, 2)
+		assert.Equal(t, 400, subs[0].Prices[0].Price)
+		assert.Equal(t, 500, subs[0].Prices[1].Price)
+	})
+
+	t.Run("AddPrice", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+
+		price := domain.PricePoint{EffectiveFrom: shortDate("2025-03-01"), Price: 500, Currency: "RUB"}
+		require.NoError(t, repo.AddPrice(ctx, sub.ID, price))
+		price.Price = 550
+		require.NoError(t, repo.AddPrice(ctx, sub.ID, price))
+
+		history, err := repo.PriceHistory(ctx, sub.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 2)
+		assert.Equal(t, 550, history[1].Price)
+
+		got, err := repo.GetByID(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 550, got.Price)
+		assert.Greater(t, got.Version, 1)
+
+		history, err = repo.PriceHistory(ctx, uuid.NewString())
+		require.NoError(t, err)
+		assert.Empty(t, history)
+	})
+
+	t.Run("TenantIsolation", func(t *testing.T) {
+		repo := newRepo(t)
+		acme := domain.WithTenant(ctx, "acme")
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(acme, sub))
+		assert.Equal(t, "acme", sub.TenantID)
+		own := newSub("netflix", 300, "2024-01-01")
+		require.NoError(t, repo.Create(ctx, own))
+
+		got, err := repo.Get(acme, userID, "netflix")
+		require.NoError(t, err)
+		assert.Equal(t, sub.ID, got.ID)
+		assert.Equal(t, "acme", got.TenantID)
+		got, err = repo.Get(ctx, userID, "netflix")
+		require.NoError(t, err)
+		assert.Equal(t, own.ID, got.ID)
+		assert.Equal(t, domain.DefaultTenant, got.TenantID)
+
+		_, err = repo.GetByID(ctx, sub.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		_, err = repo.Patch(ctx, sub.ID, 0, domain.SubscriptionPatch{Price: ptr(1)})
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		update := newSub("netflix", 1, "2025-01-01")
+		update.ID = sub.ID
+		assert.ErrorIs(t, repo.Update(ctx, update), domain.ErrNotFound)
+		assert.ErrorIs(t, repo.AddPrice(ctx, sub.ID, domain.PricePoint{EffectiveFrom: shortDate("2025-03-01"), Price: 1, Currency: "RUB"}), domain.ErrNotFound)
+		assert.ErrorIs(t, repo.DeleteByID(ctx, sub.ID, 0), domain.ErrNotFound)
+		history, err := repo.PriceHistory(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+
+		subs, err := repo.List(acme, domain.ListFilter{Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, subs, 1)
+		assert.Equal(t, sub.ID, subs[0].ID)
+		count, err := repo.Count(ctx, domain.ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+		subs, err = repo.ListForPeriod(acme, domain.CostFilter{To: month("2025-06-01")})
+		require.NoError(t, err)
+		require.Len(t, subs, 1)
+		assert.Equal(t, sub.ID, subs[0].ID)
+
+		require.NoError(t, repo.Delete(acme, userID, "netflix", 0))
+		_, err = repo.Get(ctx, userID, "netflix")
+		assert.NoError(t, err)
+	})
+
+	t.Run("Users", func(t *testing.T) {
+		users := newRepos(t).Users
+		user := &domain.User{DisplayName: "Alex", Email: "alex@example.com", Currency: "USD", Timezone: "Europe/Moscow"}
+		require.NoError(t, users.Create(ctx, user))
+		assert.NotEmpty(t, user.ID)
+		assert.Equal(t, domain.DefaultTenant, user.TenantID)
+
+		got, err := users.Get(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "alex@example.com", got.Email)
+		assert.Equal(t, "Europe/Moscow", got.Timezone)
+		_, err = users.Get(domain.WithTenant(ctx, "acme"), user.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+
+		taken := &domain.User{Email: "ALEX@example.com", Currency: "RUB", Timezone: "UTC"}
+		assert.ErrorIs(t, users.Create(ctx, taken), domain.ErrConflict)
+		require.NoError(t, users.Create(domain.WithTenant(ctx, "acme"), taken))
+		assert.ErrorIs(t, users.Create(ctx, &domain.User{ID: user.ID, Currency: "RUB", Timezone: "UTC"}), domain.ErrConflict)
+		other := &domain.User{Currency: "RUB", Timezone: "UTC"}
+		require.NoError(t, users.Create(ctx, other))
+
+		user.DisplayName = "Alexander"
+		user.Currency = "EUR"
+		require.NoError(t, users.Update(ctx, user))
+		assert.Equal(t, "Alexander", user.DisplayName)
+		assert.Equal(t, "alex@example.com", user.Email)
+		other.Email = "Alex@Example.com"
+		assert.ErrorIs(t, users.Update(ctx, other), domain.ErrConflict)
+		assert.ErrorIs(t, users.Update(ctx, &domain.User{ID: uuid.NewString()}), domain.ErrNotFound)
+
+		list, err := users.List(ctx, 10, 0)
+		require.NoError(t, err)
+		require.Len(t, list, 2)
+		assert.Equal(t, user.ID, list[0].ID)
+		assert.Equal(t, "EUR", list[0].Currency)
+		list, err = users.List(ctx, 10, 1)
+		require.NoError(t, err)
+		require.Len(t, list, 1)
+		assert.Equal(t, other.ID, list[0].ID)
+
+		require.NoError(t, users.Delete(ctx, user.ID))
+		assert.ErrorIs(t, users.Delete(ctx, user.ID), domain.ErrNotFound)
+		_, err = users.Get(ctx, user.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+	})
+
+	t.Run("UserRequired", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		sub.UserID = uuid.NewString()
+		assert.ErrorIs(t, repo.Create(ctx, sub), domain.ErrUnknownUser)
+	})
+
+	t.Run("DeleteUserCascades", func(t *testing.T) {
+		repos := newRepos(t)
+		acme := domain.WithTenant(ctx, "acme")
+		for _, c := range []context.Context{ctx, acme} {
+			require.NoError(t, repos.Users.Create(c, &domain.User{ID: userID, Currency: "RUB", Timezone: "UTC"}))
+		}
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repos.Subscriptions.Create(ctx, sub))
+		require.NoError(t, repos.Subscriptions.AddPrice(ctx, sub.ID, domain.PricePoint{EffectiveFrom: shortDate("2025-03-01"), Price: 500, Currency: "RUB"}))
+		require.NoError(t, repos.Subscriptions.Create(acme, newSub("netflix", 400, "2025-01-01")))
+
+		require.NoError(t, repos.Users.Delete(ctx, userID))
+		_, err := repos.Subscriptions.GetByID(ctx, sub.ID)
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		history, err := repos.Subscriptions.PriceHistory(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Empty(t, history)
+		count, err := repos.Subscriptions.Count(acme, domain.ListFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, count)
+	})
+
+	t.Run("Members", func(t *testing.T) {
+		repos := newRepos(t)
+		member := &domain.User{Currency: "RUB", Timezone: "UTC"}
+		for _, user := range []*domain.User{{ID: userID, Currency: "RUB", Timezone: "UTC"}, member} {
+			require.NoError(t, repos.Users.Create(ctx, user))
+		}
+		repo := repos.Subscriptions
+		sub := newSub("spotify family", 900, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+		own := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, own))
+
+		members, err := repo.Members(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Empty(t, members)
+
+		want := []domain.Member{{UserID: member.ID, Amount: ptr(300)}, {UserID: userID, Weight: 1}}
+		require.NoError(t, repo.SetMembers(ctx, sub.ID, want))
+		members, err = repo.Members(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, want, members)
+		members, err = repo.Members(domain.WithTenant(ctx, "acme"), sub.ID)
+		require.NoError(t, err)
+		assert.Empty(t, members)
+		assert.ErrorIs(t, repo.SetMembers(domain.WithTenant(ctx, "acme"), sub.ID, nil), domain.ErrNotFound)
+		assert.ErrorIs(t, repo.SetMembers(ctx, sub.ID, []domain.Member{{UserID: uuid.NewString(), Weight: 1}}), domain.ErrUnknownUser)
+
+		subs, err := repo.ListForPeriod(ctx, domain.CostFilter{UserID: member.ID, To: month("2025-06-01")})
+		require.NoError(t, err)
+		require.Len(t, subs, 1)
+		assert.Equal(t, sub.ID, subs[0].ID)
+		assert.Equal(t, want, subs[0].Members)
+		subs, err = repo.ListForPeriod(ctx, domain.CostFilter{UserID: userID, To: month("2025-06-01")})
+		require.NoError(t, err)
+		assert.Len(t, subs, 2)
+
+		require.NoError(t, repos.Users.Delete(ctx, member.ID))
+		members, err = repo.Members(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []domain.Member{{UserID: userID, Weight: 1}}, members)
+
+		require.NoError(t, repo.SetMembers(ctx, sub.ID, nil))
+		members, err = repo.Members(ctx, sub.ID)
+		require.NoError(t, err)
+		assert.Empty(t, members)
+	})
+
+	t.Run("ConcurrentPatch", func(t *testing.T) {
+		repo := newRepo(t)
+		sub := newSub("netflix", 400, "2025-01-01")
+		require.NoError(t, repo.Create(ctx, sub))
+
+		const writers = 8
+		var wg sync.WaitGroup
+		errs := make([]error, writers)
+		for i := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				price := 500 + i
+				_, errs[i] = repo.Patch(ctx, sub.ID, 1, domain.SubscriptionPatch{Price: &price})
+			}()
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			if err == nil {
+				succeeded++
+			} else {
+				assert.ErrorIs(t, err, domain.ErrVersionMismatch)
+			}
+		}
+		assert.Equal(t, 1, succeeded)
+	})
+}
+
+func month(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func shortDate(s string) domain.ShortDate {
+	return domain.ShortDate{Time: month(s)}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
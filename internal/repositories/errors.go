@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// wrapError prefixes err with msg and maps database errors to domain errors.
+// The original error stays in the chain for callers inspecting it.
+func wrapError(msg string, err error) error {
+	switch {
+	case utils.IsErrorCode(err, utils.ErrQueryCanceled):
+		// Queries are canceled when the context of the request is done.
+		return fmt.Errorf("%s: %w: %w", msg, context.DeadlineExceeded, err)
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%s: %w", msg, domain.ErrNotFound)
+	case utils.IsErrorCode(err, utils.ErrUniqueViolation):
+		return fmt.Errorf("%s: %w: %w", msg, domain.ErrConflict, err)
+	case utils.IsErrorCode(err, utils.ErrForeignKeyViolation):
+		return fmt.Errorf("%s: %w: %w", msg, domain.ErrNotFound, err)
+	case utils.IsErrorCode(err, utils.ErrCheckViolation),
+		utils.IsErrorCode(err, utils.ErrInvalidTextRepresentation):
+		return fmt.Errorf("%s: %w: %w", msg, domain.ErrValidation, err)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// checkAffected returns domain.ErrNotFound if the statement changed no rows.
+func checkAffected(msg string, res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s: %w", msg, domain.ErrNotFound)
+	}
+	return nil
+}
+
+// versionError maps a failed conditional change of the subscription with the
+// id to domain.ErrVersionMismatch if the subscription still exists.
+func versionError(ctx context.Context, q sqlx.QueryerContext, msg, id string, err error) error {
+	if !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, domain.ErrNotFound) {
+		return wrapError(msg, err)
+	}
+	var exists bool
+	err = sqlx.GetContext(ctx, q, &exists, `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE id = $1 AND tenant_id = $2)`,
+		id, domain.TenantFromContext(ctx))
+	if err != nil {
+		return wrapError(msg, err)
+	}
+	if exists {
+		return fmt.Errorf("%s: %w", msg, domain.ErrVersionMismatch)
+	}
+	return fmt.Errorf("%s: %w", msg, domain.ErrNotFound)
+}
+
+// checkTenant returns domain.ErrNotFound unless the subscription with the id
+// belongs to the tenant of the context
+func checkTenant(ctx context.Context, q sqlx.QueryerContext, id string) error {
+	var exists bool
+	err := sqlx.GetContext(ctx, q, &exists, `SELECT EXISTS (SELECT 1 FROM subscriptions WHERE id = $1 AND tenant_id = $2)`,
+		id, domain.TenantFromContext(ctx))
+	if err != nil {
+		return wrapError("failed to check subscription tenant", err)
+	}
+	if !exists {
+		return domain.ErrNotFound
+	}
+	return nil
+}
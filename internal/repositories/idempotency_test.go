@@ -0,0 +1,131 @@
+package repositories_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/db"
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/repositories"
+	"github.com/alexputin/subscriptions/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	testIdempotencyStoreContract(t, func(t *testing.T) domain.IdempotencyStore {
+		return repositories.NewMemoryIdempotencyStore()
+	})
+}
+
+func TestPostgresIdempotencyStore(t *testing.T) {
+	url := os.Getenv(testDatabaseURLEnv)
+	if url == "" {
+		t.Skipf("%s is not set", testDatabaseURLEnv)
+	}
+	conn, err := db.CreatePostgresConnection(url)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	testIdempotencyStoreContract(t, func(t *testing.T) domain.IdempotencyStore {
+		_, err := conn.Exec(`TRUNCATE idempotency_keys`)
+		require.NoError(t, err)
+		return repositories.NewPostgresIdempotencyStore(conn)
+	})
+}
+
+func TestSQLiteIdempotencyStore(t *testing.T) {
+	testIdempotencyStoreContract(t, func(t *testing.T) domain.IdempotencyStore {
+		conn, err := db.CreateSQLiteConnection(filepath.Join(t.TempDir(), "subscriptions.db"))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+
+		migrator, err := db.NewMigrator(conn, migrations.SQLite)
+		require.NoError(t, err)
+		_, err = migrator.Up(context.Background())
+		require.NoError(t, err)
+		return repositories.NewSQLiteIdempotencyStore(conn)
+	})
+}
+
+// testIdempotencyStoreContract checks the behaviour every IdempotencyStore
+// must share, newStore returns an empty store.
+func testIdempotencyStoreContract(t *testing.T, newStore func(t *testing.T) domain.IdempotencyStore) {
+	ctx := context.Background()
+	pending := func(key string) domain.IdempotencyRecord {
+		return domain.IdempotencyRecord{
+			Key:         key,
+			RequestHash: "hash",
+			Body:        []byte{},
+			ExpiresAt:   time.Now().Add(time.Minute),
+		}
+	}
+	completed := func(key string) domain.IdempotencyRecord {
+		record := pending(key)
+		record.StatusCode = 201
+		record.Header = map[string]string{"Content-Type": "application/json"}
+		record.Body = []byte(`{"id":"1"}`)
+		record.ExpiresAt = time.Now().Add(time.Hour)
+		return record
+	}
+
+	t.Run("reserve and complete", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, store.Save(ctx, pending("key")))
+
+		got, err := store.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.True(t, got.Pending())
+		assert.Equal(t, "hash", got.RequestHash)
+
+		assert.ErrorIs(t, store.Save(ctx, pending("key")), domain.ErrConflict)
+
+		require.NoError(t, store.Complete(ctx, completed("key")))
+		got, err = store.Get(ctx, "key")
+		require.NoError(t, err)
+		assert.False(t, got.Pending())
+		assert.Equal(t, 201, got.StatusCode)
+		assert.Equal(t, map[string]string{"Content-Type": "application/json"}, got.Header)
+		assert.Equal(t, []byte(`{"id":"1"}`), got.Body)
+
+		// A completed record is not completed or released again.
+		assert.ErrorIs(t, store.Complete(ctx, completed("key")), domain.ErrNotFound)
+		require.NoError(t, store.Release(ctx, "key"))
+		_, err = store.Get(ctx, "key")
+		assert.NoError(t, err)
+	})
+
+	t.Run("complete without reservation", func(t *testing.T) {
+		store := newStore(t)
+		assert.ErrorIs(t, store.Complete(ctx, completed("key")), domain.ErrNotFound)
+
+		require.NoError(t, store.Save(ctx, pending("key")))
+		other := completed("key")
+		other.RequestHash = "other"
+		assert.ErrorIs(t, store.Complete(ctx, other), domain.ErrNotFound)
+	})
+
+	t.Run("release", func(t *testing.T) {
+		store := newStore(t)
+		require.NoError(t, store.Save(ctx, pending("key")))
+		require.NoError(t, store.Release(ctx, "key"))
+
+		_, err := store.Get(ctx, "key")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.NoError(t, store.Save(ctx, pending("key")))
+	})
+
+	t.Run("expired reservation", func(t *testing.T) {
+		store := newStore(t)
+		record := pending("key")
+		record.ExpiresAt = time.Now().Add(-time.Second)
+		require.NoError(t, store.Save(ctx, record))
+
+		_, err := store.Get(ctx, "key")
+		assert.ErrorIs(t, err, domain.ErrNotFound)
+		assert.NoError(t, store.Save(ctx, pending("key")))
+	})
+}
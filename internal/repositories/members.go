@@ -0,0 +1,82 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// The members of subscriptions are stored with portable queries, shared by
+// the PostgreSQL and SQLite repositories.
+
+// subscriptionMember is a member of the subscription with the ID
+type subscriptionMember struct {
+	SubscriptionID string `db:"subscription_id"`
+	domain.Member
+}
+
+// listMembers returns the members of the subscription with the id in the
+// tenant of the context
+func listMembers(ctx context.Context, q sqlx.QueryerContext, subscriptionID string) ([]domain.Member, error) {
+	members := []domain.Member{}
+	err := sqlx.SelectContext(ctx, q, &members, `SELECT m.user_id, m.weight, m.amount FROM subscription_members m JOIN subscriptions s ON s.id = m.subscription_id
+		WHERE m.subscription_id = $1 AND s.tenant_id = $2 ORDER BY m.position`,
+		subscriptionID, domain.TenantFromContext(ctx))
+	if err != nil {
+		return nil, wrapError("failed to get subscription members", err)
+	}
+	return members, nil
+}
+
+// setMembers replaces the members of the subscription with the id
+func setMembers(ctx context.Context, db dbtx, subscriptionID string, members []domain.Member) error {
+	tx, err := begin(ctx, db)
+	if err != nil {
+		return wrapError("failed to set subscription members", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkTenant(ctx, tx, subscriptionID); err != nil {
+		return fmt.Errorf("failed to set subscription members: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM subscription_members WHERE subscription_id = $1`, subscriptionID); err != nil {
+		return wrapError("failed to set subscription members", err)
+	}
+	for i, m := range members {
+		_, err := tx.ExecContext(ctx, `INSERT INTO subscription_members (subscription_id, tenant_id, user_id, position, weight, amount) VALUES ($1, $2, $3, $4, $5, $6)`,
+			subscriptionID, domain.TenantFromContext(ctx), m.UserID, i, m.Weight, m.Amount)
+		if utils.IsErrorCode(err, utils.ErrForeignKeyViolation) {
+			return fmt.Errorf("failed to set subscription members: %w: %w", domain.ErrUnknownUser, err)
+		}
+		if err != nil {
+			return wrapError("failed to set subscription members", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError("failed to set subscription members", err)
+	}
+	return nil
+}
+
+// loadMembers sets the members of subs, the subscriptions s matching where
+func loadMembers(ctx context.Context, q sqlx.QueryerContext, subs []domain.Subscription, where string, args ...any) error {
+	var members []subscriptionMember
+	err := sqlx.SelectContext(ctx, q, &members, `SELECT m.subscription_id, m.user_id, m.weight, m.amount FROM subscription_members m
+		JOIN subscriptions s ON s.id = m.subscription_id WHERE `+where+` ORDER BY m.position`, args...)
+	if err != nil {
+		return wrapError("failed to list subscription members for period", err)
+	}
+
+	byID := make(map[string][]domain.Member, len(subs))
+	for _, m := range members {
+		byID[m.SubscriptionID] = append(byID[m.SubscriptionID], m.Member)
+	}
+	for i := range subs {
+		subs[i].Members = byID[subs[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
+
+// MemoryIdempotencyStore keeps idempotency records in memory, for tests and
+// single instance deployments.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]domain.IdempotencyRecord
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		records: make(map[string]domain.IdempotencyRecord),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || !record.ExpiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("failed to get idempotency key: %w", domain.ErrNotFound)
+	}
+	return cloneIdempotencyRecord(record), nil
+}
+
+func (s *MemoryIdempotencyStore) Save(ctx context.Context, record domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.records[record.Key]; ok && existing.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("failed to save idempotency key: %w", domain.ErrConflict)
+	}
+	s.records[record.Key] = *cloneIdempotencyRecord(record)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, record domain.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.records[record.Key]
+	if !ok || !existing.Pending() || existing.RequestHash != record.RequestHash {
+		return fmt.Errorf("failed to complete idempotency key: %w", domain.ErrNotFound)
+	}
+	s.records[record.Key] = *cloneIdempotencyRecord(record)
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record, ok := s.records[key]; ok && record.Pending() {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	maps.DeleteFunc(s.records, func(_ string, record domain.IdempotencyRecord) bool {
+		return !record.ExpiresAt.After(before)
+	})
+	return nil
+}
+
+// cloneIdempotencyRecord copies the record so callers cannot modify the store
+func cloneIdempotencyRecord(record domain.IdempotencyRecord) *domain.IdempotencyRecord {
+	record.Header = maps.Clone(record.Header)
+	record.Body = slices.Clone(record.Body)
+	return &record
+}
@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/google/uuid"
+)
+
+// userKey identifies a user, user IDs are unique in their tenant.
+type userKey struct {
+	tenantID string
+	id       string
+}
+
+// MemoryUserRepository keeps users in memory with the semantics of the SQL
+// repository, for tests and trying out the service.
+type MemoryUserRepository struct {
+	mu    sync.RWMutex
+	users map[userKey]domain.User
+	// subs are the subscriptions of the users, deleted with them
+	subs *MemoryUserSubscriptionRepository
+}
+
+// NewMemoryUserRepository returns the users of the subscriptions, which from
+// then on can only be created for existing users and are deleted with them.
+func NewMemoryUserRepository(subs *MemoryUserSubscriptionRepository) *MemoryUserRepository {
+	r := &MemoryUserRepository{
+		users: make(map[userKey]domain.User),
+		subs:  subs,
+	}
+	subs.users = r
+	return r
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *domain.User) error {
+	if user.ID == "" {
+		user.ID = uuid.NewString()
+	}
+	user.TenantID = domain.TenantFromContext(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := userKey{user.TenantID, user.ID}
+	if _, ok := r.users[key]; ok || r.emailTaken(*user) {
+		return fmt.Errorf("failed to create user: %w", domain.ErrConflict)
+	}
+	user.CreatedAt = time.Now().UTC()
+	user.UpdatedAt = user.CreatedAt
+	r.users[key] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) Get(ctx context.Context, id string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[userKey{domain.TenantFromContext(ctx), id}]
+	if !ok {
+		return nil, fmt.Errorf("failed to get user: %w", domain.ErrNotFound)
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := userKey{domain.TenantFromContext(ctx), user.ID}
+	updated, ok := r.users[key]
+	if !ok {
+		return fmt.Errorf("failed to update user: %w", domain.ErrNotFound)
+	}
+	updated.DisplayName = user.DisplayName
+	updated.Email = user.Email
+	updated.Currency = user.Currency
+	updated.Timezone = user.Timezone
+	if r.emailTaken(updated) {
+		return fmt.Errorf("failed to update user: %w", domain.ErrConflict)
+	}
+	updated.UpdatedAt = time.Now().UTC()
+	r.users[key] = updated
+	*user = updated
+	return nil
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, id string) error {
+	tenantID := domain.TenantFromContext(ctx)
+
+	r.mu.Lock()
+	key := userKey{tenantID, id}
+	_, ok := r.users[key]
+	delete(r.users, key)
+	r.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("failed to delete user: %w", domain.ErrNotFound)
+	}
+	r.subs.deleteUser(tenantID, id)
+	return nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenantID := domain.TenantFromContext(ctx)
+	users := []domain.User{}
+	for key, user := range r.users {
+		if key.tenantID == tenantID {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b domain.User) int {
+		return cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	users = users[min(offset, len(users)):]
+	return users[:min(limit, len(users))], nil
+}
+
+func (r *MemoryUserRepository) exists(tenantID, id string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	_, ok := r.users[userKey{tenantID, id}]
+	return ok
+}
+
+// emailTaken reports whether another user of the tenant has the email of
+// the user
+func (r *MemoryUserRepository) emailTaken(user domain.User) bool {
+	if user.Email == "" {
+		return false
+	}
+	for key, other := range r.users {
+		if key.tenantID == user.TenantID && key.id != user.ID && strings.EqualFold(other.Email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,520 @@
+package repositories
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/google/uuid"
+)
+
+// MemoryUserSubscriptionRepository keeps subscriptions in memory with the
+// semantics of the Postgres repository, for tests and trying out the service.
+type MemoryUserSubscriptionRepository struct {
+	mu   sync.RWMutex
+	subs map[string]domain.Subscription
+	// prices are the price histories by subscription ID, ordered by
+	// effective month
+	prices map[string][]domain.PricePoint
+	// members are the members by subscription ID, in their order
+	members map[string][]domain.Member
+	// users are the owners of the subscriptions, if set by
+	// NewMemoryUserRepository
+	users *MemoryUserRepository
+}
+
+func NewMemoryUserSubscriptionRepository() *MemoryUserSubscriptionRepository {
+	return &MemoryUserSubscriptionRepository{
+		subs:    make(map[string]domain.Subscription),
+		prices:  make(map[string][]domain.PricePoint),
+		members: make(map[string][]domain.Member),
+	}
+}
+
+func (r *MemoryUserSubscriptionRepository) Create(ctx context.Context, sub *domain.Subscription) error {
+	if sub.ID == "" {
+		sub.ID = uuid.NewString()
+	}
+	sub.TenantID = domain.TenantFromContext(ctx)
+	if err := validateRow(*sub); err != nil {
+		return fmt.Errorf("failed to create subscription: %w", err)
+	}
+	if r.users != nil && !r.users.exists(sub.TenantID, sub.UserID) {
+		return fmt.Errorf("failed to create subscription: %w", domain.ErrUnknownUser)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.subs[sub.ID]; ok {
+		return fmt.Errorf("failed to create subscription: %w", domain.ErrConflict)
+	}
+	sub.Version = 1
+	r.subs[sub.ID] = cloneSubscription(*sub)
+	r.prices[sub.ID] = []domain.PricePoint{{EffectiveFrom: sub.StartDate, Price: sub.Price, Currency: sub.Currency}}
+	return nil
+}
+
+// Get returns the latest subscription of the user to the service.
+func (r *MemoryUserSubscriptionRepository) Get(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sub, ok := r.latest(domain.TenantFromContext(ctx), userID, serviceName)
+	if !ok {
+		return nil, fmt.Errorf("failed to get subscription: %w", domain.ErrNotFound)
+	}
+	return &sub, nil
+}
+
+func (r *MemoryUserSubscriptionRepository) GetByID(ctx context.Context, id string) (*domain.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sub, ok := r.subs[id]
+	if !ok || sub.TenantID != domain.TenantFromContext(ctx) {
+		return nil, fmt.Errorf("failed to get subscription: %w", domain.ErrNotFound)
+	}
+	sub = cloneSubscription(sub)
+	return &sub, nil
+}
+
+// Update updates the subscription with sub.ID, or the latest subscription of
+// the user to the service if the ID is not set.
+func (r *MemoryUserSubscriptionRepository) Update(ctx context.Context, sub *domain.Subscription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tenantID := domain.TenantFromContext(ctx)
+	id := sub.ID
+	if id == "" {
+		latest, ok := r.latest(tenantID, sub.UserID, sub.ServiceName)
+		if !ok {
+			return fmt.Errorf("failed to update subscription: %w", domain.ErrNotFound)
+		}
+		id = latest.ID
+	}
+	current, err := r.checkVersion(tenantID, id, sub.Version)
+	if err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+
+	updated := current
+	updated.StartDate = sub.StartDate
+	updated.EndDate = sub.EndDate
+	updated.Price = sub.Price
+	updated.Currency = sub.Currency
+	updated.BillingPeriod = sub.BillingPeriod
+	updated.BillingInterval = sub.BillingInterval
+	if err := validateRow(updated); err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	updated.Version++
+
+	r.subs[id] = cloneSubscription(updated)
+	r.recordPriceChange(updated)
+	*sub = cloneSubscription(updated)
+	return nil
+}
+
+// Patch updates the fields set in the patch of the subscription with the id.
+func (r *MemoryUserSubscriptionRepository) Patch(ctx context.Context, id string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := r.checkVersion(domain.TenantFromContext(ctx), id, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to patch subscription: %w", err)
+	}
+
+	patched := cloneSubscription(current)
+	patch.Apply(&patched)
+	if err := validateRow(patched); err != nil {
+		return nil, fmt.Errorf("failed to patch subscription: %w", err)
+	}
+	patched.Version++
+
+	r.subs[id] = cloneSubscription(patched)
+	if patch.Price != nil || patch.Currency != nil {
+		r.recordPriceChange(patched)
+	}
+	return &patched, nil
+}
+
+// Delete deletes the latest subscription of the user to the service.
+func (r *MemoryUserSubscriptionRepository) Delete(ctx context.Context, userID, serviceName string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	latest, ok := r.latest(domain.TenantFromContext(ctx), userID, serviceName)
+	if !ok {
+		return fmt.Errorf("failed to delete subscription: %w", domain.ErrNotFound)
+	}
+	if version != 0 && latest.Version != version {
+		return fmt.Errorf("failed to delete subscription: %w", domain.ErrVersionMismatch)
+	}
+	r.delete(latest.ID)
+	return nil
+}
+
+func (r *MemoryUserSubscriptionRepository) DeleteByID(ctx context.Context, id string, version int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.checkVersion(domain.TenantFromContext(ctx), id, version); err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	r.delete(id)
+	return nil
+}
+
+func (r *MemoryUserSubscriptionRepository) List(ctx context.Context, filter domain.ListFilter) ([]domain.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	subs := r.filter(domain.TenantFromContext(ctx), filter)
+	sortField := filter.Sort.Field
+	if !sortField.Valid() {
+		sortField = domain.SortByServiceName
+	}
+	compare := func(a, b domain.Subscription) int {
+		c := compareBy(sortField, a, b)
+		if c == 0 {
+			c = strings.Compare(a.ID, b.ID)
+		}
+		if filter.Sort.Desc {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(subs, compare)
+
+	if filter.After != nil {
+		after, err := cursorSubscription(*filter.After)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list subscriptions: %w", domain.ErrValidation)
+		}
+		i, _ := slices.BinarySearchFunc(subs, after, compare)
+		for i < len(subs) && compare(subs[i], after) <= 0 {
+			i++
+		}
+		subs = subs[i:]
+	} else {
+		subs = subs[min(filter.Offset, len(subs)):]
+	}
+	if filter.Limit > 0 && len(subs) > filter.Limit {
+		subs = subs[:filter.Limit]
+	}
+
+	result := make([]domain.Subscription, 0, len(subs))
+	for _, sub := range subs {
+		result = append(result, cloneSubscription(sub))
+	}
+	return result, nil
+}
+
+func (r *MemoryUserSubscriptionRepository) Count(ctx context.Context, filter domain.ListFilter) (int, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.filter(domain.TenantFromContext(ctx), filter)), nil
+}
+
+func (r *MemoryUserSubscriptionRepository) ListForPeriod(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	tenantID := domain.TenantFromContext(ctx)
+	from, to := filter.Period()
+	var subs []domain.Subscription
+	for _, sub := range r.subs {
+		switch {
+		case sub.TenantID != tenantID,
+			sub.StartDate.After(to),
+			!from.IsZero() && sub.EndDate != nil && sub.EndDate.Before(from),
+			filter.UserID != "" && sub.UserID != filter.UserID && !r.isMember(sub.ID, filter.UserID),
+			len(filter.ServiceNames) > 0 && !slices.Contains(filter.ServiceNames, sub.ServiceName):
+			continue
+		}
+		sub = cloneSubscription(sub)
+		sub.Prices = slices.Clone(r.prices[sub.ID])
+		sub.Members = cloneMembers(r.members[sub.ID])
+		subs = append(subs, sub)
+	}
+	return subs, nil
+}
+
+func (r *MemoryUserSubscriptionRepository) PriceHistory(ctx context.Context, subscriptionID string) ([]domain.PricePoint, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var prices []domain.PricePoint
+	if sub, ok := r.subs[subscriptionID]; ok && sub.TenantID == domain.TenantFromContext(ctx) {
+		prices = slices.Clone(r.prices[subscriptionID])
+	}
+	if prices == nil {
+		prices = []domain.PricePoint{}
+	}
+	return prices, nil
+}
+
+func (r *MemoryUserSubscriptionRepository) AddPrice(ctx context.Context, subscriptionID string, price domain.PricePoint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.subs[subscriptionID]
+	if !ok || sub.TenantID != domain.TenantFromContext(ctx) {
+		return fmt.Errorf("failed to add subscription price: %w", domain.ErrNotFound)
+	}
+	r.upsertPrice(subscriptionID, price)
+
+	// Keep the current price of the subscription in sync with its history.
+	if current, ok := r.priceAt(subscriptionID, effectiveMonth(sub)); ok {
+		sub.Price = current.Price
+		sub.Currency = current.Currency
+		sub.Version++
+		r.subs[subscriptionID] = sub
+	}
+	return nil
+}
+
+func (r *MemoryUserSubscriptionRepository) Members(ctx context.Context, subscriptionID string) ([]domain.Member, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := []domain.Member{}
+	if sub, ok := r.subs[subscriptionID]; ok && sub.TenantID == domain.TenantFromContext(ctx) {
+		members = append(members, cloneMembers(r.members[subscriptionID])...)
+	}
+	return members, nil
+}
+
+func (r *MemoryUserSubscriptionRepository) SetMembers(ctx context.Context, subscriptionID string, members []domain.Member) error {
+	tenantID := domain.TenantFromContext(ctx)
+	for _, m := range members {
+		if r.users != nil && !r.users.exists(tenantID, m.UserID) {
+			return fmt.Errorf("failed to set subscription members: %w", domain.ErrUnknownUser)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub, ok := r.subs[subscriptionID]
+	if !ok || sub.TenantID != tenantID {
+		return fmt.Errorf("failed to set subscription members: %w", domain.ErrNotFound)
+	}
+	if err := domain.ValidateMembers(members); err != nil {
+		return fmt.Errorf("failed to set subscription members: %w", err)
+	}
+	r.members[subscriptionID] = cloneMembers(members)
+	return nil
+}
+
+// latest returns the subscription of the user of the tenant to the service
+// with the latest start date
+func (r *MemoryUserSubscriptionRepository) latest(tenantID, userID, serviceName string) (domain.Subscription, bool) {
+	var latest domain.Subscription
+	found := false
+	for _, sub := range r.subs {
+		if sub.TenantID != tenantID || sub.UserID != userID || sub.ServiceName != serviceName {
+			continue
+		}
+		if !found || sub.StartDate.After(latest.StartDate.Time) ||
+			sub.StartDate.Equal(latest.StartDate.Time) && sub.ID < latest.ID {
+			latest = sub
+			found = true
+		}
+	}
+	return cloneSubscription(latest), found
+}
+
+// checkVersion returns the subscription of the tenant with the id if it has
+// the version, 0 matches any version
+func (r *MemoryUserSubscriptionRepository) checkVersion(tenantID, id string, version int) (domain.Subscription, error) {
+	sub, ok := r.subs[id]
+	if !ok || sub.TenantID != tenantID {
+		return sub, domain.ErrNotFound
+	}
+	if version != 0 && sub.Version != version {
+		return sub, domain.ErrVersionMismatch
+	}
+	return sub, nil
+}
+
+func (r *MemoryUserSubscriptionRepository) delete(id string) {
+	delete(r.subs, id)
+	delete(r.prices, id)
+	delete(r.members, id)
+}
+
+// isMember reports whether the user is a member of the subscription
+func (r *MemoryUserSubscriptionRepository) isMember(id, userID string) bool {
+	return slices.ContainsFunc(r.members[id], func(m domain.Member) bool { return m.UserID == userID })
+}
+
+// deleteUser deletes the subscriptions of the user
+func (r *MemoryUserSubscriptionRepository) deleteUser(tenantID, userID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, sub := range r.subs {
+		switch {
+		case sub.TenantID != tenantID:
+		case sub.UserID == userID:
+			r.delete(id)
+		case r.isMember(id, userID):
+			r.members[id] = slices.DeleteFunc(r.members[id], func(m domain.Member) bool { return m.UserID == userID })
+		}
+	}
+}
+
+// filter returns the subscriptions of the tenant matching the filter,
+// ignoring its paging
+func (r *MemoryUserSubscriptionRepository) filter(tenantID string, filter domain.ListFilter) []domain.Subscription {
+	month := domain.CurrentMonth()
+	prefix := strings.ToLower(filter.ServiceNamePrefix)
+
+	var subs []domain.Subscription
+	for _, sub := range r.subs {
+		switch {
+		case sub.TenantID != tenantID,
+			filter.UserID != "" && sub.UserID != filter.UserID,
+			!filter.ActiveAt.IsZero() && !activeAt(sub, filter.ActiveAt),
+			filter.MinPrice != nil && sub.Price < *filter.MinPrice,
+			filter.MaxPrice != nil && sub.Price > *filter.MaxPrice,
+			!strings.HasPrefix(strings.ToLower(sub.ServiceName), prefix),
+			filter.Status == domain.StatusActive && !activeAt(sub, month),
+			filter.Status == domain.StatusEnded && (sub.EndDate == nil || !sub.EndDate.Before(month)),
+			filter.Status == domain.StatusUpcoming && !sub.StartDate.After(month):
+			continue
+		}
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// recordPriceChange records the current price of the subscription in its
+// history, if it differs from the price in effect
+func (r *MemoryUserSubscriptionRepository) recordPriceChange(sub domain.Subscription) {
+	month := effectiveMonth(sub)
+	if current, ok := r.priceAt(sub.ID, month); ok && current.Price == sub.Price && current.Currency == sub.Currency {
+		return
+	}
+	r.upsertPrice(sub.ID, domain.PricePoint{EffectiveFrom: domain.ShortDate{Time: month}, Price: sub.Price, Currency: sub.Currency})
+}
+
+// priceAt returns the latest price point effective in the month
+func (r *MemoryUserSubscriptionRepository) priceAt(id string, month time.Time) (domain.PricePoint, bool) {
+	var price domain.PricePoint
+	found := false
+	for _, p := range r.prices[id] {
+		if p.EffectiveFrom.After(month) {
+			break
+		}
+		price, found = p, true
+	}
+	return price, found
+}
+
+func (r *MemoryUserSubscriptionRepository) upsertPrice(id string, price domain.PricePoint) {
+	prices := r.prices[id]
+	i, found := slices.BinarySearchFunc(prices, price.EffectiveFrom.Time, func(p domain.PricePoint, t time.Time) int {
+		return p.EffectiveFrom.Compare(t)
+	})
+	if found {
+		prices[i] = price
+	} else {
+		prices = slices.Insert(prices, i, price)
+	}
+	r.prices[id] = prices
+}
+
+// effectiveMonth is the month price changes take effect from: the current
+// month, or the start of the subscription if it has not started yet
+func effectiveMonth(sub domain.Subscription) time.Time {
+	month := domain.CurrentMonth()
+	if sub.StartDate.After(month) {
+		return sub.StartDate.Time
+	}
+	return month
+}
+
+func activeAt(sub domain.Subscription, month time.Time) bool {
+	return !sub.StartDate.After(month) && (sub.EndDate == nil || !sub.EndDate.Before(month))
+}
+
+func compareBy(field domain.SortField, a, b domain.Subscription) int {
+	switch field {
+	case domain.SortByPrice:
+		return cmp.Compare(a.Price, b.Price)
+	case domain.SortByStartDate:
+		return a.StartDate.Compare(b.StartDate.Time)
+	}
+	return strings.Compare(a.ServiceName, b.ServiceName)
+}
+
+// cursorSubscription returns a subscription at the position of the cursor
+func cursorSubscription(c domain.Cursor) (domain.Subscription, error) {
+	sub := domain.Subscription{ID: c.ID}
+	switch c.Sort {
+	case domain.SortByPrice:
+		price, err := strconv.Atoi(c.Value)
+		if err != nil {
+			return sub, err
+		}
+		sub.Price = price
+	case domain.SortByStartDate:
+		start, err := time.Parse(time.DateOnly, c.Value)
+		if err != nil {
+			return sub, err
+		}
+		sub.StartDate = domain.ShortDate{Time: start}
+	default:
+		sub.ServiceName = c.Value
+	}
+	return sub, nil
+}
+
+// validateRow applies the constraints of the subscriptions table
+func validateRow(sub domain.Subscription) error {
+	if err := uuid.Validate(sub.UserID); err != nil {
+		return fmt.Errorf("%w: invalid user_id", domain.ErrValidation)
+	}
+	if !sub.BillingPeriod.Valid() || sub.BillingInterval <= 0 {
+		return fmt.Errorf("%w: invalid billing cycle", domain.ErrValidation)
+	}
+	return nil
+}
+
+// cloneSubscription copies the subscription so callers cannot modify the store
+func cloneSubscription(sub domain.Subscription) domain.Subscription {
+	if sub.EndDate != nil {
+		end := *sub.EndDate
+		sub.EndDate = &end
+	}
+	sub.Prices = slices.Clone(sub.Prices)
+	sub.Members = cloneMembers(sub.Members)
+	return sub
+}
+
+func cloneMembers(members []domain.Member) []domain.Member {
+	if members == nil {
+		return nil
+	}
+	res := make([]domain.Member, len(members))
+	for i, m := range members {
+		if m.Amount != nil {
+			amount := *m.Amount
+			m.Amount = &amount
+		}
+		res[i] = m
+	}
+	return res
+}
@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLAPIKeyStore stores API keys in the api_keys table. Its queries are
+// portable, so it serves both PostgreSQL and SQLite.
+type SQLAPIKeyStore struct {
+	db dbtx
+}
+
+func NewSQLAPIKeyStore(db *sqlx.DB) *SQLAPIKeyStore {
+	return &SQLAPIKeyStore{
+		db: db,
+	}
+}
+
+func (s *SQLAPIKeyStore) Create(ctx context.Context, key *domain.APIKey) error {
+	if key.ID == "" {
+		key.ID = uuid.NewString()
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+	key.TenantID = domain.TenantFromContext(ctx)
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO api_keys (id, tenant_id, user_id, name, key_hash, created_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+		key.ID, key.TenantID, key.UserID, key.Name, key.Hash, key.CreatedAt)
+	if err != nil {
+		return wrapError("failed to create API key", err)
+	}
+	return nil
+}
+
+func (s *SQLAPIKeyStore) GetByHash(ctx context.Context, hash string) (*domain.APIKey, error) {
+	key := &domain.APIKey{}
+	err := s.db.GetContext(ctx, key, `SELECT * FROM api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, hash)
+	if err != nil {
+		return nil, wrapError("failed to get API key", err)
+	}
+	return key, nil
+}
+
+func (s *SQLAPIKeyStore) ListByUser(ctx context.Context, userID string) ([]domain.APIKey, error) {
+	keys := []domain.APIKey{}
+	err := s.db.SelectContext(ctx, &keys, `SELECT * FROM api_keys WHERE tenant_id = $1 AND user_id = $2 ORDER BY created_at, id`,
+		domain.TenantFromContext(ctx), userID)
+	if err != nil {
+		return nil, wrapError("failed to list API keys", err)
+	}
+	return keys, nil
+}
+
+func (s *SQLAPIKeyStore) Revoke(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE api_keys SET revoked_at = $3 WHERE id = $1 AND tenant_id = $2 AND revoked_at IS NULL`,
+		id, domain.TenantFromContext(ctx), time.Now().UTC())
+	if err != nil {
+		return wrapError("failed to revoke API key", err)
+	}
+	return checkAffected("failed to revoke API key", res)
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLUserRepository stores users in the users table. Its queries are
+// portable, so it serves both PostgreSQL and SQLite. The schemas delete the
+// subscriptions and API keys of a user with it.
+type SQLUserRepository struct {
+	db dbtx
+}
+
+func NewSQLUserRepository(db *sqlx.DB) *SQLUserRepository {
+	return &SQLUserRepository{
+		db: db,
+	}
+}
+
+func (r *SQLUserRepository) Create(ctx context.Context, user *domain.User) error {
+	if user.ID == "" {
+		user.ID = uuid.NewString()
+	}
+	user.TenantID = domain.TenantFromContext(ctx)
+	user.CreatedAt = time.Now().UTC()
+	user.UpdatedAt = user.CreatedAt
+
+	_, err := r.db.ExecContext(ctx, `INSERT INTO users (tenant_id, id, display_name, email, currency, timezone, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+		user.TenantID, user.ID, user.DisplayName, user.Email, user.Currency, user.Timezone, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return wrapError("failed to create user", err)
+	}
+	return nil
+}
+
+func (r *SQLUserRepository) Get(ctx context.Context, id string) (*domain.User, error) {
+	user := &domain.User{}
+	err := r.db.GetContext(ctx, user, `SELECT * FROM users WHERE tenant_id = $1 AND id = $2`, domain.TenantFromContext(ctx), id)
+	if err != nil {
+		return nil, wrapError("failed to get user", err)
+	}
+	return user, nil
+}
+
+func (r *SQLUserRepository) Update(ctx context.Context, user *domain.User) error {
+	err := r.db.GetContext(ctx, user, `UPDATE users SET display_name = $3, email = $4, currency = $5, timezone = $6, updated_at = $7
+		WHERE tenant_id = $1 AND id = $2 RETURNING *`,
+		domain.TenantFromContext(ctx), user.ID, user.DisplayName, user.Email, user.Currency, user.Timezone, time.Now().UTC())
+	if err != nil {
+		return wrapError("failed to update user", err)
+	}
+	return nil
+}
+
+func (r *SQLUserRepository) Delete(ctx context.Context, id string) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM users WHERE tenant_id = $1 AND id = $2`, domain.TenantFromContext(ctx), id)
+	if err != nil {
+		return wrapError("failed to delete user", err)
+	}
+	return checkAffected("failed to delete user", res)
+}
+
+func (r *SQLUserRepository) List(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	users := []domain.User{}
+	err := r.db.SelectContext(ctx, &users, `SELECT * FROM users WHERE tenant_id = $1 ORDER BY created_at, id LIMIT $2 OFFSET $3`,
+		domain.TenantFromContext(ctx), limit, offset)
+	if err != nil {
+		return nil, wrapError("failed to list users", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,473 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/utils"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLUserSubscriptionRepository stores subscriptions in a PostgreSQL or a
+// SQLite database. The queries are shared, the few fragments that differ
+// come from the dialect of the database.
+type SQLUserSubscriptionRepository struct {
+	db      dbtx
+	dialect dialect
+}
+
+// dialect holds the fragments of SQL that differ between the databases
+type dialect struct {
+	// like matches case-insensitively, at least for ASCII letters
+	like string
+	// greatestDate is the format of the later of a date parameter and a date
+	// column
+	greatestDate string
+}
+
+var (
+	postgresDialect = dialect{like: "ILIKE", greatestDate: "GREATEST(%s::date, %s)"}
+	// LIKE is case-insensitive for ASCII letters in SQLite
+	sqliteDialect = dialect{like: "LIKE", greatestDate: "max(%s, %s)"}
+)
+
+// NewPostgresUserSubscriptionRepository returns a repository of a PostgreSQL
+// database migrated with migrations.
+func NewPostgresUserSubscriptionRepository(db *sqlx.DB) *SQLUserSubscriptionRepository {
+	return &SQLUserSubscriptionRepository{
+		db:      db,
+		dialect: postgresDialect,
+	}
+}
+
+// NewSQLiteUserSubscriptionRepository returns a repository of a SQLite
+// database migrated with migrations/sqlite.
+func NewSQLiteUserSubscriptionRepository(db *sqlx.DB) *SQLUserSubscriptionRepository {
+	return &SQLUserSubscriptionRepository{
+		db:      db,
+		dialect: sqliteDialect,
+	}
+}
+
+func (r *SQLUserSubscriptionRepository) Create(ctx context.Context, sub *domain.Subscription) error {
+	if sub.ID == "" {
+		sub.ID = uuid.NewString()
+	}
+	sub.TenantID = domain.TenantFromContext(ctx)
+
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return wrapError("failed to create subscription", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO subscriptions (id, tenant_id, user_id, service_name, start_date, end_date, price, currency, billing_period, billing_interval) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		sub.ID, sub.TenantID, sub.UserID, sub.ServiceName, sub.StartDate, sub.EndDate, sub.Price, sub.Currency, sub.BillingPeriod, sub.BillingInterval)
+	if utils.IsErrorCode(err, utils.ErrForeignKeyViolation) {
+		return fmt.Errorf("failed to create subscription: %w: %w", domain.ErrUnknownUser, err)
+	}
+	if err != nil {
+		return wrapError("failed to create subscription", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO subscription_prices (subscription_id, effective_from, price, currency) VALUES ($1, $2, $3, $4)`,
+		sub.ID, sub.StartDate, sub.Price, sub.Currency)
+	if err != nil {
+		return wrapError("failed to create subscription price", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError("failed to create subscription", err)
+	}
+	sub.Version = 1
+	return nil
+}
+
+// Get returns the latest subscription of the user to the service.
+func (r *SQLUserSubscriptionRepository) Get(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+	sub := &domain.Subscription{}
+	err := r.db.GetContext(ctx, sub, `SELECT * FROM subscriptions WHERE tenant_id = $1 AND user_id = $2 AND service_name = $3 ORDER BY start_date DESC, id LIMIT 1`,
+		domain.TenantFromContext(ctx), userID, serviceName)
+	if err != nil {
+		return nil, wrapError("failed to get subscription", err)
+	}
+
+	return sub, nil
+}
+
+func (r *SQLUserSubscriptionRepository) GetByID(ctx context.Context, id string) (*domain.Subscription, error) {
+	sub := &domain.Subscription{}
+	err := r.db.GetContext(ctx, sub, `SELECT * FROM subscriptions WHERE id = $1 AND tenant_id = $2`, id, domain.TenantFromContext(ctx))
+	if err != nil {
+		return nil, wrapError("failed to get subscription", err)
+	}
+
+	return sub, nil
+}
+
+// Update updates the subscription with sub.ID, or the latest subscription of
+// the user to the service if the ID is not set.
+func (r *SQLUserSubscriptionRepository) Update(ctx context.Context, sub *domain.Subscription) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return wrapError("failed to update subscription", err)
+	}
+	defer tx.Rollback()
+
+	if sub.ID == "" {
+		err = tx.GetContext(ctx, &sub.ID, `SELECT id FROM subscriptions WHERE tenant_id = $1 AND user_id = $2 AND service_name = $3 ORDER BY start_date DESC, id LIMIT 1`,
+			domain.TenantFromContext(ctx), sub.UserID, sub.ServiceName)
+		if err != nil {
+			return wrapError("failed to update subscription", err)
+		}
+	}
+
+	err = tx.GetContext(ctx, sub, `UPDATE subscriptions SET start_date = $1, end_date = $2, price = $3, currency = $4, billing_period = $5, billing_interval = $6, version = version + 1
+		WHERE id = $7 AND tenant_id = $8 AND ($9 = 0 OR version = $9) RETURNING *`,
+		sub.StartDate, sub.EndDate, sub.Price, sub.Currency, sub.BillingPeriod, sub.BillingInterval, sub.ID, domain.TenantFromContext(ctx), sub.Version)
+	if err != nil {
+		return versionError(ctx, tx, "failed to update subscription", sub.ID, err)
+	}
+
+	if err := r.recordPriceChange(ctx, tx, sub.ID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError("failed to update subscription", err)
+	}
+	return nil
+}
+
+// Patch updates the columns set in the patch of the subscription with the id.
+func (r *SQLUserSubscriptionRepository) Patch(ctx context.Context, id string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+	var set []string
+	var args []any
+	column := func(name string, value any) {
+		args = append(args, value)
+		set = append(set, fmt.Sprintf(`%s = $%d`, name, len(args)))
+	}
+	if patch.Price != nil {
+		column("price", *patch.Price)
+	}
+	if patch.Currency != nil {
+		column("currency", *patch.Currency)
+	}
+	if patch.StartDate != nil {
+		column("start_date", *patch.StartDate)
+	}
+	if patch.EndDate != nil {
+		column("end_date", *patch.EndDate)
+	}
+	if patch.ClearEndDate {
+		set = append(set, `end_date = NULL`)
+	}
+	if patch.BillingPeriod != nil {
+		column("billing_period", *patch.BillingPeriod)
+	}
+	if patch.BillingInterval != nil {
+		column("billing_interval", *patch.BillingInterval)
+	}
+	set = append(set, `version = version + 1`)
+
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return nil, wrapError("failed to patch subscription", err)
+	}
+	defer tx.Rollback()
+
+	args = append(args, id, domain.TenantFromContext(ctx), version)
+	sub := &domain.Subscription{}
+	err = tx.GetContext(ctx, sub, fmt.Sprintf(`UPDATE subscriptions SET %s WHERE id = $%d AND tenant_id = $%d AND ($%d = 0 OR version = $%d) RETURNING *`,
+		strings.Join(set, ", "), len(args)-2, len(args)-1, len(args), len(args)), args...)
+	if err != nil {
+		return nil, versionError(ctx, tx, "failed to patch subscription", id, err)
+	}
+
+	if patch.Price != nil || patch.Currency != nil {
+		if err := r.recordPriceChange(ctx, tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, wrapError("failed to patch subscription", err)
+	}
+	return sub, nil
+}
+
+// recordPriceChange records the current price of the subscription in its
+// history, if it differs from the price in effect.
+func (r *SQLUserSubscriptionRepository) recordPriceChange(ctx context.Context, tx dbtx, id string) error {
+	// The change is effective from the current month, or from the start of
+	// the subscription if it has not started yet.
+	effectiveFrom := fmt.Sprintf(r.dialect.greatestDate, "$2", "s.start_date")
+	_, err := tx.ExecContext(ctx, `INSERT INTO subscription_prices (subscription_id, effective_from, price, currency)
+		SELECT s.id, `+effectiveFrom+`, s.price, s.currency FROM subscriptions s
+		WHERE s.id = $1 AND NOT EXISTS (
+			SELECT 1 FROM subscription_prices p
+			WHERE p.subscription_id = s.id AND p.price = s.price AND p.currency = s.currency AND p.effective_from = (
+				SELECT max(effective_from) FROM subscription_prices
+				WHERE subscription_id = s.id AND effective_from <= `+effectiveFrom+`
+			)
+		)
+		ON CONFLICT (subscription_id, effective_from) DO UPDATE SET price = EXCLUDED.price, currency = EXCLUDED.currency`,
+		id, domain.CurrentMonth())
+	if err != nil {
+		return wrapError("failed to record subscription price", err)
+	}
+	return nil
+}
+
+// Delete deletes the latest subscription of the user to the service.
+func (r *SQLUserSubscriptionRepository) Delete(ctx context.Context, userID, serviceName string, version int) error {
+	var id string
+	err := r.db.GetContext(ctx, &id, `DELETE FROM subscriptions WHERE id = (
+		SELECT id FROM subscriptions WHERE tenant_id = $1 AND user_id = $2 AND service_name = $3 ORDER BY start_date DESC, id LIMIT 1
+	) AND ($4 = 0 OR version = $4) RETURNING id`, domain.TenantFromContext(ctx), userID, serviceName, version)
+	if err == nil {
+		return nil
+	}
+	if version != 0 && errors.Is(err, sql.ErrNoRows) {
+		if latest, err := r.Get(ctx, userID, serviceName); err == nil && latest.Version != version {
+			return fmt.Errorf("failed to delete subscription: %w", domain.ErrVersionMismatch)
+		}
+	}
+	return wrapError("failed to delete subscription", err)
+}
+
+func (r *SQLUserSubscriptionRepository) DeleteByID(ctx context.Context, id string, version int) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM subscriptions WHERE id = $1 AND tenant_id = $2 AND ($3 = 0 OR version = $3)`,
+		id, domain.TenantFromContext(ctx), version)
+	if err != nil {
+		return wrapError("failed to delete subscription", err)
+	}
+	if err := checkAffected("failed to delete subscription", res); err != nil {
+		return versionError(ctx, r.db, "failed to delete subscription", id, err)
+	}
+	return nil
+}
+
+func (r *SQLUserSubscriptionRepository) List(ctx context.Context, filter domain.ListFilter) ([]domain.Subscription, error) {
+	query, args, err := listQuery(ctx, filter, r.dialect.like)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+
+	subs := make([]domain.Subscription, 0, filter.Limit)
+	if err := r.db.SelectContext(ctx, &subs, query, args...); err != nil {
+		return nil, wrapError("failed to list subscriptions", err)
+	}
+
+	return subs, nil
+}
+
+func (r *SQLUserSubscriptionRepository) Count(ctx context.Context, filter domain.ListFilter) (int, error) {
+	where, args := listWhere(ctx, filter, r.dialect.like)
+
+	var count int
+	if err := r.db.GetContext(ctx, &count, `SELECT count(*) FROM subscriptions WHERE `+where, args...); err != nil {
+		return 0, wrapError("failed to count subscriptions", err)
+	}
+	return count, nil
+}
+
+// listQuery returns the query of the page of subscriptions selected by the
+// filter and its arguments.
+func listQuery(ctx context.Context, filter domain.ListFilter, like string) (string, []any, error) {
+	where, args := listWhere(ctx, filter, like)
+
+	column := string(filter.Sort.Field)
+	if !filter.Sort.Field.Valid() {
+		column = string(domain.SortByServiceName)
+	}
+	direction, compare := "ASC", ">"
+	if filter.Sort.Desc {
+		direction, compare = "DESC", "<"
+	}
+
+	if filter.After != nil {
+		value, err := filter.After.SortValue()
+		if err != nil {
+			return "", nil, domain.ErrValidation
+		}
+		args = append(args, value, filter.After.ID)
+		where += fmt.Sprintf(` AND (%s, id) %s ($%d, $%d)`, column, compare, len(args)-1, len(args))
+	}
+
+	query := fmt.Sprintf(`SELECT * FROM subscriptions WHERE %s ORDER BY %s %s, id %s`, where, column, direction, direction)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if filter.After == nil && filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+	return query, args, nil
+}
+
+// listWhere returns the WHERE clause of subscriptions of the tenant of the
+// context matching the filter and its arguments. Service name prefixes are
+// matched case-insensitively with the like operator of the database.
+func listWhere(ctx context.Context, filter domain.ListFilter, like string) (string, []any) {
+	where := []string{`tenant_id = $1`}
+	args := []any{domain.TenantFromContext(ctx)}
+	cond := func(format string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, v := range values {
+			args = append(args, v)
+			placeholders[i] = fmt.Sprintf(`$%d`, len(args))
+		}
+		where = append(where, fmt.Sprintf(format, placeholders...))
+	}
+
+	if filter.UserID != "" {
+		cond(`user_id = %s`, filter.UserID)
+	}
+	if !filter.ActiveAt.IsZero() {
+		cond(`start_date <= %[1]s AND (end_date IS NULL OR end_date >= %[1]s)`, filter.ActiveAt)
+	}
+	if filter.MinPrice != nil {
+		cond(`price >= %s`, *filter.MinPrice)
+	}
+	if filter.MaxPrice != nil {
+		cond(`price <= %s`, *filter.MaxPrice)
+	}
+	if filter.ServiceNamePrefix != "" {
+		cond(`service_name `+like+` %s ESCAPE '\'`, likePrefix(filter.ServiceNamePrefix))
+	}
+	switch filter.Status {
+	case domain.StatusActive:
+		cond(`start_date <= %[1]s AND (end_date IS NULL OR end_date >= %[1]s)`, domain.CurrentMonth())
+	case domain.StatusEnded:
+		cond(`end_date < %s`, domain.CurrentMonth())
+	case domain.StatusUpcoming:
+		cond(`start_date > %s`, domain.CurrentMonth())
+	}
+	return strings.Join(where, ` AND `), args
+}
+
+// likePrefix returns a LIKE pattern matching strings starting with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + `%`
+}
+
+func (r *SQLUserSubscriptionRepository) ListForPeriod(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+	from, to := filter.Period()
+
+	where := `s.tenant_id = $1 AND s.start_date <= $2`
+	args := []any{domain.TenantFromContext(ctx), to}
+	if !from.IsZero() {
+		args = append(args, from)
+		where += fmt.Sprintf(` AND (s.end_date IS NULL OR s.end_date >= $%d)`, len(args))
+	}
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		where += fmt.Sprintf(` AND (s.user_id = $%[1]d OR EXISTS (
+			SELECT 1 FROM subscription_members sm WHERE sm.subscription_id = s.id AND sm.user_id = $%[1]d
+		))`, len(args))
+	}
+	if len(filter.ServiceNames) > 0 {
+		placeholders := make([]string, len(filter.ServiceNames))
+		for i, name := range filter.ServiceNames {
+			args = append(args, name)
+			placeholders[i] = fmt.Sprintf(`$%d`, len(args))
+		}
+		where += fmt.Sprintf(` AND s.service_name IN (%s)`, strings.Join(placeholders, ", "))
+	}
+
+	var subs []domain.Subscription
+	if err := r.db.SelectContext(ctx, &subs, `SELECT s.* FROM subscriptions s WHERE `+where, args...); err != nil {
+		return nil, wrapError("failed to list subscriptions for period", err)
+	}
+
+	var prices []subscriptionPrice
+	err := r.db.SelectContext(ctx, &prices, `SELECT p.* FROM subscription_prices p JOIN subscriptions s ON s.id = p.subscription_id WHERE `+where+` ORDER BY p.effective_from`, args...)
+	if err != nil {
+		return nil, wrapError("failed to list subscription prices for period", err)
+	}
+
+	byID := make(map[string][]domain.PricePoint, len(subs))
+	for _, p := range prices {
+		byID[p.SubscriptionID] = append(byID[p.SubscriptionID], p.PricePoint)
+	}
+	for i := range subs {
+		subs[i].Prices = byID[subs[i].ID]
+	}
+	if err := loadMembers(ctx, r.db, subs, where, args...); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+func (r *SQLUserSubscriptionRepository) PriceHistory(ctx context.Context, subscriptionID string) ([]domain.PricePoint, error) {
+	prices := []domain.PricePoint{}
+	err := r.db.SelectContext(ctx, &prices, `SELECT p.effective_from, p.price, p.currency FROM subscription_prices p JOIN subscriptions s ON s.id = p.subscription_id
+		WHERE p.subscription_id = $1 AND s.tenant_id = $2 ORDER BY p.effective_from`,
+		subscriptionID, domain.TenantFromContext(ctx))
+	if err != nil {
+		return nil, wrapError("failed to get price history", err)
+	}
+
+	return prices, nil
+}
+
+func (r *SQLUserSubscriptionRepository) AddPrice(ctx context.Context, subscriptionID string, price domain.PricePoint) error {
+	tx, err := begin(ctx, r.db)
+	if err != nil {
+		return wrapError("failed to add subscription price", err)
+	}
+	defer tx.Rollback()
+
+	if err := checkTenant(ctx, tx, subscriptionID); err != nil {
+		return fmt.Errorf("failed to add subscription price: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO subscription_prices (subscription_id, effective_from, price, currency) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (subscription_id, effective_from) DO UPDATE SET price = EXCLUDED.price, currency = EXCLUDED.currency`,
+		subscriptionID, price.EffectiveFrom, price.Price, price.Currency)
+	if err != nil {
+		return wrapError("failed to add subscription price", err)
+	}
+
+	// Keep the current price of the subscription in sync with its history.
+	effectiveFrom := fmt.Sprintf(r.dialect.greatestDate, "$2", "subscriptions.start_date")
+	_, err = tx.ExecContext(ctx, `UPDATE subscriptions SET (price, currency, version) = (
+			SELECT p.price, p.currency, subscriptions.version + 1 FROM subscription_prices p
+			WHERE p.subscription_id = subscriptions.id AND p.effective_from <= `+effectiveFrom+`
+			ORDER BY p.effective_from DESC LIMIT 1
+		)
+		WHERE id = $1 AND EXISTS (
+			SELECT 1 FROM subscription_prices p
+			WHERE p.subscription_id = subscriptions.id AND p.effective_from <= `+effectiveFrom+`
+		)`, subscriptionID, domain.CurrentMonth())
+	if err != nil {
+		return wrapError("failed to update current subscription price", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return wrapError("failed to add subscription price", err)
+	}
+	return nil
+}
+
+func (r *SQLUserSubscriptionRepository) Members(ctx context.Context, subscriptionID string) ([]domain.Member, error) {
+	return listMembers(ctx, r.db, subscriptionID)
+}
+
+func (r *SQLUserSubscriptionRepository) SetMembers(ctx context.Context, subscriptionID string, members []domain.Member) error {
+	return setMembers(ctx, r.db, subscriptionID, members)
+}
+
+// subscriptionPrice is a row of the subscription_prices table
+type subscriptionPrice struct {
+	SubscriptionID string `db:"subscription_id"`
+	domain.PricePoint
+}
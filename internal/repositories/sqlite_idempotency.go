@@ -0,0 +1,99 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLiteIdempotencyStore stores idempotency records in SQLite. Expiry times
+// are compared as text, so they are always stored in UTC.
+type SQLiteIdempotencyStore struct {
+	db dbtx
+}
+
+func NewSQLiteIdempotencyStore(db *sqlx.DB) *SQLiteIdempotencyStore {
+	return &SQLiteIdempotencyStore{
+		db: db,
+	}
+}
+
+func (s *SQLiteIdempotencyStore) Get(ctx context.Context, key string) (*domain.IdempotencyRecord, error) {
+	var row idempotencyRow
+	err := s.db.GetContext(ctx, &row, `SELECT * FROM idempotency_keys WHERE key = $1 AND expires_at > $2`, key, time.Now().UTC())
+	if err != nil {
+		return nil, wrapError("failed to get idempotency key", err)
+	}
+
+	record := &domain.IdempotencyRecord{
+		Key:         row.Key,
+		RequestHash: row.RequestHash,
+		StatusCode:  row.StatusCode,
+		Body:        row.Body,
+		ExpiresAt:   row.ExpiresAt,
+	}
+	if err := json.Unmarshal(row.Header, &record.Header); err != nil {
+		return nil, fmt.Errorf("failed to decode idempotency key header: %w", err)
+	}
+	return record, nil
+}
+
+// Save stores the record, replacing an expired record of the same key.
+func (s *SQLiteIdempotencyStore) Save(ctx context.Context, record domain.IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency key header: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO idempotency_keys (key, request_hash, status_code, header, body, expires_at) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO UPDATE SET request_hash = excluded.request_hash, status_code = excluded.status_code,
+			header = excluded.header, body = excluded.body, expires_at = excluded.expires_at
+		WHERE idempotency_keys.expires_at <= $7`,
+		record.Key, record.RequestHash, record.StatusCode, string(header), record.Body, record.ExpiresAt.UTC(), time.Now().UTC())
+	if err != nil {
+		return wrapError("failed to save idempotency key", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return wrapError("failed to save idempotency key", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("failed to save idempotency key: %w", domain.ErrConflict)
+	}
+	return nil
+}
+
+func (s *SQLiteIdempotencyStore) Complete(ctx context.Context, record domain.IdempotencyRecord) error {
+	header, err := json.Marshal(record.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency key header: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, `UPDATE idempotency_keys SET status_code = $3, header = $4, body = $5, expires_at = $6
+		WHERE key = $1 AND request_hash = $2 AND status_code = 0`,
+		record.Key, record.RequestHash, record.StatusCode, string(header), record.Body, record.ExpiresAt.UTC())
+	if err != nil {
+		return wrapError("failed to complete idempotency key", err)
+	}
+	return checkAffected("failed to complete idempotency key", res)
+}
+
+func (s *SQLiteIdempotencyStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key = $1 AND status_code = 0`, key)
+	if err != nil {
+		return wrapError("failed to release idempotency key", err)
+	}
+	return nil
+}
+
+func (s *SQLiteIdempotencyStore) DeleteExpired(ctx context.Context, before time.Time) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= $1`, before.UTC())
+	if err != nil {
+		return wrapError("failed to delete expired idempotency keys", err)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/utils"
+	"github.com/jmoiron/sqlx"
+)
+
+// dbtx runs queries on a database or within a transaction, so repositories
+// can be bound to either.
+type dbtx interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+}
+
+// txn is a transaction started by a repository method, or the transaction
+// the repository is bound to. Only started transactions are committed or
+// rolled back, the bound one is finished by its unit of work.
+type txn struct {
+	dbtx
+	tx *sqlx.Tx
+}
+
+// begin starts a transaction on a database, or joins the transaction db is.
+func begin(ctx context.Context, db dbtx) (*txn, error) {
+	conn, ok := db.(*sqlx.DB)
+	if !ok {
+		return &txn{dbtx: db}, nil
+	}
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txn{dbtx: tx, tx: tx}, nil
+}
+
+func (t *txn) Commit() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if t.tx == nil {
+		return nil
+	}
+	return t.tx.Rollback()
+}
+
+const (
+	maxTxAttempts = 5
+	txRetryDelay  = 10 * time.Millisecond
+)
+
+// PostgresUnitOfWork runs functions in serializable transactions with the
+// Postgres repositories bound to them.
+type PostgresUnitOfWork struct {
+	db *sqlx.DB
+}
+
+func NewPostgresUnitOfWork(db *sqlx.DB) *PostgresUnitOfWork {
+	return &PostgresUnitOfWork{
+		db: db,
+	}
+}
+
+// Do runs fn in a transaction, retrying it on serialization failures and
+// deadlocks.
+func (u *PostgresUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, repos domain.Repositories) error) error {
+	delay := txRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := u.run(ctx, fn)
+		if err == nil || attempt == maxTxAttempts || !isRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (u *PostgresUnitOfWork) run(ctx context.Context, fn func(ctx context.Context, repos domain.Repositories) error) error {
+	tx, err := u.db.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return wrapError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	repos := domain.Repositories{
+		Subscriptions: &SQLUserSubscriptionRepository{db: tx, dialect: postgresDialect},
+		Users:         &SQLUserRepository{db: tx},
+		Idempotency:   &PostgresIdempotencyStore{db: tx},
+	}
+	if err := fn(ctx, repos); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapError("failed to commit transaction", err)
+	}
+	return nil
+}
+
+// isRetryable reports whether the transaction failed due to concurrent
+// transactions and can be retried.
+func isRetryable(err error) bool {
+	return utils.IsErrorCode(err, utils.ErrSerializationFailure) ||
+		utils.IsErrorCode(err, utils.ErrDeadlockDetected)
+}
+
+// SQLiteUnitOfWork runs functions in transactions with the SQLite
+// repositories bound to them. SQLite runs one write transaction at a time,
+// so they are serializable and need no retries.
+type SQLiteUnitOfWork struct {
+	db *sqlx.DB
+}
+
+func NewSQLiteUnitOfWork(db *sqlx.DB) *SQLiteUnitOfWork {
+	return &SQLiteUnitOfWork{
+		db: db,
+	}
+}
+
+func (u *SQLiteUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, repos domain.Repositories) error) error {
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return wrapError("failed to begin transaction", err)
+	}
+	defer tx.Rollback()
+
+	repos := domain.Repositories{
+		Subscriptions: &SQLUserSubscriptionRepository{db: tx, dialect: sqliteDialect},
+		Users:         &SQLUserRepository{db: tx},
+		Idempotency:   &SQLiteIdempotencyStore{db: tx},
+	}
+	if err := fn(ctx, repos); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return wrapError("failed to commit transaction", err)
+	}
+	return nil
+}
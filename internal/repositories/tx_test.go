@@ -0,0 +1,80 @@
+package repositories_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/db"
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/repositories"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestPostgresUnitOfWork_Retries drives the retries of the unit of work with
+// errors of the Postgres driver. The transactions themselves run on SQLite,
+// since the retries only depend on the errors fn returns.
+func TestPostgresUnitOfWork_Retries(t *testing.T) {
+	conn, err := db.CreateSQLiteConnection(filepath.Join(t.TempDir(), "subscriptions.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	uow := repositories.NewPostgresUnitOfWork(conn)
+
+	serializationFailure := &pq.Error{Code: "40001", Message: "could not serialize access due to concurrent update"}
+	deadlock := &pq.Error{Code: "40P01", Message: "deadlock detected"}
+	uniqueViolation := &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint"}
+
+	tests := []struct {
+		name     string
+		errs     []error // returned by the attempts in turn, nil afterwards
+		attempts int
+		// backoff is the least time the retries wait, doubling from 10ms
+		backoff time.Duration
+		wantErr error
+	}{
+		{"success", nil, 1, 0, nil},
+		{"retried until success", []error{serializationFailure, deadlock}, 3, 30 * time.Millisecond, nil},
+		{"wrapped", []error{fmt.Errorf("failed to update subscription: %w", serializationFailure)}, 2, 10 * time.Millisecond, nil},
+		{"attempt limit", []error{serializationFailure, serializationFailure, serializationFailure, serializationFailure, serializationFailure, serializationFailure}, 5, 150 * time.Millisecond, serializationFailure},
+		{"not retryable", []error{uniqueViolation}, 1, 0, uniqueViolation},
+		{"domain error", []error{domain.ErrVersionMismatch}, 1, 0, domain.ErrVersionMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			start := time.Now()
+			err := uow.Do(context.Background(), func(ctx context.Context, repos domain.Repositories) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			assert.Equal(t, tt.attempts, attempts)
+			assert.GreaterOrEqual(t, time.Since(start), tt.backoff)
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("canceled context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		attempts := 0
+		err := uow.Do(ctx, func(ctx context.Context, repos domain.Repositories) error {
+			attempts++
+			cancel()
+			return serializationFailure
+		})
+		assert.Equal(t, 1, attempts)
+		var pqErr *pq.Error
+		assert.True(t, errors.As(err, &pqErr))
+	})
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
+
+// Action is what a caller does with the subscriptions of a user.
+type Action string
+
+const (
+	ActionRead  Action = "read"
+	ActionWrite Action = "write"
+)
+
+// Authorize decides whether the caller may perform the action on the
+// subscriptions of the user, of all users if userID is empty. Owners manage
+// their own subscriptions, viewers read the account shared with them and
+// admins may do anything. Denials are domain.ErrForbidden.
+func Authorize(p domain.Principal, action Action, userID string) error {
+	own := userID != "" && userID == p.UserID
+	switch p.Role {
+	case domain.RoleAdmin:
+		return nil
+	case domain.RoleOwner:
+		if own {
+			return nil
+		}
+	case domain.RoleViewer:
+		if own && action == ActionRead {
+			return nil
+		}
+	}
+
+	target := "user " + userID
+	if userID == "" {
+		target = "all users"
+	}
+	return fmt.Errorf("%w: %s may not %s subscriptions of %s", domain.ErrForbidden, p.Role, action, target)
+}
+
+// authorize checks the caller of the context may perform the action on the
+// subscriptions of the user. Calls without a caller, from the CLI or with
+// authentication disabled, are trusted.
+func authorize(ctx context.Context, action Action, userID string) error {
+	p, ok := domain.PrincipalFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return Authorize(p, action, userID)
+}
+
+// authorizeByID checks the caller may perform the action on the subscription
+// with the id, loading it from repo to find its user
+func authorizeByID(ctx context.Context, repo domain.UserSubscriptionRepository, action Action, id string) error {
+	p, ok := domain.PrincipalFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	sub, err := repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return Authorize(p, action, sub.UserID)
+}
+
+// scope returns the user a query covers and checks the caller may read it.
+// Callers other than admins query their own subscriptions if no user is given.
+func scope(ctx context.Context, userID string) (string, error) {
+	p, ok := domain.PrincipalFromContext(ctx)
+	if !ok {
+		return userID, nil
+	}
+	if userID == "" && p.Role != domain.RoleAdmin {
+		userID = p.UserID
+	}
+	return userID, Authorize(p, ActionRead, userID)
+}
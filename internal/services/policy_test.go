@@ -0,0 +1,146 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	alice = "550e8400-e29b-41d4-a716-446655440000"
+	bob   = "7a2f4c1e-9b3d-4e6f-8a1b-2c3d4e5f6a7b"
+)
+
+func TestAuthorize(t *testing.T) {
+	owner := domain.Principal{UserID: alice, Role: domain.RoleOwner}
+	viewer := domain.Principal{UserID: alice, Role: domain.RoleViewer}
+	admin := domain.Principal{UserID: bob, Role: domain.RoleAdmin}
+
+	tests := []struct {
+		name    string
+		caller  domain.Principal
+		action  services.Action
+		userID  string
+		allowed bool
+	}{
+		{"owner reads own", owner, services.ActionRead, alice, true},
+		{"owner writes own", owner, services.ActionWrite, alice, true},
+		{"owner reads other", owner, services.ActionRead, bob, false},
+		{"owner writes other", owner, services.ActionWrite, bob, false},
+		{"owner reads all users", owner, services.ActionRead, "", false},
+		{"viewer reads shared", viewer, services.ActionRead, alice, true},
+		{"viewer writes shared", viewer, services.ActionWrite, alice, false},
+		{"viewer reads other", viewer, services.ActionRead, bob, false},
+		{"viewer reads all users", viewer, services.ActionRead, "", false},
+		{"admin reads other", admin, services.ActionRead, alice, true},
+		{"admin writes other", admin, services.ActionWrite, alice, true},
+		{"admin reads all users", admin, services.ActionRead, "", true},
+		{"no role", domain.Principal{UserID: alice}, services.ActionRead, alice, false},
+		{"no user", domain.Principal{Role: domain.RoleOwner}, services.ActionRead, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := services.Authorize(tt.caller, tt.action, tt.userID)
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, domain.ErrForbidden)
+			}
+		})
+	}
+}
+
+func TestUserSubscriptionService_Authorization(t *testing.T) {
+	asOwner := domain.WithPrincipal(context.Background(), domain.Principal{UserID: alice, Role: domain.RoleOwner})
+	asViewer := domain.WithPrincipal(context.Background(), domain.Principal{UserID: alice, Role: domain.RoleViewer})
+	asAdmin := domain.WithPrincipal(context.Background(), domain.Principal{UserID: bob, Role: domain.RoleAdmin})
+	bobs := domain.Subscription{ID: "sub-1", UserID: bob, ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}}
+
+	var queried []string
+	repo := mockRepo{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error { return nil },
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return &domain.Subscription{UserID: userID, ServiceName: serviceName}, nil
+		},
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Subscription, error) {
+			sub := bobs
+			return &sub, nil
+		},
+		UpdateFunc:     func(ctx context.Context, sub *domain.Subscription) error { return nil },
+		DeleteFunc:     func(ctx context.Context, userID, serviceName string, version int) error { return nil },
+		DeleteByIDFunc: func(ctx context.Context, id string, version int) error { return nil },
+		ListForPeriodFunc: func(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+			queried = append(queried, filter.UserID)
+			return nil, nil
+		},
+	}
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+
+	tests := []struct {
+		name    string
+		call    func() error
+		allowed bool
+	}{
+		{"owner creates own", func() error {
+			return svc.Create(asOwner, &domain.Subscription{UserID: alice, ServiceName: "Netflix"})
+		}, true},
+		{"owner creates for other", func() error {
+			return svc.Create(asOwner, &domain.Subscription{UserID: bob, ServiceName: "Netflix"})
+		}, false},
+		{"viewer creates", func() error {
+			return svc.Create(asViewer, &domain.Subscription{UserID: alice, ServiceName: "Netflix"})
+		}, false},
+		{"viewer gets shared", func() error {
+			_, err := svc.Get(asViewer, alice, "Netflix")
+			return err
+		}, true},
+		{"owner gets other by ID", func() error {
+			_, err := svc.GetByID(asOwner, bobs.ID)
+			return err
+		}, false},
+		{"owner updates other by ID", func() error {
+			return svc.Update(asOwner, &domain.Subscription{ID: bobs.ID, Price: 100})
+		}, false},
+		{"admin updates other by ID", func() error {
+			return svc.Update(asAdmin, &domain.Subscription{ID: bobs.ID, Price: 100})
+		}, true},
+		{"owner deletes other by ID", func() error {
+			return svc.DeleteByID(asOwner, bobs.ID, 0)
+		}, false},
+		{"viewer deletes shared", func() error {
+			return svc.Delete(asViewer, alice, "Netflix", 0)
+		}, false},
+		{"owner totals other", func() error {
+			_, err := svc.TotalPrice(asOwner, domain.CostFilter{UserID: bob})
+			return err
+		}, false},
+		{"admin totals all users", func() error {
+			_, err := svc.TotalPrice(asAdmin, domain.CostFilter{})
+			return err
+		}, true},
+		{"anonymous totals all users", func() error {
+			_, err := svc.TotalPrice(context.Background(), domain.CostFilter{})
+			return err
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if tt.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, domain.ErrForbidden)
+			}
+		})
+	}
+
+	// Callers other than admins are scoped to their own subscriptions.
+	queried = nil
+	_, err := svc.TotalPrice(asViewer, domain.CostFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{alice}, queried)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+)
+
+type userService struct {
+	repo domain.UserRepository
+	// currency is the default currency of new users
+	currency string
+}
+
+func NewUserService(repo domain.UserRepository, currency string) domain.UserService {
+	return &userService{
+		repo:     repo,
+		currency: currency,
+	}
+}
+
+func (s *userService) Create(ctx context.Context, user *domain.User) error {
+	if err := authorize(ctx, ActionWrite, user.ID); err != nil {
+		return err
+	}
+	s.setDefaults(user)
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	return s.repo.Create(ctx, user)
+}
+
+func (s *userService) Get(ctx context.Context, id string) (*domain.User, error) {
+	if err := authorize(ctx, ActionRead, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, id)
+}
+
+func (s *userService) Update(ctx context.Context, user *domain.User) error {
+	if err := authorize(ctx, ActionWrite, user.ID); err != nil {
+		return err
+	}
+	s.setDefaults(user)
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	return s.repo.Update(ctx, user)
+}
+
+// Delete deletes the user with its subscriptions and API keys.
+func (s *userService) Delete(ctx context.Context, id string) error {
+	if err := authorize(ctx, ActionWrite, id); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, id)
+}
+
+// List lists the users of the tenant, only admins may see them all.
+func (s *userService) List(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	if err := authorize(ctx, ActionRead, ""); err != nil {
+		return nil, err
+	}
+	return s.repo.List(ctx, limit, offset)
+}
+
+// setDefaults fills in the service currency and UTC when none are given
+func (s *userService) setDefaults(user *domain.User) {
+	if user.Currency == "" {
+		user.Currency = s.currency
+	}
+	if user.Timezone == "" {
+		user.Timezone = domain.DefaultTimezone
+	}
+}
@@ -1,41 +1,349 @@
 package services
 
 import (
-	"time"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
 
 	"github.com/alexputin/subscriptions/internal/domain"
 )
 
 type userSubscriptionService struct {
 	repo domain.UserSubscriptionRepository
+	// uow runs multi-step operations atomically, they run on repo if nil
+	uow   domain.UnitOfWork
+	rates domain.RateProvider
+	// currency is the default currency of new subscriptions and cost reports
+	currency string
 }
 
-func NewUserSubscriptionService(repo domain.UserSubscriptionRepository) domain.UserSubscriptionService {
+func NewUserSubscriptionService(repo domain.UserSubscriptionRepository, uow domain.UnitOfWork, rates domain.RateProvider, currency string) domain.UserSubscriptionService {
 	return &userSubscriptionService{
-		repo: repo,
+		repo:     repo,
+		uow:      uow,
+		rates:    rates,
+		currency: currency,
 	}
 }
 
-func (s *userSubscriptionService) Create(sub *domain.Subscription) error {
-	return s.repo.Create(sub)
+func (s *userSubscriptionService) Create(ctx context.Context, sub *domain.Subscription) error {
+	if err := authorize(ctx, ActionWrite, sub.UserID); err != nil {
+		return err
+	}
+	setBillingDefaults(sub)
+	return s.inUnitOfWork(ctx, func(ctx context.Context, repos domain.Repositories) error {
+		currency, err := s.userCurrency(ctx, repos.Users, sub.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to create subscription: %w", err)
+		}
+		if sub.Currency == "" {
+			sub.Currency = currency
+		}
+		return repos.Subscriptions.Create(ctx, sub)
+	})
 }
 
-func (s *userSubscriptionService) Get(userID, serviceName string) (*domain.Subscription, error) {
-	return s.repo.Get(userID, serviceName)
+func (s *userSubscriptionService) Get(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+	if err := authorize(ctx, ActionRead, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.Get(ctx, userID, serviceName)
 }
 
-func (s *userSubscriptionService) Update(sub *domain.Subscription) error {
-	return s.repo.Update(sub)
+func (s *userSubscriptionService) GetByID(ctx context.Context, id string) (*domain.Subscription, error) {
+	sub, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorize(ctx, ActionRead, sub.UserID); err != nil {
+		return nil, err
+	}
+	return sub, nil
 }
 
-func (s *userSubscriptionService) Delete(userID, serviceName string) error {
-	return s.repo.Delete(userID, serviceName)
+func (s *userSubscriptionService) Update(ctx context.Context, sub *domain.Subscription) error {
+	setBillingDefaults(sub)
+	if sub.ID == "" {
+		if err := authorize(ctx, ActionWrite, sub.UserID); err != nil {
+			return err
+		}
+		if sub.Currency != "" {
+			return s.repo.Update(ctx, sub)
+		}
+	}
+	return s.inTx(ctx, func(ctx context.Context, repo domain.UserSubscriptionRepository) error {
+		var current *domain.Subscription
+		var err error
+		if sub.ID == "" {
+			current, err = repo.Get(ctx, sub.UserID, sub.ServiceName)
+		} else {
+			current, err = repo.GetByID(ctx, sub.ID)
+			if err == nil {
+				err = authorize(ctx, ActionWrite, current.UserID)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		// a replacement without a currency keeps that of the subscription
+		if sub.Currency == "" {
+			sub.Currency = current.Currency
+		}
+		return repo.Update(ctx, sub)
+	})
 }
 
-func (s *userSubscriptionService) List(userID string, limit, offset int) ([]domain.Subscription, error) {
-	return s.repo.List(userID, limit, offset)
+func (s *userSubscriptionService) Patch(ctx context.Context, userID, serviceName string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+	if err := authorize(ctx, ActionWrite, userID); err != nil {
+		return nil, err
+	}
+	var result *domain.Subscription
+	err := s.inTx(ctx, func(ctx context.Context, repo domain.UserSubscriptionRepository) error {
+		sub, err := repo.Get(ctx, userID, serviceName)
+		if err != nil {
+			return err
+		}
+		if version != 0 && version != sub.Version {
+			return fmt.Errorf("failed to patch subscription: %w", domain.ErrVersionMismatch)
+		}
+		if patch.Empty() {
+			result = sub
+			return nil
+		}
+
+		patched := *sub
+		patch.Apply(&patched)
+		if err := patched.Validate(); err != nil {
+			return err
+		}
+		result, err = repo.Patch(ctx, sub.ID, version, patch)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-func (s *userSubscriptionService) TotalPrice(userID, serviceName string, from, to time.Time) (int, error) {
-	return s.repo.TotalPrice(userID, serviceName, from, to)
+func (s *userSubscriptionService) Delete(ctx context.Context, userID, serviceName string, version int) error {
+	if err := authorize(ctx, ActionWrite, userID); err != nil {
+		return err
+	}
+	return s.repo.Delete(ctx, userID, serviceName, version)
+}
+
+func (s *userSubscriptionService) DeleteByID(ctx context.Context, id string, version int) error {
+	return s.inTx(ctx, func(ctx context.Context, repo domain.UserSubscriptionRepository) error {
+		if err := authorizeByID(ctx, repo, ActionWrite, id); err != nil {
+			return err
+		}
+		return repo.DeleteByID(ctx, id, version)
+	})
+}
+
+func (s *userSubscriptionService) List(ctx context.Context, filter domain.ListFilter) (domain.SubscriptionPage, error) {
+	if filter.Limit <= 0 {
+		return domain.SubscriptionPage{}, fmt.Errorf("%w: limit must be positive", domain.ErrValidation)
+	}
+	if c := filter.After; c != nil && (c.Sort != filter.Sort.Field || c.Desc != filter.Sort.Desc) {
+		return domain.SubscriptionPage{}, fmt.Errorf("%w: cursor does not match the sort", domain.ErrValidation)
+	}
+	var err error
+	if filter.UserID, err = scope(ctx, filter.UserID); err != nil {
+		return domain.SubscriptionPage{}, err
+	}
+
+	// Fetch one more subscription to know whether there is a next page.
+	limit := filter.Limit
+	filter.Limit++
+	subs, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return domain.SubscriptionPage{}, err
+	}
+
+	page := domain.SubscriptionPage{Items: subs}
+	if len(subs) > limit {
+		page.Items = subs[:limit]
+		page.NextCursor = domain.NewCursor(filter.Sort, subs[limit-1]).Encode()
+	}
+	return page, nil
+}
+
+func (s *userSubscriptionService) Count(ctx context.Context, filter domain.ListFilter) (int, error) {
+	var err error
+	if filter.UserID, err = scope(ctx, filter.UserID); err != nil {
+		return 0, err
+	}
+	return s.repo.Count(ctx, filter)
+}
+
+func (s *userSubscriptionService) PriceHistory(ctx context.Context, userID, serviceName string) ([]domain.PricePoint, error) {
+	if err := authorize(ctx, ActionRead, userID); err != nil {
+		return nil, err
+	}
+	sub, err := s.repo.Get(ctx, userID, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.PriceHistory(ctx, sub.ID)
+}
+
+func (s *userSubscriptionService) AddPrice(ctx context.Context, userID, serviceName string, price *domain.PricePoint) error {
+	if err := authorize(ctx, ActionWrite, userID); err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(ctx context.Context, repo domain.UserSubscriptionRepository) error {
+		sub, err := repo.Get(ctx, userID, serviceName)
+		if err != nil {
+			return err
+		}
+		if price.Currency == "" {
+			price.Currency = sub.Currency
+		}
+		return repo.AddPrice(ctx, sub.ID, *price)
+	})
+}
+
+func (s *userSubscriptionService) Members(ctx context.Context, userID, serviceName string) ([]domain.Member, error) {
+	if err := authorize(ctx, ActionRead, userID); err != nil {
+		return nil, err
+	}
+	sub, err := s.repo.Get(ctx, userID, serviceName)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.Members(ctx, sub.ID)
+}
+
+// SetMembers replaces the members sharing the cost of the subscription, only
+// the paying user may change them.
+func (s *userSubscriptionService) SetMembers(ctx context.Context, userID, serviceName string, members []domain.Member) error {
+	if err := authorize(ctx, ActionWrite, userID); err != nil {
+		return err
+	}
+	if err := domain.ValidateMembers(members); err != nil {
+		return err
+	}
+	return s.inTx(ctx, func(ctx context.Context, repo domain.UserSubscriptionRepository) error {
+		sub, err := repo.Get(ctx, userID, serviceName)
+		if err != nil {
+			return err
+		}
+		return repo.SetMembers(ctx, sub.ID, members)
+	})
+}
+
+func (s *userSubscriptionService) TotalPrice(ctx context.Context, filter domain.CostFilter) (domain.Money, error) {
+	months, err := s.Breakdown(ctx, filter)
+	if err != nil {
+		return domain.Money{}, err
+	}
+
+	total := domain.Money{Currency: s.reportingCurrency(filter)}
+	for _, m := range months {
+		total.Amount += m.Total
+	}
+	return total, nil
+}
+
+func (s *userSubscriptionService) Breakdown(ctx context.Context, filter domain.CostFilter) ([]domain.MonthlyCost, error) {
+	var err error
+	if filter.UserID, err = scope(ctx, filter.UserID); err != nil {
+		return nil, err
+	}
+	subs, err := s.repo.ListForPeriod(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := filter.Period()
+	if from.IsZero() {
+		from = domain.EarliestStart(subs)
+		if from.IsZero() {
+			return []domain.MonthlyCost{}, nil
+		}
+	}
+	conv := domain.Converter{Rates: s.rates, Currency: s.reportingCurrency(filter)}
+	return domain.MonthlyBreakdown(subs, filter.UserID, from, to, filter.CostMode(), conv)
+}
+
+// Settlement works out who owes whom for the month filter.To, in the
+// subscriptions of filter.UserID. Callers other than admins only see the
+// transfers they are part of.
+func (s *userSubscriptionService) Settlement(ctx context.Context, filter domain.CostFilter) (domain.Settlement, error) {
+	var err error
+	if filter.UserID, err = scope(ctx, filter.UserID); err != nil {
+		return domain.Settlement{}, err
+	}
+	_, month := filter.Period()
+	filter.From = month
+	filter.To = month
+	subs, err := s.repo.ListForPeriod(ctx, filter)
+	if err != nil {
+		return domain.Settlement{}, err
+	}
+
+	conv := domain.Converter{Rates: s.rates, Currency: s.reportingCurrency(filter)}
+	settlement, err := domain.Settle(subs, month, filter.CostMode(), conv)
+	if err != nil {
+		return domain.Settlement{}, err
+	}
+	if filter.UserID != "" {
+		settlement.Transfers = slices.DeleteFunc(settlement.Transfers, func(t domain.Transfer) bool {
+			return t.From != filter.UserID && t.To != filter.UserID
+		})
+	}
+	return settlement, nil
+}
+
+func (s *userSubscriptionService) reportingCurrency(filter domain.CostFilter) string {
+	if filter.Currency != "" {
+		return filter.Currency
+	}
+	return s.currency
+}
+
+// userCurrency returns the default currency of the user, or
+// domain.ErrUnknownUser if it does not exist. Without users, the repository
+// of subscriptions checks the user and the currency is that of the service.
+func (s *userSubscriptionService) userCurrency(ctx context.Context, users domain.UserRepository, userID string) (string, error) {
+	if users == nil {
+		return s.currency, nil
+	}
+	user, err := users.Get(ctx, userID)
+	if errors.Is(err, domain.ErrNotFound) {
+		return "", domain.ErrUnknownUser
+	}
+	if err != nil {
+		return "", err
+	}
+	return user.Currency, nil
+}
+
+// inTx runs fn in the unit of work of the service, or on its repository if
+// there is none
+func (s *userSubscriptionService) inTx(ctx context.Context, fn func(ctx context.Context, repo domain.UserSubscriptionRepository) error) error {
+	return s.inUnitOfWork(ctx, func(ctx context.Context, repos domain.Repositories) error {
+		return fn(ctx, repos.Subscriptions)
+	})
+}
+
+// inUnitOfWork runs fn in the unit of work of the service, or on its
+// repository alone if there is none
+func (s *userSubscriptionService) inUnitOfWork(ctx context.Context, fn func(ctx context.Context, repos domain.Repositories) error) error {
+	if s.uow == nil {
+		return fn(ctx, domain.Repositories{Subscriptions: s.repo})
+	}
+	return s.uow.Do(ctx, fn)
+}
+
+// setBillingDefaults fills in a monthly billing cycle when none is given
+func setBillingDefaults(sub *domain.Subscription) {
+	if sub.BillingPeriod == "" {
+		sub.BillingPeriod = domain.BillingMonthly
+	}
+	if sub.BillingInterval == 0 {
+		sub.BillingInterval = 1
+	}
 }
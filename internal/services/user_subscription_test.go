@@ -1,53 +1,87 @@
 package services_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
 	"github.com/alexputin/subscriptions/internal/domain"
 	"github.com/alexputin/subscriptions/internal/services"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type mockRepo struct {
-	CreateFunc     func(sub *domain.Subscription) error
-	GetFunc        func(userID, serviceName string) (*domain.Subscription, error)
-	UpdateFunc     func(sub *domain.Subscription) error
-	DeleteFunc     func(userID, serviceName string) error
-	ListFunc       func(userID string, limit, offset int) ([]domain.Subscription, error)
-	TotalPriceFunc func(userID, serviceName string, from, to time.Time) (int, error)
+	CreateFunc        func(ctx context.Context, sub *domain.Subscription) error
+	GetFunc           func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error)
+	GetByIDFunc       func(ctx context.Context, id string) (*domain.Subscription, error)
+	UpdateFunc        func(ctx context.Context, sub *domain.Subscription) error
+	PatchFunc         func(ctx context.Context, id string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error)
+	DeleteFunc        func(ctx context.Context, userID, serviceName string, version int) error
+	DeleteByIDFunc    func(ctx context.Context, id string, version int) error
+	ListFunc          func(ctx context.Context, filter domain.ListFilter) ([]domain.Subscription, error)
+	CountFunc         func(ctx context.Context, filter domain.ListFilter) (int, error)
+	ListForPeriodFunc func(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error)
+	PriceHistoryFunc  func(ctx context.Context, subscriptionID string) ([]domain.PricePoint, error)
+	AddPriceFunc      func(ctx context.Context, subscriptionID string, price domain.PricePoint) error
+	MembersFunc       func(ctx context.Context, subscriptionID string) ([]domain.Member, error)
+	SetMembersFunc    func(ctx context.Context, subscriptionID string, members []domain.Member) error
 }
 
-func (m *mockRepo) Create(sub *domain.Subscription) error {
-	return m.CreateFunc(sub)
+func (m *mockRepo) Create(ctx context.Context, sub *domain.Subscription) error {
+	return m.CreateFunc(ctx, sub)
 }
-func (m *mockRepo) Get(userID, serviceName string) (*domain.Subscription, error) {
-	return m.GetFunc(userID, serviceName)
+func (m *mockRepo) Get(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+	return m.GetFunc(ctx, userID, serviceName)
 }
-func (m *mockRepo) Update(sub *domain.Subscription) error {
-	return m.UpdateFunc(sub)
+func (m *mockRepo) GetByID(ctx context.Context, id string) (*domain.Subscription, error) {
+	return m.GetByIDFunc(ctx, id)
 }
-func (m *mockRepo) Delete(userID, serviceName string) error {
-	return m.DeleteFunc(userID, serviceName)
+func (m *mockRepo) Update(ctx context.Context, sub *domain.Subscription) error {
+	return m.UpdateFunc(ctx, sub)
 }
-func (m *mockRepo) List(userID string, limit, offset int) ([]domain.Subscription, error) {
-	return m.ListFunc(userID, limit, offset)
+func (m *mockRepo) Patch(ctx context.Context, id string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+	return m.PatchFunc(ctx, id, version, patch)
 }
-func (m *mockRepo) TotalPrice(userID, serviceName string, from, to time.Time) (int, error) {
-	return m.TotalPriceFunc(userID, serviceName, from, to)
+func (m *mockRepo) Delete(ctx context.Context, userID, serviceName string, version int) error {
+	return m.DeleteFunc(ctx, userID, serviceName, version)
+}
+func (m *mockRepo) DeleteByID(ctx context.Context, id string, version int) error {
+	return m.DeleteByIDFunc(ctx, id, version)
+}
+func (m *mockRepo) List(ctx context.Context, filter domain.ListFilter) ([]domain.Subscription, error) {
+	return m.ListFunc(ctx, filter)
+}
+func (m *mockRepo) Count(ctx context.Context, filter domain.ListFilter) (int, error) {
+	return m.CountFunc(ctx, filter)
+}
+func (m *mockRepo) ListForPeriod(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+	return m.ListForPeriodFunc(ctx, filter)
+}
+func (m *mockRepo) PriceHistory(ctx context.Context, subscriptionID string) ([]domain.PricePoint, error) {
+	return m.PriceHistoryFunc(ctx, subscriptionID)
+}
+func (m *mockRepo) AddPrice(ctx context.Context, subscriptionID string, price domain.PricePoint) error {
+	return m.AddPriceFunc(ctx, subscriptionID, price)
+}
+func (m *mockRepo) Members(ctx context.Context, subscriptionID string) ([]domain.Member, error) {
+	return m.MembersFunc(ctx, subscriptionID)
+}
+func (m *mockRepo) SetMembers(ctx context.Context, subscriptionID string, members []domain.Member) error {
+	return m.SetMembersFunc(ctx, subscriptionID, members)
 }
 
 func TestUserSubscriptionService_Create_Ok(t *testing.T) {
 	called := false
 	repo := mockRepo{
-		CreateFunc: func(sub *domain.Subscription) error {
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
 			called = true
 			return nil
 		},
 	}
-	svc := services.NewUserSubscriptionService(&repo)
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
 	sub := domain.Subscription{UserID: "user1", ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Now()}}
-	err := svc.Create(&sub)
+	err := svc.Create(context.Background(), &sub)
 	assert.NoError(t, err)
 	assert.True(t, called)
 }
@@ -55,26 +89,52 @@ func TestUserSubscriptionService_Create_Ok(t *testing.T) {
 func TestUserSubscriptionService_Update_Ok(t *testing.T) {
 	called := false
 	repo := mockRepo{
-		UpdateFunc: func(sub *domain.Subscription) error {
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
 			called = true
 			return nil
 		},
 	}
-	svc := services.NewUserSubscriptionService(&repo)
-	sub := domain.Subscription{UserID: "user1", ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Now()}}
-	err := svc.Update(&sub)
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	sub := domain.Subscription{UserID: "user1", ServiceName: "Netflix", Price: 500, Currency: "RUB", StartDate: domain.ShortDate{Time: time.Now()}}
+	err := svc.Update(context.Background(), &sub)
 	assert.NoError(t, err)
 	assert.True(t, called)
 }
 
+func TestUserSubscriptionService_Update_KeepsCurrency(t *testing.T) {
+	var updated []domain.Subscription
+	repo := mockRepo{
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return &domain.Subscription{ID: "sub-1", UserID: userID, ServiceName: serviceName, Currency: "USD"}, nil
+		},
+		GetByIDFunc: func(ctx context.Context, id string) (*domain.Subscription, error) {
+			return &domain.Subscription{ID: id, UserID: "user1", ServiceName: "Netflix", Currency: "EUR"}, nil
+		},
+		UpdateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			updated = append(updated, *sub)
+			return nil
+		},
+	}
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	start := domain.ShortDate{Time: time.Now()}
+
+	require.NoError(t, svc.Update(context.Background(), &domain.Subscription{UserID: "user1", ServiceName: "Netflix", Price: 500, StartDate: start}))
+	require.NoError(t, svc.Update(context.Background(), &domain.Subscription{ID: "sub-2", Price: 500, StartDate: start}))
+	require.NoError(t, svc.Update(context.Background(), &domain.Subscription{UserID: "user1", ServiceName: "Netflix", Price: 500, Currency: "GBP", StartDate: start}))
+	require.Len(t, updated, 3)
+	assert.Equal(t, "USD", updated[0].Currency)
+	assert.Equal(t, "EUR", updated[1].Currency)
+	assert.Equal(t, "GBP", updated[2].Currency)
+}
+
 func TestUserSubscriptionService_Get(t *testing.T) {
 	repo := mockRepo{
-		GetFunc: func(userID, serviceName string) (*domain.Subscription, error) {
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
 			return &domain.Subscription{UserID: userID, ServiceName: serviceName, Price: 100}, nil
 		},
 	}
-	svc := services.NewUserSubscriptionService(&repo)
-	sub, err := svc.Get("user1", "Netflix")
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	sub, err := svc.Get(context.Background(), "user1", "Netflix")
 	assert.NoError(t, err)
 	assert.Equal(t, "user1", sub.UserID)
 	assert.Equal(t, "Netflix", sub.ServiceName)
@@ -83,38 +143,257 @@ func TestUserSubscriptionService_Get(t *testing.T) {
 func TestUserSubscriptionService_Delete(t *testing.T) {
 	called := false
 	repo := mockRepo{
-		DeleteFunc: func(userID, serviceName string) error {
+		DeleteFunc: func(ctx context.Context, userID, serviceName string, version int) error {
 			called = true
 			return nil
 		},
 	}
-	svc := services.NewUserSubscriptionService(&repo)
-	err := svc.Delete("user1", "Netflix")
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	err := svc.Delete(context.Background(), "user1", "Netflix", 0)
 	assert.NoError(t, err)
 	assert.True(t, called)
 }
 
 func TestUserSubscriptionService_List(t *testing.T) {
 	repo := mockRepo{
-		ListFunc: func(userID string, limit, offset int) ([]domain.Subscription, error) {
-			return []domain.Subscription{{UserID: userID, ServiceName: "Netflix", Price: 100}}, nil
+		ListFunc: func(ctx context.Context, filter domain.ListFilter) ([]domain.Subscription, error) {
+			return []domain.Subscription{{UserID: filter.UserID, ServiceName: "Netflix", Price: 100}}, nil
+		},
+	}
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	page, err := svc.List(context.Background(), domain.ListFilter{UserID: "user1", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 1)
+	assert.Equal(t, "user1", page.Items[0].UserID)
+	assert.Empty(t, page.NextCursor)
+}
+
+func TestUserSubscriptionService_List_NextCursor(t *testing.T) {
+	repo := mockRepo{
+		ListFunc: func(ctx context.Context, filter domain.ListFilter) ([]domain.Subscription, error) {
+			assert.Equal(t, 3, filter.Limit)
+			return []domain.Subscription{
+				{ID: "a", ServiceName: "Netflix", Price: 100},
+				{ID: "b", ServiceName: "Spotify", Price: 200},
+				{ID: "c", ServiceName: "YouTube", Price: 300},
+			}, nil
 		},
 	}
-	svc := services.NewUserSubscriptionService(&repo)
-	list, err := svc.List("user1", 10, 0)
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	sort := domain.ListSort{Field: domain.SortByPrice, Desc: true}
+	page, err := svc.List(context.Background(), domain.ListFilter{Sort: sort, Limit: 2})
+	assert.NoError(t, err)
+	assert.Len(t, page.Items, 2)
+
+	cursor, err := domain.DecodeCursor(page.NextCursor)
 	assert.NoError(t, err)
-	assert.Len(t, list, 1)
-	assert.Equal(t, "user1", list[0].UserID)
+	assert.Equal(t, domain.Cursor{Sort: domain.SortByPrice, Desc: true, Value: "200", ID: "b"}, cursor)
+
+	_, err = svc.List(context.Background(), domain.ListFilter{After: &cursor, Limit: 2})
+	assert.ErrorIs(t, err, domain.ErrValidation)
 }
 
 func TestUserSubscriptionService_TotalPrice(t *testing.T) {
 	repo := mockRepo{
-		TotalPriceFunc: func(userID, serviceName string, from, to time.Time) (int, error) {
-			return 1234, nil
+		ListForPeriodFunc: func(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+			return []domain.Subscription{
+				{UserID: "user1", ServiceName: "Netflix", Price: 500, Currency: "RUB", StartDate: domain.ShortDate{Time: time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)}},
+			}, nil
+		},
+	}
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	total, err := svc.TotalPrice(context.Background(), domain.CostFilter{
+		UserID:       "user1",
+		ServiceNames: []string{"Netflix"},
+		From:         time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		To:           time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, domain.Money{Amount: 1500, Currency: "RUB"}, total)
+}
+
+type fixedRates map[string]float64
+
+func (r fixedRates) Rate(from, to string, at time.Time) (float64, error) {
+	rate, ok := r[from+to]
+	if !ok {
+		return 0, domain.ErrRateNotFound
+	}
+	return rate, nil
+}
+
+func TestUserSubscriptionService_TotalPrice_Currency(t *testing.T) {
+	repo := mockRepo{
+		ListForPeriodFunc: func(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+			return []domain.Subscription{
+				{UserID: "user1", ServiceName: "Netflix", Price: 1000, Currency: "USD", StartDate: domain.ShortDate{Time: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+				{UserID: "user1", ServiceName: "Yandex", Price: 29900, Currency: "RUB", StartDate: domain.ShortDate{Time: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}},
+			}, nil
+		},
+	}
+	svc := services.NewUserSubscriptionService(&repo, nil, fixedRates{"USDRUB": 90}, "RUB")
+	filter := domain.CostFilter{
+		UserID: "user1",
+		From:   time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		To:     time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	total, err := svc.TotalPrice(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.Money{Amount: 2 * (90000 + 29900), Currency: "RUB"}, total)
+
+	filter.Currency = "USD"
+	_, err = svc.TotalPrice(context.Background(), filter)
+	assert.ErrorIs(t, err, domain.ErrRateNotFound)
+}
+
+func TestUserSubscriptionService_Breakdown(t *testing.T) {
+	repo := mockRepo{
+		ListForPeriodFunc: func(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+			return []domain.Subscription{
+				{UserID: "user1", ServiceName: "Netflix", Price: 500, StartDate: domain.ShortDate{Time: time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)}},
+				{UserID: "user1", ServiceName: "Spotify", Price: 300, StartDate: domain.ShortDate{Time: time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC)}},
+			}, nil
 		},
 	}
-	svc := services.NewUserSubscriptionService(&repo)
-	total, err := svc.TotalPrice("user1", "Netflix", time.Now(), time.Now())
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	months, err := svc.Breakdown(context.Background(), domain.CostFilter{UserID: "user1", To: time.Date(2025, time.February, 1, 0, 0, 0, 0, time.UTC)})
 	assert.NoError(t, err)
-	assert.Equal(t, 1234, total)
+	if assert.Len(t, months, 3) {
+		assert.Equal(t, time.Date(2024, time.December, 1, 0, 0, 0, 0, time.UTC), months[0].Month.Time)
+		assert.Equal(t, 300, months[0].Total)
+		assert.Equal(t, 800, months[2].Total)
+		assert.Equal(t, []domain.ServiceCost{{ServiceName: "Netflix", Total: 500}, {ServiceName: "Spotify", Total: 300}}, months[2].Services)
+	}
+}
+
+func TestUserSubscriptionService_AddPrice_DefaultsToSubscriptionCurrency(t *testing.T) {
+	var got domain.PricePoint
+	var gotID string
+	repo := mockRepo{
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return &domain.Subscription{ID: "sub1", UserID: userID, ServiceName: serviceName, Price: 999, Currency: "USD"}, nil
+		},
+		AddPriceFunc: func(ctx context.Context, subscriptionID string, price domain.PricePoint) error {
+			gotID = subscriptionID
+			got = price
+			return nil
+		},
+	}
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	err := svc.AddPrice(context.Background(), "user1", "Netflix", &domain.PricePoint{Price: 1299, EffectiveFrom: domain.ShortDate{Time: time.Now()}})
+	assert.NoError(t, err)
+	assert.Equal(t, "sub1", gotID)
+	assert.Equal(t, "USD", got.Currency)
+	assert.Equal(t, 1299, got.Price)
+}
+
+func TestUserSubscriptionService_Patch(t *testing.T) {
+	end := domain.ShortDate{Time: time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)}
+	repo := mockRepo{
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return &domain.Subscription{
+				ID:        "sub-1",
+				UserID:    userID,
+				StartDate: domain.ShortDate{Time: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+			}, nil
+		},
+		PatchFunc: func(ctx context.Context, id string, version int, patch domain.SubscriptionPatch) (*domain.Subscription, error) {
+			assert.Equal(t, "sub-1", id)
+			return &domain.Subscription{ID: id}, nil
+		},
+	}
+	service := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+
+	_, err := service.Patch(context.Background(), "u1", "Netflix", 0, domain.SubscriptionPatch{EndDate: &end})
+	assert.ErrorIs(t, err, domain.ErrValidation)
+
+	end.Time = time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	sub, err := service.Patch(context.Background(), "u1", "Netflix", 0, domain.SubscriptionPatch{EndDate: &end})
+	assert.NoError(t, err)
+	assert.Equal(t, "sub-1", sub.ID)
+}
+
+func TestUserSubscriptionService_Patch_VersionMismatch(t *testing.T) {
+	end := domain.ShortDate{Time: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)}
+	repo := mockRepo{
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return &domain.Subscription{ID: "sub-1", Version: 2}, nil
+		},
+	}
+	service := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+
+	_, err := service.Patch(context.Background(), "u1", "Netflix", 1, domain.SubscriptionPatch{EndDate: &end})
+	assert.ErrorIs(t, err, domain.ErrVersionMismatch)
+}
+
+// mockUnitOfWork runs functions on the repositories it holds
+type mockUnitOfWork struct {
+	repos domain.Repositories
+	runs  int
+}
+
+func (u *mockUnitOfWork) Do(ctx context.Context, fn func(ctx context.Context, repos domain.Repositories) error) error {
+	u.runs++
+	return fn(ctx, u.repos)
+}
+
+func TestUserSubscriptionService_AddPrice_InUnitOfWork(t *testing.T) {
+	var added domain.PricePoint
+	txRepo := mockRepo{
+		GetFunc: func(ctx context.Context, userID, serviceName string) (*domain.Subscription, error) {
+			return &domain.Subscription{ID: "sub-1", Currency: "USD"}, nil
+		},
+		AddPriceFunc: func(ctx context.Context, subscriptionID string, price domain.PricePoint) error {
+			added = price
+			return nil
+		},
+	}
+	uow := &mockUnitOfWork{repos: domain.Repositories{Subscriptions: &txRepo}}
+	svc := services.NewUserSubscriptionService(&mockRepo{}, uow, nil, "RUB")
+
+	err := svc.AddPrice(context.Background(), "u1", "Netflix", &domain.PricePoint{Price: 999})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, uow.runs)
+	assert.Equal(t, "USD", added.Currency)
+}
+
+func TestUserSubscriptionService_Settlement(t *testing.T) {
+	var got domain.CostFilter
+	weight := func(userID string) domain.Member { return domain.Member{UserID: userID, Weight: 1} }
+	repo := mockRepo{
+		ListForPeriodFunc: func(ctx context.Context, filter domain.CostFilter) ([]domain.Subscription, error) {
+			got = filter
+			start := domain.ShortDate{Time: time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)}
+			return []domain.Subscription{
+				{UserID: alice, ServiceName: "Spotify", Price: 900, StartDate: start, Members: []domain.Member{weight(alice), weight(bob), weight("carol")}},
+				{UserID: "carol", ServiceName: "Netflix", Price: 800, StartDate: start, Members: []domain.Member{weight("carol"), weight("dave")}},
+			}, nil
+		},
+	}
+	svc := services.NewUserSubscriptionService(&repo, nil, nil, "RUB")
+	march := time.Date(2025, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	settlement, err := svc.Settlement(context.Background(), domain.CostFilter{To: march})
+	require.NoError(t, err)
+	assert.Equal(t, march, got.From)
+	assert.Equal(t, "RUB", settlement.Currency)
+	assert.Equal(t, []domain.Transfer{
+		{From: bob, To: alice, Amount: 300},
+		{From: "carol", To: alice, Amount: 300},
+		{From: "dave", To: "carol", Amount: 400},
+	}, settlement.Transfers)
+
+	asBob := domain.WithPrincipal(context.Background(), domain.Principal{UserID: bob, Role: domain.RoleOwner})
+	settlement, err = svc.Settlement(asBob, domain.CostFilter{To: march})
+	require.NoError(t, err)
+	assert.Equal(t, bob, got.UserID)
+	assert.Equal(t, []domain.Transfer{{From: bob, To: alice, Amount: 300}}, settlement.Transfers)
+}
+
+func TestUserSubscriptionService_SetMembers_Validation(t *testing.T) {
+	svc := services.NewUserSubscriptionService(&mockRepo{}, nil, nil, "RUB")
+
+	err := svc.SetMembers(context.Background(), alice, "Spotify", []domain.Member{{UserID: bob}})
+	assert.ErrorIs(t, err, domain.ErrValidation)
 }
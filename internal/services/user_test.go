@@ -0,0 +1,111 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alexputin/subscriptions/internal/domain"
+	"github.com/alexputin/subscriptions/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockUserRepo keeps users by ID
+type mockUserRepo map[string]domain.User
+
+func (m mockUserRepo) Create(ctx context.Context, user *domain.User) error {
+	m[user.ID] = *user
+	return nil
+}
+func (m mockUserRepo) Get(ctx context.Context, id string) (*domain.User, error) {
+	user, ok := m[id]
+	if !ok {
+		return nil, domain.ErrNotFound
+	}
+	return &user, nil
+}
+func (m mockUserRepo) Update(ctx context.Context, user *domain.User) error {
+	m[user.ID] = *user
+	return nil
+}
+func (m mockUserRepo) Delete(ctx context.Context, id string) error {
+	delete(m, id)
+	return nil
+}
+func (m mockUserRepo) List(ctx context.Context, limit, offset int) ([]domain.User, error) {
+	users := []domain.User{}
+	for _, user := range m {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func TestUserService_Create_Defaults(t *testing.T) {
+	repo := mockUserRepo{}
+	svc := services.NewUserService(repo, "RUB")
+
+	user := &domain.User{ID: alice, DisplayName: "Alice"}
+	require.NoError(t, svc.Create(context.Background(), user))
+	assert.Equal(t, "RUB", repo[alice].Currency)
+	assert.Equal(t, domain.DefaultTimezone, repo[alice].Timezone)
+
+	err := svc.Create(context.Background(), &domain.User{ID: bob, Timezone: "Mars/Olympus"})
+	assert.ErrorIs(t, err, domain.ErrValidation)
+	assert.NotContains(t, repo, bob)
+}
+
+func TestUserService_Authorization(t *testing.T) {
+	asOwner := domain.WithPrincipal(context.Background(), domain.Principal{UserID: alice, Role: domain.RoleOwner})
+	asViewer := domain.WithPrincipal(context.Background(), domain.Principal{UserID: alice, Role: domain.RoleViewer})
+	asAdmin := domain.WithPrincipal(context.Background(), domain.Principal{UserID: bob, Role: domain.RoleAdmin})
+	svc := services.NewUserService(mockUserRepo{alice: {ID: alice}, bob: {ID: bob}}, "RUB")
+
+	assert.NoError(t, svc.Create(asOwner, &domain.User{ID: alice}))
+	assert.ErrorIs(t, svc.Create(asOwner, &domain.User{ID: bob}), domain.ErrForbidden)
+	_, err := svc.Get(asViewer, alice)
+	assert.NoError(t, err)
+	_, err = svc.Get(asOwner, bob)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	assert.ErrorIs(t, svc.Update(asViewer, &domain.User{ID: alice}), domain.ErrForbidden)
+	assert.ErrorIs(t, svc.Delete(asOwner, bob), domain.ErrForbidden)
+	_, err = svc.List(asOwner, 10, 0)
+	assert.ErrorIs(t, err, domain.ErrForbidden)
+	users, err := svc.List(asAdmin, 10, 0)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.NoError(t, svc.Delete(asAdmin, alice))
+}
+
+func TestUserSubscriptionService_Create_UserCurrency(t *testing.T) {
+	var created []domain.Subscription
+	txRepo := mockRepo{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			created = append(created, *sub)
+			return nil
+		},
+	}
+	users := mockUserRepo{alice: {ID: alice, Currency: "USD"}}
+	uow := &mockUnitOfWork{repos: domain.Repositories{Subscriptions: &txRepo, Users: users}}
+	svc := services.NewUserSubscriptionService(&mockRepo{}, uow, nil, "RUB")
+
+	require.NoError(t, svc.Create(context.Background(), &domain.Subscription{UserID: alice, ServiceName: "Netflix"}))
+	require.NoError(t, svc.Create(context.Background(), &domain.Subscription{UserID: alice, ServiceName: "Spotify", Currency: "EUR"}))
+	require.Len(t, created, 2)
+	assert.Equal(t, "USD", created[0].Currency)
+	assert.Equal(t, "EUR", created[1].Currency)
+}
+
+func TestUserSubscriptionService_Create_UnknownUser(t *testing.T) {
+	txRepo := mockRepo{
+		CreateFunc: func(ctx context.Context, sub *domain.Subscription) error {
+			t.Fatal("subscription of an unknown user created")
+			return nil
+		},
+	}
+	uow := &mockUnitOfWork{repos: domain.Repositories{Subscriptions: &txRepo, Users: mockUserRepo{}}}
+	svc := services.NewUserSubscriptionService(&mockRepo{}, uow, nil, "RUB")
+
+	err := svc.Create(context.Background(), &domain.Subscription{UserID: bob, ServiceName: "Netflix", Currency: "RUB"})
+	assert.ErrorIs(t, err, domain.ErrUnknownUser)
+	assert.ErrorIs(t, err, domain.ErrValidation)
+}
@@ -4,17 +4,43 @@ import (
 	"errors"
 
 	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
 )
 
 const (
-	ErrUniqueViolation = "unique_violation"
+	ErrUniqueViolation           = "unique_violation"
+	ErrForeignKeyViolation       = "foreign_key_violation"
+	ErrCheckViolation            = "check_violation"
+	ErrInvalidTextRepresentation = "invalid_text_representation"
+	ErrQueryCanceled             = "query_canceled"
+	ErrSerializationFailure      = "serialization_failure"
+	ErrDeadlockDetected          = "deadlock_detected"
 )
 
+// sqliteErrorCodes maps SQLite extended result codes to the PostgreSQL
+// condition names above
+var sqliteErrorCodes = map[int]string{
+	sqlite3.SQLITE_CONSTRAINT_UNIQUE:     ErrUniqueViolation,
+	sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY: ErrUniqueViolation,
+	sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY: ErrForeignKeyViolation,
+	// Triggers of the schema only abort on missing referenced rows.
+	sqlite3.SQLITE_CONSTRAINT_TRIGGER: ErrForeignKeyViolation,
+	sqlite3.SQLITE_CONSTRAINT_CHECK:   ErrCheckViolation,
+	sqlite3.SQLITE_INTERRUPT:          ErrQueryCanceled,
+}
+
+// IsErrorCode reports whether err is a database error with the PostgreSQL
+// condition name errcode. SQLite errors are matched by their equivalent
+// condition, so callers handle both drivers the same way.
 func IsErrorCode(err error, errcode string) bool {
 	var pgErr *pq.Error
 	if errors.As(err, &pgErr) {
-		println(pgErr.Code)
 		return pgErr.Code.Name() == errcode
 	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErrorCodes[sqliteErr.Code()] == errcode
+	}
 	return false
 }
@@ -1,21 +1,53 @@
 package utils
 
 import (
+	"encoding/json"
+	"net/http"
+
 	"github.com/labstack/echo/v4"
 )
 
-type ErrorResponse struct {
-	Message string `json:"error"`
+// MIMEApplicationProblemJSON is the media type of RFC 7807 problem details
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// Problem is an RFC 7807 problem details response
+type Problem struct {
+	Type   string       `json:"type" example:"urn:problem-type:validation_failed"`
+	Title  string       `json:"title" example:"Bad Request"`
+	Status int          `json:"status" example:"400"`
+	Detail string       `json:"detail,omitempty" example:"request validation failed"`
+	Code   string       `json:"code" example:"validation_failed"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError describes an invalid field of the request
+type FieldError struct {
+	Field   string `json:"field" example:"price"`
+	Code    string `json:"code" example:"min"`
+	Message string `json:"message" example:"must be at least 0"`
+}
+
+func (p *Problem) Error() string {
+	return p.Detail
 }
 
-func (err *ErrorResponse) Error() string {
-	return err.Message
+// ProblemType returns the problem type URI of an error code
+func ProblemType(code string) string {
+	return "urn:problem-type:" + code
 }
 
-func ResponseError(c echo.Context, status int, err error) {
-	c.JSON(status, ErrorResponse{
-		Message: err.Error(),
-	})
+func ResponseProblem(c echo.Context, problem Problem) error {
+	if problem.Title == "" {
+		problem.Title = http.StatusText(problem.Status)
+	}
+	if problem.Type == "" {
+		problem.Type = ProblemType(problem.Code)
+	}
+	body, err := json.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	return c.Blob(problem.Status, MIMEApplicationProblemJSON, body)
 }
 
 func ResponseSuccess(c echo.Context, payload any) {
@@ -0,0 +1,5 @@
+ALTER TABLE subscriptions
+    ADD COLUMN billing_period VARCHAR(16) NOT NULL DEFAULT 'monthly'
+        CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly')),
+    ADD COLUMN billing_interval INTEGER NOT NULL DEFAULT 1
+        CHECK (billing_interval > 0);
@@ -0,0 +1,5 @@
+UPDATE subscriptions SET price = price / 100;
+
+ALTER TABLE subscriptions
+    DROP COLUMN IF EXISTS currency,
+    ALTER COLUMN price TYPE INTEGER;
@@ -0,0 +1,6 @@
+-- Prices are stored in minor units of the subscription currency from now on.
+ALTER TABLE subscriptions
+    ALTER COLUMN price TYPE BIGINT,
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'RUB';
+
+UPDATE subscriptions SET price = price * 100;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS subscription_prices (
+    user_id UUID NOT NULL,
+    service_name VARCHAR(255) NOT NULL,
+    effective_from DATE NOT NULL,
+    price BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    PRIMARY KEY (user_id, service_name, effective_from),
+    FOREIGN KEY (user_id, service_name) REFERENCES subscriptions (user_id, service_name)
+        ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+INSERT INTO subscription_prices (user_id, service_name, effective_from, price, currency)
+SELECT user_id, service_name, start_date, price, currency FROM subscriptions;
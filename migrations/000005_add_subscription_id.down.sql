@@ -0,0 +1,32 @@
+-- Only the latest subscription of a user to a service survives the rollback.
+DELETE FROM subscriptions s
+USING subscriptions newer
+WHERE newer.user_id = s.user_id
+  AND newer.service_name = s.service_name
+  AND (newer.start_date, newer.id) > (s.start_date, s.id);
+
+DROP INDEX IF EXISTS subscriptions_user_id_service_name_idx;
+
+ALTER TABLE subscription_prices
+    ADD COLUMN user_id UUID,
+    ADD COLUMN service_name VARCHAR(255);
+UPDATE subscription_prices p SET user_id = s.user_id, service_name = s.service_name
+FROM subscriptions s
+WHERE s.id = p.subscription_id;
+
+ALTER TABLE subscription_prices
+    DROP CONSTRAINT IF EXISTS subscription_prices_subscription_id_fkey,
+    DROP CONSTRAINT IF EXISTS subscription_prices_pkey,
+    DROP COLUMN subscription_id,
+    ALTER COLUMN user_id SET NOT NULL,
+    ALTER COLUMN service_name SET NOT NULL;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_pkey,
+    DROP COLUMN id,
+    ADD PRIMARY KEY (user_id, service_name);
+
+ALTER TABLE subscription_prices
+    ADD PRIMARY KEY (user_id, service_name, effective_from),
+    ADD FOREIGN KEY (user_id, service_name) REFERENCES subscriptions (user_id, service_name)
+        ON UPDATE CASCADE ON DELETE CASCADE;
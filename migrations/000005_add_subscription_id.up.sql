@@ -0,0 +1,25 @@
+-- Subscriptions are identified by a surrogate id, so a user may hold several
+-- subscriptions to the same service.
+ALTER TABLE subscriptions ADD COLUMN id UUID NOT NULL DEFAULT gen_random_uuid();
+
+ALTER TABLE subscription_prices ADD COLUMN subscription_id UUID;
+UPDATE subscription_prices p SET subscription_id = s.id
+FROM subscriptions s
+WHERE s.user_id = p.user_id AND s.service_name = p.service_name;
+
+ALTER TABLE subscription_prices
+    DROP CONSTRAINT IF EXISTS subscription_prices_user_id_service_name_fkey,
+    DROP CONSTRAINT IF EXISTS subscription_prices_pkey,
+    DROP COLUMN user_id,
+    DROP COLUMN service_name,
+    ALTER COLUMN subscription_id SET NOT NULL;
+
+ALTER TABLE subscriptions
+    DROP CONSTRAINT IF EXISTS subscriptions_pkey,
+    ADD PRIMARY KEY (id);
+
+ALTER TABLE subscription_prices
+    ADD PRIMARY KEY (subscription_id, effective_from),
+    ADD FOREIGN KEY (subscription_id) REFERENCES subscriptions (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS subscriptions_user_id_service_name_idx ON subscriptions (user_id, service_name, start_date);
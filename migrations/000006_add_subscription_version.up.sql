@@ -0,0 +1,3 @@
+-- The version is incremented on every change and used for optimistic
+-- concurrency control.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
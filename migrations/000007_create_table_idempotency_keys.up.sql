@@ -0,0 +1,12 @@
+-- Responses of requests sent with an Idempotency-Key header, replayed when
+-- the request is retried until they expire.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key VARCHAR(255) PRIMARY KEY,
+    request_hash CHAR(64) NOT NULL,
+    status_code INTEGER NOT NULL,
+    header JSONB NOT NULL DEFAULT '{}',
+    body BYTEA NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
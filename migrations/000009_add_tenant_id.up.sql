@@ -0,0 +1,14 @@
+-- Subscriptions and API keys belong to a tenant, an organisation whose data
+-- is isolated from the others. Existing rows move to the default tenant,
+-- new rows must name their tenant.
+ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE subscriptions ALTER COLUMN tenant_id DROP DEFAULT;
+
+DROP INDEX IF EXISTS subscriptions_user_id_service_name_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_tenant_id_user_id_service_name_idx ON subscriptions (tenant_id, user_id, service_name, start_date);
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(63) NOT NULL DEFAULT 'default';
+ALTER TABLE api_keys ALTER COLUMN tenant_id DROP DEFAULT;
+
+DROP INDEX IF EXISTS api_keys_user_id_idx;
+CREATE INDEX IF NOT EXISTS api_keys_tenant_id_user_id_idx ON api_keys (tenant_id, user_id);
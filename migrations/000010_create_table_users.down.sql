@@ -0,0 +1,4 @@
+ALTER TABLE api_keys DROP CONSTRAINT IF EXISTS api_keys_user_fkey;
+ALTER TABLE subscriptions DROP CONSTRAINT IF EXISTS subscriptions_user_fkey;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,29 @@
+-- Users own subscriptions and API keys, which are deleted with them. Every
+-- user already referenced by a subscription or an API key gets a profile.
+CREATE TABLE IF NOT EXISTS users (
+    tenant_id VARCHAR(63) NOT NULL,
+    id UUID NOT NULL,
+    display_name VARCHAR(255) NOT NULL DEFAULT '',
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    currency CHAR(3) NOT NULL DEFAULT 'RUB',
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant_id, id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_id_email_idx ON users (tenant_id, lower(email)) WHERE email <> '';
+
+INSERT INTO users (tenant_id, id)
+SELECT DISTINCT tenant_id, user_id FROM subscriptions
+ON CONFLICT DO NOTHING;
+
+INSERT INTO users (tenant_id, id)
+SELECT DISTINCT tenant_id, user_id FROM api_keys
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE subscriptions ADD CONSTRAINT subscriptions_user_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE api_keys ADD CONSTRAINT api_keys_user_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE;
@@ -0,0 +1,15 @@
+-- Members share the cost of a subscription paid by its user, by weight or by
+-- a fixed amount of every charge. Members leave with their user.
+CREATE TABLE IF NOT EXISTS subscription_members (
+    subscription_id UUID NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    tenant_id VARCHAR(63) NOT NULL,
+    user_id UUID NOT NULL,
+    position INTEGER NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 0 CHECK (weight >= 0),
+    amount BIGINT CHECK (amount >= 0),
+    PRIMARY KEY (subscription_id, user_id),
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users (tenant_id, id) ON DELETE CASCADE,
+    CHECK ((amount IS NULL) = (weight > 0))
+);
+
+CREATE INDEX IF NOT EXISTS subscription_members_tenant_id_user_id_idx ON subscription_members (tenant_id, user_id);
@@ -0,0 +1,26 @@
+// Package migrations embeds the SQL migrations of the database schemas in
+// the golang-migrate file format.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed *.sql sqlite/*.sql
+var files embed.FS
+
+var (
+	// Postgres holds the migrations of the PostgreSQL schema.
+	Postgres = mustSub(".")
+	// SQLite holds the migrations of the SQLite schema.
+	SQLite = mustSub("sqlite")
+)
+
+func mustSub(dir string) fs.FS {
+	sub, err := fs.Sub(files, dir)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,18 @@
+-- The SQLite schema matches the PostgreSQL one after its migrations. Dates
+-- are stored as text in a single format, so they compare in order.
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL CHECK (length(user_id) = 36),
+    service_name TEXT NOT NULL,
+    price INTEGER NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'RUB' CHECK (length(currency) = 3),
+    start_date DATE NOT NULL,
+    end_date DATE,
+    billing_period TEXT NOT NULL DEFAULT 'monthly'
+        CHECK (billing_period IN ('weekly', 'monthly', 'quarterly', 'yearly')),
+    billing_interval INTEGER NOT NULL DEFAULT 1
+        CHECK (billing_interval > 0),
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS subscriptions_user_id_service_name_idx ON subscriptions (user_id, service_name, start_date);
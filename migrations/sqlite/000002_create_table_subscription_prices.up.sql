@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS subscription_prices (
+    subscription_id TEXT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    effective_from DATE NOT NULL,
+    price INTEGER NOT NULL,
+    currency TEXT NOT NULL CHECK (length(currency) = 3),
+    PRIMARY KEY (subscription_id, effective_from)
+);
@@ -0,0 +1,12 @@
+-- Responses of requests sent with an Idempotency-Key header, replayed when
+-- the request is retried until they expire.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    status_code INTEGER NOT NULL,
+    header TEXT NOT NULL DEFAULT '{}',
+    body BLOB NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS api_keys_tenant_id_user_id_idx;
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+ALTER TABLE api_keys DROP COLUMN tenant_id;
+
+DROP INDEX IF EXISTS subscriptions_tenant_id_user_id_service_name_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_user_id_service_name_idx ON subscriptions (user_id, service_name, start_date);
+ALTER TABLE subscriptions DROP COLUMN tenant_id;
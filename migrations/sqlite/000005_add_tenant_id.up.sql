@@ -0,0 +1,11 @@
+-- Subscriptions and API keys belong to a tenant. Existing rows move to the
+-- default tenant, SQLite cannot drop the default of a column afterwards.
+ALTER TABLE subscriptions ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS subscriptions_user_id_service_name_idx;
+CREATE INDEX IF NOT EXISTS subscriptions_tenant_id_user_id_service_name_idx ON subscriptions (tenant_id, user_id, service_name, start_date);
+
+ALTER TABLE api_keys ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+
+DROP INDEX IF EXISTS api_keys_user_id_idx;
+CREATE INDEX IF NOT EXISTS api_keys_tenant_id_user_id_idx ON api_keys (tenant_id, user_id);
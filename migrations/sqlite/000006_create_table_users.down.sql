@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS users_delete_cascade;
+DROP TRIGGER IF EXISTS api_keys_user_fkey;
+DROP TRIGGER IF EXISTS subscriptions_user_fkey;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,43 @@
+-- Users own subscriptions and API keys, which are deleted with them. Every
+-- user already referenced by a subscription or an API key gets a profile.
+CREATE TABLE IF NOT EXISTS users (
+    tenant_id TEXT NOT NULL,
+    id TEXT NOT NULL CHECK (length(id) = 36),
+    display_name TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL DEFAULT '',
+    currency TEXT NOT NULL DEFAULT 'RUB' CHECK (length(currency) = 3),
+    timezone TEXT NOT NULL DEFAULT 'UTC',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id, id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_tenant_id_email_idx ON users (tenant_id, lower(email)) WHERE email <> '';
+
+INSERT OR IGNORE INTO users (tenant_id, id)
+SELECT DISTINCT tenant_id, user_id FROM subscriptions;
+
+INSERT OR IGNORE INTO users (tenant_id, id)
+SELECT DISTINCT tenant_id, user_id FROM api_keys;
+
+-- SQLite cannot add foreign keys to existing tables, triggers enforce them.
+CREATE TRIGGER IF NOT EXISTS subscriptions_user_fkey
+BEFORE INSERT ON subscriptions
+WHEN NOT EXISTS (SELECT 1 FROM users WHERE tenant_id = NEW.tenant_id AND id = NEW.user_id)
+BEGIN
+    SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+CREATE TRIGGER IF NOT EXISTS api_keys_user_fkey
+BEFORE INSERT ON api_keys
+WHEN NOT EXISTS (SELECT 1 FROM users WHERE tenant_id = NEW.tenant_id AND id = NEW.user_id)
+BEGIN
+    SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_delete_cascade
+AFTER DELETE ON users
+BEGIN
+    DELETE FROM subscriptions WHERE tenant_id = OLD.tenant_id AND user_id = OLD.id;
+    DELETE FROM api_keys WHERE tenant_id = OLD.tenant_id AND user_id = OLD.id;
+END;